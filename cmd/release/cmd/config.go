@@ -1,12 +1,21 @@
 package cmd
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"os"
+	"sort"
 
 	"github.com/rancher/ecm-distro-tools/cmd/release/config"
+	"github.com/rancher/ecm-distro-tools/release/k3s"
+	"github.com/rancher/ecm-distro-tools/repository"
 	"github.com/spf13/cobra"
+	"golang.org/x/mod/semver"
 )
 
+var k3sSuggestMinors int
+
 // configCmd represents the config command
 var configCmd = &cobra.Command{
 	Use:   "config",
@@ -43,10 +52,81 @@ var editConfigSubCmd = &cobra.Command{
 	},
 }
 
+var k3sConfigSubCmd = &cobra.Command{
+	Use:   "k3s",
+	Short: "Manage the k3s release configs",
+}
+
+var k3sSuggestConfigSubCmd = &cobra.Command{
+	Use:   "suggest",
+	Short: "Suggest the k3s release configs of the next patches",
+	Long: `Suggest the k3s release configs of the next patch of the latest minors,
+from their last k3s release to the latest kubernetes patch. The configs are
+printed as the k3s section of the config, to be reviewed and merged into it.
+The fields which aren't derived from the tags, e.g. the workspace, are copied
+from the latest k3s version of the config.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx := context.Background()
+		ghClient := repository.NewGithub(ctx, rootConfig.Auth.GithubToken)
+
+		suggestions, err := k3s.SuggestReleases(ctx, ghClient, k3sSuggestBase(), k3sSuggestMinors)
+		if err != nil {
+			return err
+		}
+
+		// stdout is kept to the config, to be merged as is
+		for _, release := range suggestions.UpToDate {
+			fmt.Fprintln(os.Stderr, release+" is up to date with kubernetes, skipping")
+		}
+
+		b, err := json.MarshalIndent(config.K3s{Versions: suggestions.Versions}, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(b))
+		return nil
+	},
+}
+
+// k3sSuggestBase returns the repository owners, URLs and workspace of the
+// latest k3s version of the config, or the defaults of the example config if
+// there's none. Fields of a single run, e.g. dry_run, aren't carried over.
+func k3sSuggestBase() config.K3sRelease {
+	if rootConfig.K3s != nil && len(rootConfig.K3s.Versions) > 0 {
+		versions := make([]string, 0, len(rootConfig.K3s.Versions))
+		for version := range rootConfig.K3s.Versions {
+			versions = append(versions, version)
+		}
+		sort.Slice(versions, func(i, j int) bool {
+			return semver.Compare(versions[i], versions[j]) < 0
+		})
+		latest := rootConfig.K3s.Versions[versions[len(versions)-1]]
+
+		return config.K3sRelease{
+			K3sRepoOwner:                  latest.K3sRepoOwner,
+			SystemAgentInstallerRepoOwner: latest.SystemAgentInstallerRepoOwner,
+			K8sRancherURL:                 latest.K8sRancherURL,
+			K3sUpstreamURL:                latest.K3sUpstreamURL,
+			Workspace:                     latest.Workspace,
+		}
+	}
+
+	return config.K3sRelease{
+		K3sRepoOwner:                  config.K3sGithubOrganization,
+		SystemAgentInstallerRepoOwner: config.RancherGithubOrganization,
+		K8sRancherURL:                 config.K3sKubernetesGitURI,
+		K3sUpstreamURL:                "git@github.com:k3s-io/k3s.git",
+	}
+}
+
 func init() {
 	rootCmd.AddCommand(configCmd)
 
 	configCmd.AddCommand(genConfigSubCmd)
 	configCmd.AddCommand(viewConfigSubCmd)
 	configCmd.AddCommand(editConfigSubCmd)
+	configCmd.AddCommand(k3sConfigSubCmd)
+	k3sConfigSubCmd.AddCommand(k3sSuggestConfigSubCmd)
+
+	k3sSuggestConfigSubCmd.Flags().IntVar(&k3sSuggestMinors, "minors", 3, "number of latest minors to suggest a release of")
 }
@@ -6,12 +6,16 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/google/go-github/v81/github"
+	httpecm "github.com/rancher/ecm-distro-tools/http"
+	reg "github.com/rancher/ecm-distro-tools/registry"
 	"github.com/rancher/ecm-distro-tools/release"
 	"github.com/rancher/ecm-distro-tools/release/k3s"
 	"github.com/rancher/ecm-distro-tools/release/kdm"
@@ -44,6 +48,8 @@ var (
 	username                              string
 	password                              string
 	rancherMissingImagesJSONOutput        bool
+	rancherMissingImagesStateFile         string
+	rancherMissingImagesResume            bool
 	rke2PrevMilestone                     string
 	rke2Milestone                         string
 	rancherArtifactsIndexWriteToPath      string
@@ -52,6 +58,7 @@ var (
 	rancherImagesDigestsOutputFile        string
 	rancherImagesDigestsRegistry          string
 	rancherImagesDigestsImagesURL         string
+	rancherImagesDigestsFormat            string
 	rancherSyncImages                     []string
 	rancherSourceRegistry                 string
 	rancherTargetRegistry                 string
@@ -59,7 +66,19 @@ var (
 	rancherMetricsRancherReleasesFilePath string
 	rancherMetricsWorkflowsFilePath       string
 	rancherMetricsPrimeReleasesFilePath   string
+	rancherImagesDiffOutput               string
+	rancherImagesDiffAssetsURL            string
+	rancherImagesDiffCacheDir             string
 	releases                              []string
+	releaseNotesOwner                     string
+	releaseNotesMilestone                 string
+	releaseNotesPrevMilestone             string
+	releaseNotesTemplatePath              string
+	rke2ComponentsPath                    string
+	k3sComponentsPath                     string
+	releaseNotesLint                      bool
+	releaseNotesCompare                   string
+	changelogReportOutput                 string
 )
 
 // generateCmd represents the generate command
@@ -68,6 +87,133 @@ var generateCmd = &cobra.Command{
 	Short: "Various utilities to generate release artifacts",
 }
 
+var generateReleaseNotesSubCmd = &cobra.Command{
+	Use:   "release-notes [repo]",
+	Short: "Generate the release notes of any repository with a release notes template",
+	Long: `Generate the release notes of a repository with its template. k3s, rke2, ui, dashboard and cli
+have compiled-in templates, other repositories can be added to release_notes in the config.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) < 1 {
+			return errors.New("expected at least one argument: [repo]")
+		}
+		repo := args[0]
+
+		owner, err := releaseNotesRepoOwner(repo)
+		if err != nil {
+			return err
+		}
+
+		if releaseNotesTemplatePath != "" {
+			b, err := os.ReadFile(releaseNotesTemplatePath)
+			if err != nil {
+				return err
+			}
+			if err := release.RegisterReleaseNoteTemplate(repo, string(b)); err != nil {
+				return err
+			}
+		}
+
+		ctx := context.Background()
+		client := repository.NewGithub(ctx, rootConfig.Auth.GithubToken)
+
+		notes, err := release.GenReleaseNotes(ctx, owner, repo, releaseNotesMilestone, releaseNotesPrevMilestone, client)
+		if err != nil {
+			return err
+		}
+
+		return reviewReleaseNotes(ctx, client, owner, repo, notes.String())
+	},
+}
+
+var generateChangeLogReportSubCmd = &cobra.Command{
+	Use:   "changelog-report [repo]",
+	Short: "Reconcile the commits between two releases with their pull requests and the release milestone",
+	Long: `List the commits between two releases which have no pull request, e.g. direct pushes and bot commits,
+the commits with several pull requests and the one picked for the changelog, and the pull requests of the
+release milestone which aren't in the commits, or the reverse. The owner is resolved as in release-notes.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) < 1 {
+			return errors.New("expected at least one argument: [repo]")
+		}
+		repo := args[0]
+
+		owner, err := releaseNotesRepoOwner(repo)
+		if err != nil {
+			return err
+		}
+
+		ctx := context.Background()
+		client := repository.NewGithub(ctx, rootConfig.Auth.GithubToken)
+
+		report, err := repository.ReconcileChangeLog(ctx, client, owner, repo, releaseNotesPrevMilestone, releaseNotesMilestone)
+		if err != nil {
+			return err
+		}
+
+		switch changelogReportOutput {
+		case "json":
+			b, err := json.MarshalIndent(report, "", "  ")
+			if err != nil {
+				return err
+			}
+			fmt.Println(string(b))
+		case "text":
+			fmt.Print(report.String())
+		default:
+			return errors.New("invalid output format: " + changelogReportOutput)
+		}
+
+		return nil
+	},
+}
+
+// releaseNotesRepoOwner returns the owner of the repository, from --owner or
+// from the release_notes config
+func releaseNotesRepoOwner(repo string) (string, error) {
+	owner := releaseNotesOwner
+	if owner == "" {
+		owner = rootConfig.ReleaseNotes[repo].Owner
+	}
+	if owner == "" {
+		return "", errors.New("no owner for " + repo + ", use --owner or set it in release_notes")
+	}
+
+	return owner, nil
+}
+
+// reviewReleaseNotes prints the generated notes or, with --lint and --compare,
+// the problems found in them and their diff against a published release
+func reviewReleaseNotes(ctx context.Context, client *github.Client, owner, repo, notes string) error {
+	if !releaseNotesLint && releaseNotesCompare == "" {
+		fmt.Print(notes)
+		return nil
+	}
+
+	if releaseNotesCompare != "" {
+		diff, err := release.CompareReleaseNotes(ctx, client, owner, repo, releaseNotesCompare, notes)
+		if err != nil {
+			return err
+		}
+		if diff == "" {
+			fmt.Println("generated release notes match " + releaseNotesCompare)
+		}
+		fmt.Print(diff)
+	}
+
+	if releaseNotesLint {
+		httpClient := httpecm.NewClient(time.Second * 30)
+		findings := release.LintReleaseNotes(ctx, notes, &httpClient)
+		for _, finding := range findings {
+			fmt.Println(finding)
+		}
+		if len(findings) > 0 {
+			return errors.New("found " + strconv.Itoa(len(findings)) + " problems in the release notes")
+		}
+	}
+
+	return nil
+}
+
 var k3sGenerateSubCmd = &cobra.Command{
 	Use:   "k3s",
 	Short: "Generate k3s related artifacts",
@@ -85,9 +231,7 @@ var k3sGenerateReleaseNotesSubCmd = &cobra.Command{
 			return err
 		}
 
-		fmt.Print(notes.String())
-
-		return nil
+		return reviewReleaseNotes(ctx, client, "k3s-io", "k3s", notes.String())
 	},
 }
 
@@ -109,6 +253,41 @@ var k3sGenerateTagsSubCmd = &cobra.Command{
 	},
 }
 
+var k3sGenerateComponentsSubCmd = &cobra.Command{
+	Use:   "components [version]",
+	Short: "Generate the versions of the components of a k3s release as JSON",
+	Long: `Resolve the versions of the components of a k3s release, and the file each one was resolved from,
+from the files of the k3s repository at the release tag. Missing or ambiguous components are reported as errors.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) < 1 {
+			return errors.New("expected at least one argument: [version]")
+		}
+		version := args[0]
+
+		var source release.ComponentSource
+		if k3sComponentsPath != "" {
+			source = release.NewFSComponentSource(os.DirFS(k3sComponentsPath))
+		} else {
+			ctx := context.Background()
+			client := repository.NewGithub(ctx, rootConfig.Auth.GithubToken)
+			source = release.NewGithubComponentSource(ctx, client, "k3s-io", "k3s", version)
+		}
+
+		components, err := release.ResolveK3sComponents(source, version)
+		if err != nil {
+			return err
+		}
+
+		b, err := json.MarshalIndent(components, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(b))
+
+		return nil
+	},
+}
+
 var rke2GenerateSubCmd = &cobra.Command{
 	Use:   "rke2",
 	Short: "Generate rke2 related artifacts",
@@ -126,7 +305,40 @@ var rke2GenerateReleaseNotesSubCmd = &cobra.Command{
 			return err
 		}
 
-		fmt.Print(notes.String())
+		return reviewReleaseNotes(ctx, client, "rancher", "rke2", notes.String())
+	},
+}
+
+var rke2GenerateComponentsSubCmd = &cobra.Command{
+	Use:   "components [version]",
+	Short: "Generate the versions of the components of an rke2 release as JSON",
+	Long: `Resolve the versions of the components of an rke2 release, and the file each one was resolved from,
+from the files of the rke2 repository at the release tag. Missing or ambiguous components are reported as errors.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) < 1 {
+			return errors.New("expected at least one argument: [version]")
+		}
+		version := args[0]
+
+		var source release.ComponentSource
+		if rke2ComponentsPath != "" {
+			source = release.NewFSComponentSource(os.DirFS(rke2ComponentsPath))
+		} else {
+			ctx := context.Background()
+			client := repository.NewGithub(ctx, rootConfig.Auth.GithubToken)
+			source = release.NewGithubComponentSource(ctx, client, "rancher", "rke2", version)
+		}
+
+		components, err := release.ResolveRKE2Components(source, version)
+		if err != nil {
+			return err
+		}
+
+		b, err := json.MarshalIndent(components, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(b))
 
 		return nil
 	},
@@ -172,6 +384,21 @@ var rancherGenerateArtifactsIndexSubCmd = &cobra.Command{
 	},
 }
 
+// rancherRegistryClient returns a client for the registry authenticated with
+// the --username and --password flags, or the configured credentials if unset
+func rancherRegistryClient(registry string, opts ...reg.Option) rancher.RegistryClient {
+	if username != "" && password != "" {
+		return reg.NewClient(registry, debug, append(opts, reg.WithBasicAuth(username, password))...)
+	}
+	return newRegistryClient(registry, opts...)
+}
+
+// rancherImageCheckClient returns a registry client for the checks of missing
+// images, which don't need the platforms of the images
+func rancherImageCheckClient(registry string) rancher.RegistryClient {
+	return rancherRegistryClient(registry, reg.WithoutPlatforms())
+}
+
 var rancherGenerateImagesLocationsSubCmd = &cobra.Command{
 	Use:   "images-locations",
 	Short: "Generate a json with images locations and if there any missing images",
@@ -189,7 +416,7 @@ var rancherGenerateImagesLocationsSubCmd = &cobra.Command{
 			checkImages = append(checkImages, rancherImages...)
 		}
 
-		imagesLocations, err := rancher.ImagesLocations(username, password, concurrencyLimit, checkImages, ignoreImages, registry, registries)
+		imagesLocations, err := rancher.ImagesLocations(context.Background(), rancherImageCheckClient, concurrencyLimit, checkImages, ignoreImages, registry, registries)
 		if err != nil {
 			return err
 		}
@@ -219,8 +446,26 @@ var rancherGenerateMissingImagesListSubCmd = &cobra.Command{
 			checkImages = append(checkImages, rancherImages...)
 		}
 
-		missingImages, err := rancher.MissingImagesFromRegistry(username, password, registry, concurrencyLimit, checkImages, ignoreImages)
+		var state *rancher.ImageChecksState
+		switch {
+		case rancherMissingImagesResume:
+			if rancherMissingImagesStateFile == "" {
+				return errors.New("--resume requires --state-file")
+			}
+			var err error
+			state, err = rancher.LoadImageChecksState(rancherMissingImagesStateFile, registry)
+			if err != nil {
+				return err
+			}
+		case rancherMissingImagesStateFile != "":
+			state = rancher.NewImageChecksState(rancherMissingImagesStateFile, registry)
+		}
+
+		missingImages, err := rancher.MissingImagesFromRegistry(context.Background(), rancherImageCheckClient(registry), concurrencyLimit, checkImages, ignoreImages, state)
 		if err != nil {
+			if state != nil {
+				return errors.New(err.Error() + ", run again with --resume to only check them")
+			}
 			return err
 		}
 		if len(missingImages) != 0 && !rancherMissingImagesJSONOutput {
@@ -244,7 +489,8 @@ var rancherGenerateDockerImagesDigestsSubCmd = &cobra.Command{
 	Use:   "docker-images-digests",
 	Short: "Generate a file with images digests from an images list",
 	RunE: func(cmd *cobra.Command, args []string) error {
-		return rancher.GenerateDockerImageDigests(rancherImagesDigestsOutputFile, rancherImagesDigestsImagesURL, rancherImagesDigestsRegistry, username, password, verbose)
+		client := rancherRegistryClient(rancherImagesDigestsRegistry)
+		return rancher.GenerateDockerImageDigests(context.Background(), client, rancherImagesDigestsOutputFile, rancherImagesDigestsImagesURL, rancherImagesDigestsRegistry, rancherImagesDigestsFormat)
 	},
 }
 
@@ -256,6 +502,69 @@ var rancherGenerateImagesSyncConfigSubCmd = &cobra.Command{
 	},
 }
 
+var rancherGenerateImagesDiffSubCmd = &cobra.Command{
+	Use:   "images-diff [old] [new]",
+	Short: "List the images added, removed and changed between two Rancher versions",
+	Long: `List the images added, removed and changed in tag between two Rancher versions,
+grouped by repository. The rancher-images.txt of each version is read from the
+GitHub release by default, or from <assets-url>/<version>/ when --assets-url is set.`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx := context.Background()
+
+		oldImages, err := rancherReleaseImages(ctx, args[0])
+		if err != nil {
+			return errors.New("failed to read images of " + args[0] + ": " + err.Error())
+		}
+		newImages, err := rancherReleaseImages(ctx, args[1])
+		if err != nil {
+			return errors.New("failed to read images of " + args[1] + ": " + err.Error())
+		}
+
+		diff, err := rancher.DiffImages(args[0], args[1], oldImages, newImages)
+		if err != nil {
+			return err
+		}
+
+		switch rancherImagesDiffOutput {
+		case "json":
+			b, err := json.MarshalIndent(diff, "", "  ")
+			if err != nil {
+				return err
+			}
+			fmt.Println(string(b))
+			return nil
+		case "markdown":
+			return diff.Markdown(os.Stdout)
+		default:
+			return errors.New("invalid output format: " + rancherImagesDiffOutput)
+		}
+	},
+}
+
+// rancherReleaseImages reads the images list of a Rancher version from its
+// GitHub release, or from an HTTP mirror if --assets-url is set
+func rancherReleaseImages(ctx context.Context, version string) ([]string, error) {
+	if rancherImagesDiffAssetsURL != "" {
+		filesystem, err := release.NewHTTPFS(ctx, nil, strings.TrimSuffix(rancherImagesDiffAssetsURL, "/")+"/"+version)
+		if err != nil {
+			return nil, err
+		}
+		return rancher.ImagesFromFS(filesystem)
+	}
+
+	gh := repository.NewGithub(ctx, rootConfig.Auth.GithubToken)
+	filesystem, err := release.NewFS(ctx, gh, "rancher", "rancher", version)
+	if err != nil {
+		return nil, err
+	}
+	if rancherImagesDiffCacheDir != "" {
+		filesystem.WithCache(rancherImagesDiffCacheDir)
+	}
+
+	return rancher.ImagesFromFS(filesystem)
+}
+
 var rancherGenerateMetricsSubCmd = &cobra.Command{
 	Use:   "metrics",
 	Short: "Generate rancher release metrics",
@@ -421,14 +730,17 @@ func init() {
 
 	k3sGenerateSubCmd.AddCommand(k3sGenerateReleaseNotesSubCmd)
 	k3sGenerateSubCmd.AddCommand(k3sGenerateTagsSubCmd)
+	k3sGenerateSubCmd.AddCommand(k3sGenerateComponentsSubCmd)
 
 	rke2GenerateSubCmd.AddCommand(rke2GenerateReleaseNotesSubCmd)
+	rke2GenerateSubCmd.AddCommand(rke2GenerateComponentsSubCmd)
 
 	rancherGenerateSubCmd.AddCommand(rancherGenerateArtifactsIndexSubCmd)
 	rancherGenerateSubCmd.AddCommand(rancherGenerateMissingImagesListSubCmd)
 	rancherGenerateSubCmd.AddCommand(rancherGenerateImagesLocationsSubCmd)
 	rancherGenerateSubCmd.AddCommand(rancherGenerateDockerImagesDigestsSubCmd)
 	rancherGenerateSubCmd.AddCommand(rancherGenerateImagesSyncConfigSubCmd)
+	rancherGenerateSubCmd.AddCommand(rancherGenerateImagesDiffSubCmd)
 	rancherGenerateSubCmd.AddCommand(rancherGenerateMetricsSubCmd)
 
 	uiGenerateSubCmd.AddCommand(uiGenerateReleaseNotesSubCmd)
@@ -438,6 +750,8 @@ func init() {
 	kdmGenerateSubCmd.AddCommand(kdmGenerateRKE2ChartsSubCmd)
 	kdmGenerateSubCmd.AddCommand(kdmGenerateRKE2SubCmd)
 
+	generateCmd.AddCommand(generateReleaseNotesSubCmd)
+	generateCmd.AddCommand(generateChangeLogReportSubCmd)
 	generateCmd.AddCommand(k3sGenerateSubCmd)
 	generateCmd.AddCommand(rke2GenerateSubCmd)
 	generateCmd.AddCommand(rancherGenerateSubCmd)
@@ -446,9 +760,41 @@ func init() {
 	generateCmd.AddCommand(cliGenerateSubCmd)
 	generateCmd.AddCommand(kdmGenerateSubCmd)
 
+	// release notes
+	generateReleaseNotesSubCmd.Flags().StringVar(&releaseNotesOwner, "owner", "", "Owner of the repository, defaults to the one in release_notes")
+	generateReleaseNotesSubCmd.Flags().StringVarP(&releaseNotesPrevMilestone, "prev-milestone", "p", "", "Previous Milestone")
+	generateReleaseNotesSubCmd.Flags().StringVarP(&releaseNotesMilestone, "milestone", "m", "", "Milestone")
+	generateReleaseNotesSubCmd.Flags().StringVarP(&releaseNotesTemplatePath, "template", "t", "", "Path to a template replacing the one of the repository")
+	generateReleaseNotesSubCmd.Flags().BoolVar(&releaseNotesLint, "lint", false, "Check the generated notes for empty fields, missing release notes, duplicate entries and broken links")
+	generateReleaseNotesSubCmd.Flags().StringVar(&releaseNotesCompare, "compare", "", "Diff the generated notes against the published release of a tag")
+	if err := generateReleaseNotesSubCmd.MarkFlagRequired("prev-milestone"); err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
+	if err := generateReleaseNotesSubCmd.MarkFlagRequired("milestone"); err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
+
+	// changelog report
+	generateChangeLogReportSubCmd.Flags().StringVar(&releaseNotesOwner, "owner", "", "Owner of the repository, defaults to the one in release_notes")
+	generateChangeLogReportSubCmd.Flags().StringVarP(&releaseNotesPrevMilestone, "prev-milestone", "p", "", "Previous Milestone")
+	generateChangeLogReportSubCmd.Flags().StringVarP(&releaseNotesMilestone, "milestone", "m", "", "Milestone")
+	generateChangeLogReportSubCmd.Flags().StringVarP(&changelogReportOutput, "output", "o", "text", "Output format (text|json)")
+	if err := generateChangeLogReportSubCmd.MarkFlagRequired("prev-milestone"); err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
+	if err := generateChangeLogReportSubCmd.MarkFlagRequired("milestone"); err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
+
 	// k3s release notes
 	k3sGenerateReleaseNotesSubCmd.Flags().StringVarP(&k3sPrevMilestone, "prev-milestone", "p", "", "Previous Milestone")
 	k3sGenerateReleaseNotesSubCmd.Flags().StringVarP(&k3sMilestone, "milestone", "m", "", "Milestone")
+	k3sGenerateReleaseNotesSubCmd.Flags().BoolVar(&releaseNotesLint, "lint", false, "Check the generated notes for empty fields, missing release notes, duplicate entries and broken links")
+	k3sGenerateReleaseNotesSubCmd.Flags().StringVar(&releaseNotesCompare, "compare", "", "Diff the generated notes against the published release of a tag")
 	if err := k3sGenerateReleaseNotesSubCmd.MarkFlagRequired("prev-milestone"); err != nil {
 		fmt.Println(err.Error())
 		os.Exit(1)
@@ -458,9 +804,14 @@ func init() {
 		os.Exit(1)
 	}
 
+	// k3s components
+	k3sGenerateComponentsSubCmd.Flags().StringVar(&k3sComponentsPath, "path", "", "Path to a local checkout of k3s at the release tag, instead of reading it from GitHub")
+
 	// rke2 release notes
 	rke2GenerateReleaseNotesSubCmd.Flags().StringVarP(&rke2PrevMilestone, "prev-milestone", "p", "", "Previous Milestone")
 	rke2GenerateReleaseNotesSubCmd.Flags().StringVarP(&rke2Milestone, "milestone", "m", "", "Milestone")
+	rke2GenerateReleaseNotesSubCmd.Flags().BoolVar(&releaseNotesLint, "lint", false, "Check the generated notes for empty fields, missing release notes, duplicate entries and broken links")
+	rke2GenerateReleaseNotesSubCmd.Flags().StringVar(&releaseNotesCompare, "compare", "", "Diff the generated notes against the published release of a tag")
 	if err := rke2GenerateReleaseNotesSubCmd.MarkFlagRequired("prev-milestone"); err != nil {
 		fmt.Println(err.Error())
 		os.Exit(1)
@@ -470,6 +821,9 @@ func init() {
 		os.Exit(1)
 	}
 
+	// rke2 components
+	rke2GenerateComponentsSubCmd.Flags().StringVar(&rke2ComponentsPath, "path", "", "Path to a local checkout of rke2 at the release tag, instead of reading it from GitHub")
+
 	// ui release notes
 	uiGenerateReleaseNotesSubCmd.Flags().StringVarP(&dashboardPrevMilestone, "prev-milestone", "p", "", "Previous Milestone")
 	uiGenerateReleaseNotesSubCmd.Flags().StringVarP(&dashboardMilestone, "milestone", "m", "", "Milestone")
@@ -524,6 +878,8 @@ func init() {
 	// rancher generate missing-images-list
 	rancherGenerateMissingImagesListSubCmd.Flags().IntVarP(&concurrencyLimit, "concurrency-limit", "l", defaultConcurrencyLimit, "Concurrency Limit")
 	rancherGenerateMissingImagesListSubCmd.Flags().BoolVarP(&rancherMissingImagesJSONOutput, "json", "j", false, "JSON Output")
+	rancherGenerateMissingImagesListSubCmd.Flags().StringVarP(&rancherMissingImagesStateFile, "state-file", "s", "", "File the result of every image check is saved to")
+	rancherGenerateMissingImagesListSubCmd.Flags().BoolVar(&rancherMissingImagesResume, "resume", false, "Resume from the state file, only checking images that failed or were never checked")
 	rancherGenerateMissingImagesListSubCmd.Flags().StringVarP(&imagesListURL, "images-list-url", "i", "", "URL of the artifact containing all images for a given version 'rancher-images.txt' (required)")
 	rancherGenerateMissingImagesListSubCmd.Flags().StringSliceVarP(&ignoreImages, "ignore-images", "g", make([]string, 0), "Images to ignore when checking for missing images without the version. e.g: rancher/rancher")
 	rancherGenerateMissingImagesListSubCmd.Flags().StringSliceVarP(&checkImages, "check-images", "k", make([]string, 0), "Images to check for when checking for missing images with the version. e.g: rancher/rancher-agent:v2.9.0")
@@ -533,6 +889,7 @@ func init() {
 
 	// rancher generate docker-images-digests
 	rancherGenerateDockerImagesDigestsSubCmd.Flags().StringVarP(&rancherImagesDigestsOutputFile, "output-file", "o", "", "Output file with images digests")
+	rancherGenerateDockerImagesDigestsSubCmd.Flags().StringVarP(&rancherImagesDigestsFormat, "format", "f", rancher.DigestsFormatText, "Output format (text|json|yaml), json and yaml include the digest of every platform")
 	rancherGenerateDockerImagesDigestsSubCmd.Flags().StringVarP(&username, "username", "u", "", "Docker registry username")
 	rancherGenerateDockerImagesDigestsSubCmd.Flags().StringVarP(&password, "password", "p", "", "Docker registry password")
 	if err := rancherGenerateDockerImagesDigestsSubCmd.MarkFlagRequired("output-file"); err != nil {
@@ -567,6 +924,11 @@ func init() {
 		os.Exit(1)
 	}
 
+	// rancher generate images-diff
+	rancherGenerateImagesDiffSubCmd.Flags().StringVarP(&rancherImagesDiffOutput, "output", "o", "markdown", "Output format (markdown|json)")
+	rancherGenerateImagesDiffSubCmd.Flags().StringVar(&rancherImagesDiffAssetsURL, "assets-url", "", "Read the images lists from an HTTP base URL instead of GitHub, e.g. https://prime.ribs.rancher.io/rancher")
+	rancherGenerateImagesDiffSubCmd.Flags().StringVar(&rancherImagesDiffCacheDir, "cache-dir", defaultAssetsCacheDir(), "Directory GitHub release assets are cached in (empty disables the cache)")
+
 	// rancher generate metrics
 	rancherGenerateMetricsSubCmd.Flags().StringVarP(&rancherMetricsRancherReleasesFilePath, "rancher-releases-file", "r", "", "Path to the releases file")
 	rancherGenerateMetricsSubCmd.Flags().StringVarP(&rancherMetricsWorkflowsFilePath, "workflows-file", "w", "", "Path to the workflows file")
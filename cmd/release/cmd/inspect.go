@@ -2,26 +2,42 @@ package cmd
 
 import (
 	"context"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
 	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
+	"path/filepath"
+	"slices"
 	"sort"
 	"strings"
 	"text/tabwriter"
 
 	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/rancher/ecm-distro-tools/cmd/release/config"
 	reg "github.com/rancher/ecm-distro-tools/registry"
 	"github.com/rancher/ecm-distro-tools/release"
 	"github.com/rancher/ecm-distro-tools/release/rke2"
 	"github.com/rancher/ecm-distro-tools/repository"
 	"github.com/spf13/cobra"
+	"sigs.k8s.io/yaml"
 )
 
 const (
 	ossRegistry = "docker.io"
 )
 
+var (
+	inspectAssetsDir string
+	inspectAssetsURL string
+	inspectCacheDir  string
+)
+
+var inspectOutputFormats = []string{"table", "csv", "json", "yaml", "junit"}
+
 func archStatus(expected bool, ossInfo, primeInfo reg.Image, platform reg.Platform) string {
 	if !expected {
 		return "-"
@@ -44,6 +60,38 @@ func windowsStatus(expected, exists bool) string {
 	return "✗"
 }
 
+// verificationStatus summarizes the verification results of an image in
+// every registry it was checked in. Registries that weren't checked are ignored.
+func verificationStatus(statuses ...reg.VerificationStatus) string {
+	checked := false
+	for _, status := range statuses {
+		switch status {
+		case reg.VerificationSkipped:
+			continue
+		case reg.VerificationPassed:
+			checked = true
+		default:
+			return "✗"
+		}
+	}
+	if !checked {
+		return "-"
+	}
+	return "✓"
+}
+
+// digestStatus reports whether the image is the same in the oss and prime
+// registries, or "-" if it isn't in both of them
+func digestStatus(result rke2.Image) string {
+	if !result.OSSImage.Exists || !result.PrimeImage.Exists {
+		return "-"
+	}
+	if result.DigestMismatch {
+		return "✗"
+	}
+	return "✓"
+}
+
 func formatImageRef(ref name.Reference) string {
 	return ref.Context().RepositoryStr() + ":" + ref.Identifier()
 }
@@ -53,23 +101,30 @@ func table(w io.Writer, results []rke2.Image) {
 		return formatImageRef(results[i].Reference) < formatImageRef(results[j].Reference)
 	})
 
-	missingCount := 0
+	missingCount, mismatchCount := 0, 0
 	for _, result := range results {
 		if !result.OSSImage.Exists || !result.PrimeImage.Exists {
 			missingCount++
 		}
+		if result.DigestMismatch {
+			mismatchCount++
+		}
 	}
 	if missingCount > 0 {
 		fmt.Fprintln(w, missingCount, "incomplete images")
-	} else {
+	}
+	if mismatchCount > 0 {
+		fmt.Fprintln(w, mismatchCount, "images with different oss and prime digests")
+	}
+	if missingCount == 0 && mismatchCount == 0 {
 		fmt.Fprintln(w, "all images OK")
 	}
 
 	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
 	defer tw.Flush()
 
-	fmt.Fprintln(tw, "image\toss\tprime\tsig\tamd64\tarm64\twin")
-	fmt.Fprintln(tw, "-----\t---\t-----\t---\t-----\t-----\t-------")
+	fmt.Fprintln(tw, "image\toss\tprime\tdigest\tsig\tprov\tamd64\tarm64\twin")
+	fmt.Fprintln(tw, "-----\t---\t-----\t------\t---\t----\t-----\t-----\t-------")
 
 	for _, result := range results {
 		ossStatus := "✗"
@@ -84,7 +139,9 @@ func table(w io.Writer, results []rke2.Image) {
 			formatImageRef(result.Reference),
 			ossStatus,
 			primeStatus,
-			"?", // sigstore not implemented
+			digestStatus(result),
+			verificationStatus(result.OSSVerification.Signature, result.PrimeVerification.Signature),
+			verificationStatus(result.OSSVerification.Provenance, result.PrimeVerification.Provenance),
 			archStatus(result.ExpectsLinuxAmd64, result.OSSImage, result.PrimeImage, reg.Platform{OS: "linux", Architecture: "amd64"}),
 			archStatus(result.ExpectsLinuxArm64, result.OSSImage, result.PrimeImage, reg.Platform{OS: "linux", Architecture: "arm64"}),
 			windowsStatus(result.ExpectsWindows, result.OSSImage.Exists && result.PrimeImage.Exists),
@@ -93,12 +150,15 @@ func table(w io.Writer, results []rke2.Image) {
 	}
 }
 
-func csv(w io.Writer, results []rke2.Image) {
+func csvOutput(w io.Writer, results []rke2.Image) error {
 	sort.Slice(results, func(i, j int) bool {
 		return formatImageRef(results[i].Reference) < formatImageRef(results[j].Reference)
 	})
 
-	fmt.Fprintln(w, "image,oss,prime,sig,amd64,arm64,win")
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"image", "oss", "prime", "digest", "sig", "prov", "amd64", "arm64", "win"}); err != nil {
+		return err
+	}
 
 	for _, result := range results {
 		ossStatus := "N"
@@ -143,12 +203,272 @@ func csv(w io.Writer, results []rke2.Image) {
 			formatImageRef(result.Reference),
 			ossStatus,
 			primeStatus,
-			"?", // sigstore not implemented
+			csvStatus(digestStatus(result)),
+			csvStatus(verificationStatus(result.OSSVerification.Signature, result.PrimeVerification.Signature)),
+			csvStatus(verificationStatus(result.OSSVerification.Provenance, result.PrimeVerification.Provenance)),
 			amd64Status,
 			arm64Status,
 			winStatus,
 		}
-		fmt.Fprintln(w, strings.Join(values, ","))
+		if err := cw.Write(values); err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+func jsonOutput(w io.Writer, results []rke2.Image) error {
+	sort.Slice(results, func(i, j int) bool {
+		return formatImageRef(results[i].Reference) < formatImageRef(results[j].Reference)
+	})
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(results)
+}
+
+func yamlOutput(w io.Writer, results []rke2.Image) error {
+	sort.Slice(results, func(i, j int) bool {
+		return formatImageRef(results[i].Reference) < formatImageRef(results[j].Reference)
+	})
+
+	b, err := yaml.Marshal(results)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(b)
+	return err
+}
+
+type junitTestSuites struct {
+	XMLName xml.Name         `xml:"testsuites"`
+	Suites  []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name     string          `xml:"name,attr"`
+	Tests    int             `xml:"tests,attr"`
+	Failures int             `xml:"failures,attr"`
+	Cases    []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	Classname string        `xml:"classname,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// junitOutput writes a JUnit report with a test case for every platform
+// each image is expected on, so CI can gate a release on the inspection. The
+// prime registry is only checked if checkPrime is set.
+func junitOutput(w io.Writer, version string, results []rke2.Image, checkPrime bool) error {
+	sort.Slice(results, func(i, j int) bool {
+		return formatImageRef(results[i].Reference) < formatImageRef(results[j].Reference)
+	})
+
+	suite := junitTestSuite{Name: "release inspect " + version}
+
+	for _, result := range results {
+		for _, platform := range []struct {
+			expected bool
+			platform reg.Platform
+		}{
+			{result.ExpectsLinuxAmd64, reg.Platform{OS: "linux", Architecture: "amd64"}},
+			{result.ExpectsLinuxArm64, reg.Platform{OS: "linux", Architecture: "arm64"}},
+			{result.ExpectsWindows, reg.Platform{OS: "windows", Architecture: "amd64"}},
+		} {
+			if !platform.expected {
+				continue
+			}
+
+			testCase := junitTestCase{
+				Name:      platform.platform.String(),
+				Classname: formatImageRef(result.Reference),
+			}
+			if failures := platformFailures(result, platform.platform, checkPrime); len(failures) > 0 {
+				testCase.Failure = &junitFailure{
+					Message: failures[0],
+					Text:    strings.Join(failures, "\n"),
+				}
+				suite.Failures++
+			}
+
+			suite.Cases = append(suite.Cases, testCase)
+			suite.Tests++
+		}
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(junitTestSuites{Suites: []junitTestSuite{suite}}); err != nil {
+		return err
+	}
+
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// platformFailures returns the reasons the image isn't available for the
+// platform in the oss registry and, if checkPrime is set, the prime registry.
+// Windows images are only checked for existence, the same as in the table
+// output.
+func platformFailures(result rke2.Image, platform reg.Platform, checkPrime bool) []string {
+	var failures []string
+
+	for _, r := range []struct {
+		name  string
+		image reg.Image
+		check bool
+	}{
+		{"oss", result.OSSImage, true},
+		{"prime", result.PrimeImage, checkPrime},
+	} {
+		switch {
+		case !r.check:
+			continue
+		case !r.image.Exists:
+			failures = append(failures, "image not found in "+r.name+" registry")
+		case platform.OS != "windows" && !r.image.Platforms[platform]:
+			failures = append(failures, platform.String()+" not found in "+r.name+" registry")
+		}
+	}
+
+	if result.DigestMismatch {
+		mismatched := result.MismatchedPlatforms()
+		switch {
+		case len(mismatched) == 0:
+			failures = append(failures, "index digest differs between oss and prime registries")
+		case slices.ContainsFunc(mismatched, func(p reg.Platform) bool {
+			return p.OS == platform.OS && p.Architecture == platform.Architecture
+		}):
+			failures = append(failures, platform.String()+" digest differs between oss and prime registries")
+		}
+	}
+
+	if verificationStatus(result.OSSVerification.Signature, result.PrimeVerification.Signature) == "✗" {
+		failures = append(failures, "signature verification failed")
+	}
+	if verificationStatus(result.OSSVerification.Provenance, result.PrimeVerification.Provenance) == "✗" {
+		failures = append(failures, "provenance verification failed")
+	}
+
+	return failures
+}
+
+// csvStatus converts a table status symbol to its CSV value
+func csvStatus(status string) string {
+	switch status {
+	case "✓":
+		return "Y"
+	case "✗":
+		return "N"
+	default:
+		return ""
+	}
+}
+
+// inspectVerifier returns the signature verifier for the sigstore config,
+// or nil if signatures shouldn't be verified.
+func inspectVerifier(c *config.Sigstore) (*reg.Verifier, error) {
+	if c == nil {
+		return nil, nil
+	}
+
+	var verifier *reg.Verifier
+	switch {
+	case c.PublicKeyPath != "":
+		key, err := os.ReadFile(c.PublicKeyPath)
+		if err != nil {
+			return nil, err
+		}
+		verifier, err = reg.NewKeyVerifier(key)
+		if err != nil {
+			return nil, err
+		}
+	case c.CertificateIdentity != "":
+		trustedRoot, err := os.ReadFile(c.TrustedRootPath)
+		if err != nil {
+			return nil, errors.New("failed to read trusted root: " + err.Error())
+		}
+		verifier, err = reg.NewKeylessVerifier(trustedRoot, c.CertificateIdentity, c.CertificateOIDCIssuer)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, nil
+	}
+
+	if c.VerifySLSAProvenance {
+		verifier.WithProvenance()
+	}
+
+	return verifier, nil
+}
+
+// newRegistryClient returns a client for the registry authenticated with
+// the credentials configured for it, or the docker config.json otherwise.
+func newRegistryClient(registry string, opts ...reg.Option) *reg.Client {
+	auth := rootConfig.Registries[registry]
+
+	var opt reg.Option
+	switch {
+	case auth.Username != "":
+		opt = reg.WithBasicAuth(auth.Username, auth.Password)
+	case auth.CredentialHelper != "":
+		opt = reg.WithCredentialHelper(auth.CredentialHelper)
+	default:
+		opt = reg.WithDockerConfig()
+	}
+
+	return reg.NewClient(registry, debug, append(opts, opt)...)
+}
+
+// releaseRepository returns the GitHub repository the version is released from
+func releaseRepository(version string) (string, string) {
+	switch {
+	case strings.Contains(version, "+rke2"):
+		return "rancher", "rke2"
+	case strings.Contains(version, "+k3s"):
+		return "k3s-io", "k3s"
+	default:
+		return "rancher", "rancher"
+	}
+}
+
+// inspectAssetsFS returns the filesystem the release assets are read from,
+// a local directory or tarball, an HTTP mirror or the GitHub release itself.
+func inspectAssetsFS(ctx context.Context, version string) (fs.FS, error) {
+	switch {
+	case inspectAssetsDir != "":
+		if strings.HasSuffix(inspectAssetsDir, ".tar.gz") || strings.HasSuffix(inspectAssetsDir, ".tgz") {
+			return release.NewTarballFS(inspectAssetsDir)
+		}
+		return release.NewDirFS(inspectAssetsDir)
+	case inspectAssetsURL != "":
+		return release.NewHTTPFS(ctx, nil, inspectAssetsURL)
+	default:
+		gh := repository.NewGithub(ctx, rootConfig.Auth.GithubToken)
+		owner, repo := releaseRepository(version)
+		filesystem, err := release.NewFS(ctx, gh, owner, repo, version)
+		if err != nil {
+			return nil, err
+		}
+		if inspectCacheDir != "" {
+			filesystem.WithCache(inspectCacheDir)
+		}
+		return filesystem, nil
 	}
 }
 
@@ -156,37 +476,57 @@ var inspectCmd = &cobra.Command{
 	Use:   "inspect [version]",
 	Short: "Inspect release artifacts",
 	Long: `Inspect release artifacts for a given version.
-Currently supports inspecting the image list for published rke2 releases.`,
+Checks that the images listed in a K3s, RKE2 or Rancher release exist in the
+oss and prime registries for every platform they are expected on.
+
+Assets are read from the GitHub release by default. Use --assets-dir to read
+them from a local directory or .tar.gz bundle, or --assets-url to read them
+from an HTTP mirror, e.g. https://prime.ribs.rancher.io/rke2/v1.30.1+rke2r1`,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		if len(args) < 1 {
 			return errors.New("expected at least one argument: [version]")
 		}
 
+		outputFormat, _ := cmd.Flags().GetString("output")
+		if !slices.Contains(inspectOutputFormats, outputFormat) {
+			return errors.New("invalid output format: " + outputFormat)
+		}
+
 		ctx := context.Background()
-		gh := repository.NewGithub(ctx, rootConfig.Auth.GithubToken)
-		filesystem, err := release.NewFS(ctx, gh, "rancher", "rke2", args[0])
+		filesystem, err := inspectAssetsFS(ctx, args[0])
 		if err != nil {
 			return err
 		}
 
-		ossClient := reg.NewClient(ossRegistry, debug)
+		ossClient := newRegistryClient(ossRegistry)
 
-		var primeClient *reg.Client
+		// a nil *reg.Client would make a non nil interface
+		var primeClient rke2.RegistryClient
 		if rootConfig.PrimeRegistry != "" {
-			primeClient = reg.NewClient(rootConfig.PrimeRegistry, debug)
+			primeClient = newRegistryClient(rootConfig.PrimeRegistry)
 		}
 
-		inspector := rke2.NewReleaseInspector(filesystem, ossClient, primeClient, debug)
+		verifier, err := inspectVerifier(rootConfig.Sigstore)
+		if err != nil {
+			return err
+		}
+
+		inspector := rke2.NewReleaseInspector(filesystem, ossClient, primeClient, debug).WithVerifier(verifier)
 
 		results, err := inspector.InspectRelease(ctx, args[0])
 		if err != nil {
 			return err
 		}
 
-		outputFormat, _ := cmd.Flags().GetString("output")
 		switch outputFormat {
 		case "csv":
-			csv(os.Stdout, results)
+			return csvOutput(os.Stdout, results)
+		case "json":
+			return jsonOutput(os.Stdout, results)
+		case "yaml":
+			return yamlOutput(os.Stdout, results)
+		case "junit":
+			return junitOutput(os.Stdout, args[0], results, primeClient != nil)
 		default:
 			table(os.Stdout, results)
 		}
@@ -197,5 +537,19 @@ Currently supports inspecting the image list for published rke2 releases.`,
 
 func init() {
 	rootCmd.AddCommand(inspectCmd)
-	inspectCmd.Flags().StringP("output", "o", "table", "Output format (table|csv)")
+	inspectCmd.Flags().StringP("output", "o", "table", "Output format ("+strings.Join(inspectOutputFormats, "|")+")")
+	inspectCmd.Flags().StringVar(&inspectAssetsDir, "assets-dir", "", "Read assets from a local directory or .tar.gz bundle instead of GitHub")
+	inspectCmd.Flags().StringVar(&inspectAssetsURL, "assets-url", "", "Read assets from an HTTP base URL instead of GitHub")
+	inspectCmd.Flags().StringVar(&inspectCacheDir, "cache-dir", defaultAssetsCacheDir(), "Directory GitHub release assets are cached in (empty disables the cache)")
+	inspectCmd.MarkFlagsMutuallyExclusive("assets-dir", "assets-url")
+}
+
+// defaultAssetsCacheDir returns the directory release assets are cached in
+// when --cache-dir isn't set, or an empty string if there is no user cache dir.
+func defaultAssetsCacheDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "ecm-distro-tools", "release-assets")
 }
@@ -3,8 +3,11 @@ package cmd
 import (
 	"bytes"
 	"context"
+	"encoding/json"
+	"encoding/xml"
 	"io/fs"
 	"os"
+	"strings"
 	"testing"
 	"testing/fstest"
 
@@ -14,7 +17,8 @@ import (
 )
 
 type mockRegistryClient struct {
-	images map[string]reg.Image
+	images        map[string]reg.Image
+	verifications map[string]reg.Verification
 }
 
 func (m *mockRegistryClient) Image(_ context.Context, ref name.Reference) (reg.Image, error) {
@@ -25,6 +29,10 @@ func (m *mockRegistryClient) Image(_ context.Context, ref name.Reference) (reg.I
 	return reg.Image{Exists: false, Platforms: make(map[reg.Platform]bool)}, nil
 }
 
+func (m *mockRegistryClient) Verify(_ context.Context, ref name.Reference, _ *reg.Verifier) (reg.Verification, error) {
+	return m.verifications[ref.Context().RepositoryStr()+":"+ref.Identifier()], nil
+}
+
 func newMockFS() fs.FS {
 	return fstest.MapFS{
 		"rke2-images-all.linux-amd64.txt": &fstest.MapFile{
@@ -39,7 +47,9 @@ func newMockFS() fs.FS {
 	}
 }
 
-func TestInspectAndCSVOutput(t *testing.T) {
+func inspectMockRelease(t *testing.T) []rke2.Image {
+	t.Helper()
+
 	ossImages := map[string]reg.Image{
 		"rancher/rke2-runtime:v1.23.4-rke2r1": {
 			Exists: true,
@@ -47,6 +57,11 @@ func TestInspectAndCSVOutput(t *testing.T) {
 				{OS: "linux", Architecture: "amd64"}: true,
 				{OS: "linux", Architecture: "arm64"}: true,
 			},
+			Digest: "sha256:0a",
+			PlatformDigests: map[reg.Platform]string{
+				{OS: "linux", Architecture: "amd64"}: "sha256:1a",
+				{OS: "linux", Architecture: "arm64"}: "sha256:2a",
+			},
 		},
 		"rancher/rke2-cloud-provider:v1.23.4-rke2r1": {
 			Exists: true,
@@ -63,6 +78,11 @@ func TestInspectAndCSVOutput(t *testing.T) {
 				{OS: "linux", Architecture: "amd64"}: true,
 				{OS: "linux", Architecture: "arm64"}: true,
 			},
+			Digest: "sha256:0b",
+			PlatformDigests: map[reg.Platform]string{
+				{OS: "linux", Architecture: "amd64"}: "sha256:1a",
+				{OS: "linux", Architecture: "arm64"}: "sha256:2b",
+			},
 		},
 		"rancher/rke2-cloud-provider:v1.23.4-rke2r1": {
 			Exists: false,
@@ -72,20 +92,46 @@ func TestInspectAndCSVOutput(t *testing.T) {
 		},
 	}
 
+	ossVerifications := map[string]reg.Verification{
+		"rancher/rke2-runtime:v1.23.4-rke2r1": {
+			Signature:  reg.VerificationPassed,
+			Provenance: reg.VerificationPassed,
+		},
+		"rancher/rke2-cloud-provider:v1.23.4-rke2r1": {
+			Signature:  reg.VerificationPassed,
+			Provenance: reg.VerificationMissing,
+		},
+	}
+
+	primeVerifications := map[string]reg.Verification{
+		"rancher/rke2-runtime:v1.23.4-rke2r1": {
+			Signature:  reg.VerificationPassed,
+			Provenance: reg.VerificationPassed,
+		},
+	}
+
 	inspector := rke2.NewReleaseInspector(
 		newMockFS(),
-		&mockRegistryClient{images: ossImages},
-		&mockRegistryClient{images: primeImages},
+		&mockRegistryClient{images: ossImages, verifications: ossVerifications},
+		&mockRegistryClient{images: primeImages, verifications: primeVerifications},
 		false,
-	)
+	).WithVerifier(&reg.Verifier{})
 
 	results, err := inspector.InspectRelease(context.Background(), "v1.23.4+rke2r1")
 	if err != nil {
 		t.Fatalf("InspectRelease() error = %v", err)
 	}
 
+	return results
+}
+
+func TestInspectAndCSVOutput(t *testing.T) {
+	results := inspectMockRelease(t)
+
 	var buf bytes.Buffer
-	csv(&buf, results)
+	if err := csvOutput(&buf, results); err != nil {
+		t.Fatalf("csvOutput() error = %v", err)
+	}
 
 	expectedBytes, err := os.ReadFile("testdata/inspect_test_output.csv")
 	if err != nil {
@@ -97,6 +143,99 @@ func TestInspectAndCSVOutput(t *testing.T) {
 	}
 }
 
+func TestJSONOutput(t *testing.T) {
+	var buf bytes.Buffer
+	if err := jsonOutput(&buf, inspectMockRelease(t)); err != nil {
+		t.Fatalf("jsonOutput() error = %v", err)
+	}
+
+	var images []struct {
+		Reference         string           `json:"reference"`
+		ExpectsLinuxArm64 bool             `json:"expects_linux_arm64"`
+		OSSImage          reg.Image        `json:"oss_image"`
+		PrimeVerification reg.Verification `json:"prime_verification"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &images); err != nil {
+		t.Fatalf("failed to decode output: %v", err)
+	}
+
+	if len(images) != 3 {
+		t.Fatalf("jsonOutput() returned %d images, want 3", len(images))
+	}
+	runtime := images[2]
+	if runtime.Reference != "rancher/rke2-runtime:v1.23.4-rke2r1" || !runtime.ExpectsLinuxArm64 {
+		t.Errorf("unexpected image %+v", runtime)
+	}
+	if !strings.Contains(buf.String(), `"linux/arm64": true`) {
+		t.Errorf("expected platforms to be keyed by os/arch, got %s", buf.String())
+	}
+	if runtime.PrimeVerification != (reg.Verification{Signature: reg.VerificationPassed, Provenance: reg.VerificationPassed}) {
+		t.Errorf("prime_verification = %+v", runtime.PrimeVerification)
+	}
+}
+
+func TestJUnitOutput(t *testing.T) {
+	var buf bytes.Buffer
+	if err := junitOutput(&buf, "v1.23.4+rke2r1", inspectMockRelease(t), true); err != nil {
+		t.Fatalf("junitOutput() error = %v", err)
+	}
+
+	var report junitTestSuites
+	if err := xml.Unmarshal(buf.Bytes(), &report); err != nil {
+		t.Fatalf("failed to decode output: %v", err)
+	}
+
+	suite := report.Suites[0]
+	if suite.Tests != 4 || suite.Failures != 3 {
+		t.Errorf("got %d tests and %d failures, want 4 tests and 3 failures", suite.Tests, suite.Failures)
+	}
+
+	failures := make(map[string]string)
+	for _, c := range suite.Cases {
+		if c.Failure != nil {
+			failures[c.Classname+" "+c.Name] = c.Failure.Text
+		}
+	}
+	want := map[string]string{
+		"rancher/rke2-cloud-provider:v1.23.4-rke2r1 linux/amd64":    "image not found in prime registry\nprovenance verification failed",
+		"rancher/rke2-runtime-windows:v1.23.4-rke2r1 windows/amd64": "image not found in oss registry\nimage not found in prime registry",
+		"rancher/rke2-runtime:v1.23.4-rke2r1 linux/arm64":           "linux/arm64 digest differs between oss and prime registries",
+	}
+	for k, v := range want {
+		if failures[k] != v {
+			t.Errorf("failure for %s = %q, want %q", k, failures[k], v)
+		}
+	}
+}
+
+func TestJUnitOutputWithoutPrime(t *testing.T) {
+	results := inspectMockRelease(t)
+	for i := range results {
+		results[i].PrimeImage = reg.Image{}
+		results[i].PrimeVerification = reg.Verification{}
+		results[i].DigestMismatch = false
+	}
+
+	var buf bytes.Buffer
+	if err := junitOutput(&buf, "v1.23.4+rke2r1", results, false); err != nil {
+		t.Fatalf("junitOutput() error = %v", err)
+	}
+
+	var report junitTestSuites
+	if err := xml.Unmarshal(buf.Bytes(), &report); err != nil {
+		t.Fatalf("failed to decode output: %v", err)
+	}
+
+	for _, c := range report.Suites[0].Cases {
+		if c.Failure != nil && strings.Contains(c.Failure.Text, "prime registry") {
+			t.Errorf("failure for %s %s = %q, want no prime registry failures", c.Classname, c.Name, c.Failure.Text)
+		}
+	}
+	if report.Suites[0].Failures != 2 {
+		t.Errorf("got %d failures, want 2", report.Suites[0].Failures)
+	}
+}
+
 func mustParseRef(s string) name.Reference {
 	ref, err := name.ParseReference(s)
 	if err != nil {
@@ -0,0 +1,61 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/rancher/ecm-distro-tools/release/k3s"
+	"github.com/rancher/ecm-distro-tools/repository"
+	"github.com/spf13/cobra"
+)
+
+var (
+	k3sRunFrom  string
+	k3sRunForce bool
+)
+
+var k3sCmd = &cobra.Command{
+	Use:   "k3s",
+	Short: "Run k3s releases",
+}
+
+var k3sRunSubCmd = &cobra.Command{
+	Use:   "run [version]",
+	Short: "Run a k3s release, resuming from the last completed step",
+	Long: `Run the steps of a k3s release: ` + strings.Join(k3s.RunSteps, ", ") + `.
+The steps which completed and their outputs are saved in a state file in the
+workspace, and a run resumes after the last completed step. Steps which push
+to remote repositories aren't run again unless --force is set.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) < 1 {
+			return errors.New("expected at least one argument: [version]")
+		}
+
+		version := args[0]
+		k3sRelease, found := rootConfig.K3s.Versions[version]
+		if !found {
+			return NewVersionNotFoundError(version, "k3s")
+		}
+
+		ctx := context.Background()
+		ghClient := repository.NewGithub(ctx, rootConfig.Auth.GithubToken)
+
+		opts := k3s.RunOpts{From: k3sRunFrom, Force: k3sRunForce}
+		state, err := k3s.Run(ctx, ghClient, &k3sRelease, rootConfig.User, rootConfig.Auth.SSHKeyPath, version, &opts)
+		if state != nil {
+			fmt.Print(state.String())
+		}
+
+		return err
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(k3sCmd)
+	k3sCmd.AddCommand(k3sRunSubCmd)
+
+	k3sRunSubCmd.Flags().StringVar(&k3sRunFrom, "from", "", "step to run again from: "+strings.Join(k3s.RunSteps, ", "))
+	k3sRunSubCmd.Flags().BoolVar(&k3sRunForce, "force", false, "run completed steps which push to remote repositories again")
+}
@@ -2,15 +2,25 @@ package cmd
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"os"
+	"strconv"
 
+	"github.com/rancher/ecm-distro-tools/cmd/release/config"
 	"github.com/rancher/ecm-distro-tools/release/charts"
 	"github.com/rancher/ecm-distro-tools/release/rancher"
+	"github.com/rancher/ecm-distro-tools/repository"
 	"github.com/spf13/cobra"
 )
 
+var (
+	rancherRCDepsOutput string
+	rancherRCDepsPath   string
+	rancherRCDepsFailOn string
+)
+
 // listCmd represents the list command
 var listCmd = &cobra.Command{
 	Use:   "list",
@@ -25,21 +35,73 @@ var rancherListSubCmd = &cobra.Command{
 var rancherListRCDepsSubCmd = &cobra.Command{
 	Use:   "rc-deps [git-ref]",
 	Short: "List Rancher RC Deps",
+	Long: `List the RC and dev dependencies of Rancher at a git ref.
+The rules are read from rancher.rc_deps_rules in the config, or the default
+rules are used. Use --fail-on blocking to exit with an error if any blocking
+finding is found, e.g. to gate GA tags in CI.
+
+Use --path to check a local checkout instead of a git ref on GitHub, e.g. to
+verify a release commit before pushing it.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		if len(args) < 1 {
+		if len(args) < 1 && rancherRCDepsPath == "" {
 			return errors.New("expected at least one argument: [git-ref]")
 		}
+		if len(args) > 0 && rancherRCDepsPath != "" {
+			return errors.New("a git ref can't be checked with --path, which checks a local checkout")
+		}
 
-		rancherRCDeps, err := rancher.CheckRancherRCDeps(context.Background(), "rancher", args[0])
-		if err != nil {
-			return err
+		if rancherRCDepsFailOn != "" && rancherRCDepsFailOn != rancher.SeverityBlocking && rancherRCDepsFailOn != rancher.SeverityWarning {
+			return errors.New("invalid --fail-on severity: " + rancherRCDepsFailOn)
 		}
 
-		deps, err := rancherRCDeps.ToString()
+		var rules []config.RCDepsRule
+		if rootConfig.Rancher != nil {
+			rules = rootConfig.Rancher.RCDepsRules
+		}
+
+		var report *rancher.RCDepsReport
+		var err error
+		if rancherRCDepsPath != "" {
+			report, err = rancher.CheckRancherRCDepsFS(os.DirFS(rancherRCDepsPath), rancherRCDepsPath, rules)
+		} else {
+			ctx := context.Background()
+			var token string
+			if rootConfig.Auth != nil {
+				token = rootConfig.Auth.GithubToken
+			}
+			report, err = rancher.CheckRancherRCDeps(ctx, repository.NewGithub(ctx, token), "rancher", args[0], rules)
+		}
 		if err != nil {
 			return err
 		}
-		fmt.Println(deps)
+
+		switch rancherRCDepsOutput {
+		case "json":
+			b, err := json.MarshalIndent(report, "", "  ")
+			if err != nil {
+				return err
+			}
+			fmt.Println(string(b))
+		case "text":
+			deps, err := report.ToString()
+			if err != nil {
+				return err
+			}
+			fmt.Println(deps)
+		default:
+			return errors.New("invalid output format: " + rancherRCDepsOutput)
+		}
+
+		switch rancherRCDepsFailOn {
+		case rancher.SeverityBlocking:
+			if blocking := report.Blocking(); blocking != 0 {
+				return errors.New("found " + strconv.Itoa(blocking) + " blocking rc dependencies")
+			}
+		case rancher.SeverityWarning:
+			if len(report.Findings) != 0 {
+				return errors.New("found " + strconv.Itoa(len(report.Findings)) + " rc dependencies")
+			}
+		}
 
 		return nil
 	},
@@ -90,6 +152,9 @@ var chartsListSubCmd = &cobra.Command{
 
 func init() {
 	rancherListSubCmd.AddCommand(rancherListRCDepsSubCmd)
+	rancherListRCDepsSubCmd.Flags().StringVarP(&rancherRCDepsOutput, "output", "o", "text", "Output format (text|json)")
+	rancherListRCDepsSubCmd.Flags().StringVar(&rancherRCDepsPath, "path", "", "Check a local checkout of the rancher repository instead of a git ref")
+	rancherListRCDepsSubCmd.Flags().StringVar(&rancherRCDepsFailOn, "fail-on", "", "Exit with an error if there are findings of this severity or higher (blocking|warning)")
 	listCmd.AddCommand(rancherListSubCmd)
 	listCmd.AddCommand(chartsListSubCmd)
 	rootCmd.AddCommand(listCmd)
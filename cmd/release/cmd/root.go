@@ -6,6 +6,7 @@ import (
 	"strings"
 
 	"github.com/rancher/ecm-distro-tools/cmd/release/config"
+	"github.com/rancher/ecm-distro-tools/release"
 	"github.com/spf13/cobra"
 )
 
@@ -72,5 +73,10 @@ func initConfig() {
 		}
 	}
 
+	if err := release.LoadReleaseNoteTemplates(conf.ReleaseNotes); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
 	rootConfig = conf
 }
@@ -7,6 +7,7 @@ import (
 	"os"
 
 	"github.com/rancher/ecm-distro-tools/release/imagebuild"
+	"github.com/rancher/ecm-distro-tools/release/rancher"
 	"github.com/rancher/ecm-distro-tools/repository"
 	"github.com/spf13/cobra"
 )
@@ -17,6 +18,11 @@ var (
 	upstreamRepo      string
 	upstreamTagPrefix string
 	commitish         string
+
+	syncImages                 []string
+	syncSourceRegistry         string
+	syncTargetRegistry         string
+	syncImagesConcurrencyLimit int
 )
 
 var syncCmd = &cobra.Command{
@@ -56,11 +62,52 @@ var syncRepublishLatestReleaseCmd = &cobra.Command{
 	},
 }
 
+var syncImagesCmd = &cobra.Command{
+	Use:   "images",
+	Short: "Copy images from a source registry to a target registry",
+	Long: `Copy images from a source registry to a target registry, keeping multi-arch indexes intact.
+Images that already have the same digest in the target registry are skipped. With --dry-run
+only the copy plan is printed.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx := context.Background()
+
+		copies, err := rancher.SyncImages(ctx, newRegistryClient(syncSourceRegistry), newRegistryClient(syncTargetRegistry), syncImagesConcurrencyLimit, syncImages, dryRun)
+		if err != nil {
+			return err
+		}
+
+		var copied, skipped int
+		for _, c := range copies {
+			action := "copy"
+			switch {
+			case c.Skipped:
+				action = "skip"
+				skipped++
+			case dryRun:
+				action = "plan"
+				copied++
+			default:
+				copied++
+			}
+			fmt.Printf("%s %s/%s -> %s/%s %s\n", action, syncSourceRegistry, c.Image, syncTargetRegistry, c.Image, c.Digest)
+		}
+
+		if dryRun {
+			fmt.Printf("dry run: %d images would be copied, %d already up to date\n", copied, skipped)
+			return nil
+		}
+		fmt.Printf("%d images copied, %d already up to date\n", copied, skipped)
+
+		return nil
+	},
+}
+
 func init() {
 	rootCmd.AddCommand(syncCmd)
 
 	syncCmd.AddCommand(syncImageBuildCmd)
 	syncCmd.AddCommand(syncRepublishLatestReleaseCmd)
+	syncCmd.AddCommand(syncImagesCmd)
 
 	syncImageBuildCmd.Flags().StringVar(&upstreamTagPrefix, "tag-prefix", "", "Upstream tag Prefix")
 	syncImageBuildCmd.Flags().StringVar(&upstreamRepo, "upstream-repo", "", "Upstream repository name")
@@ -100,4 +147,21 @@ func init() {
 		fmt.Println(err.Error())
 		os.Exit(1)
 	}
+
+	syncImagesCmd.Flags().StringSliceVarP(&syncImages, "images", "k", make([]string, 0), "List of images to sync to a registry")
+	syncImagesCmd.Flags().StringVarP(&syncSourceRegistry, "source-registry", "s", "", "Source registry, where the images are located")
+	syncImagesCmd.Flags().StringVarP(&syncTargetRegistry, "target-registry", "t", "", "Target registry, where the images should be synced to")
+	syncImagesCmd.Flags().IntVarP(&syncImagesConcurrencyLimit, "concurrency-limit", "l", defaultConcurrencyLimit, "Concurrency Limit")
+	if err := syncImagesCmd.MarkFlagRequired("images"); err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
+	if err := syncImagesCmd.MarkFlagRequired("source-registry"); err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
+	if err := syncImagesCmd.MarkFlagRequired("target-registry"); err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
 }
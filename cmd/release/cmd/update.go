@@ -27,6 +27,8 @@ var updateK3sCmd = &cobra.Command{
 	Short: "Update k3s files",
 }
 
+var k3sReferencesReview bool
+
 var updateK3sReferencesCmd = &cobra.Command{
 	Use:   "references [version]",
 	Short: "Update k8s and Go references in a k3s repo and create a PR",
@@ -46,7 +48,7 @@ var updateK3sReferencesCmd = &cobra.Command{
 
 		ghClient := repository.NewGithub(ctx, rootConfig.Auth.GithubToken)
 
-		return k3s.UpdateK3sReferences(ctx, ghClient, &k3sRelease, rootConfig.User)
+		return k3s.UpdateK3sReferences(ctx, ghClient, &k3sRelease, rootConfig.User, k3sReferencesReview)
 	},
 }
 
@@ -333,6 +335,7 @@ func init() {
 	updateCmd.AddCommand(updateChartsCmd)
 	updateCmd.AddCommand(updateK3sCmd)
 	updateK3sCmd.AddCommand(updateK3sReferencesCmd)
+	updateK3sReferencesCmd.Flags().BoolVar(&k3sReferencesReview, "review", false, "ask before committing the changes")
 	updateCmd.AddCommand(updateRancherCmd)
 	updateRancherCmd.AddCommand(updateRancherDashboardCmd)
 	updateRancherCmd.AddCommand(updateRancherCLICmd)
@@ -0,0 +1,47 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/rancher/ecm-distro-tools/release/k3s"
+	"github.com/rancher/ecm-distro-tools/repository"
+	"github.com/spf13/cobra"
+)
+
+var validateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Validate release configs",
+}
+
+var k3sValidateSubCmd = &cobra.Command{
+	Use:   "k3s [version]",
+	Short: "Validate the config of a k3s release before running it",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) < 1 {
+			return errors.New("expected at least one argument: [version]")
+		}
+
+		version := args[0]
+		k3sRelease, found := rootConfig.K3s.Versions[version]
+		if !found {
+			return NewVersionNotFoundError(version, "k3s")
+		}
+
+		ctx := context.Background()
+		ghClient := repository.NewGithub(ctx, rootConfig.Auth.GithubToken)
+
+		if err := k3s.ValidateRelease(ctx, ghClient, &k3sRelease, rootConfig.Auth.SSHKeyPath); err != nil {
+			return errors.New("invalid config of k3s " + version + ":\n" + err.Error())
+		}
+
+		fmt.Println("config of k3s " + version + " is valid")
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(validateCmd)
+	validateCmd.AddCommand(k3sValidateSubCmd)
+}
@@ -1,31 +1,78 @@
 package cmd
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"os"
+	"time"
 
+	"github.com/rancher/ecm-distro-tools/release/rke2"
+	"github.com/rancher/ecm-distro-tools/release/watch"
+	"github.com/rancher/ecm-distro-tools/repository"
 	"github.com/spf13/cobra"
 )
 
+var (
+	watchInterval time.Duration
+	watchDeadline time.Duration
+)
+
 // watchCmd represents the watch command
 var watchCmd = &cobra.Command{
-	Use:   "watch",
-	Short: "",
-	Long:  ``,
-	Run: func(cmd *cobra.Command, args []string) {
-		fmt.Println("watch called")
+	Use:   "watch [version]",
+	Short: "Watch the progress of a release",
+	Long: `Poll the tag, GitHub release, assets and images of a K3s, RKE2 or Rancher release
+and print every state transition. Exits with an error if the deadline passes
+while checks are still failing.`,
+	Example: "release watch v1.29.2+rke2r1 --interval 2m --deadline 3h",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) < 1 {
+			return errors.New("expected at least one argument: [version]")
+		}
+		version := args[0]
+		if watchInterval <= 0 {
+			return errors.New("interval must be greater than 0")
+		}
+
+		ctx := context.Background()
+		if watchDeadline > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, watchDeadline)
+			defer cancel()
+		}
+
+		client := repository.NewGithub(ctx, rootConfig.Auth.GithubToken)
+
+		owner, repo := releaseRepository(version)
+
+		checks := []watch.Check{
+			watch.TagCheck(client, owner, repo, version),
+			watch.ReleaseCheck(client, owner, repo, version),
+		}
+
+		if repo != "rancher" {
+			checks = append(checks, watch.AssetsCheck(client, owner, repo, version))
+		}
+
+		ossClient := newRegistryClient(ossRegistry)
+
+		var primeClient rke2.RegistryClient
+		if rootConfig.PrimeRegistry != "" {
+			primeClient = newRegistryClient(rootConfig.PrimeRegistry)
+		}
+
+		checks = append(checks, watch.ImagesCheck(client, owner, repo, version, ossClient, primeClient, debug))
+
+		fmt.Println("watching " + owner + "/" + repo + " " + version)
+
+		return watch.NewWatcher(os.Stdout, watchInterval, checks...).Run(ctx)
 	},
 }
 
 func init() {
 	rootCmd.AddCommand(watchCmd)
 
-	// Here you will define your flags and configuration settings.
-
-	// Cobra supports Persistent Flags which will work for this command
-	// and all subcommands, e.g.:
-	// watchCmd.PersistentFlags().String("foo", "", "A help for foo")
-
-	// Cobra supports local flags which will only run when this command
-	// is called directly, e.g.:
-	// watchCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
+	watchCmd.Flags().DurationVarP(&watchInterval, "interval", "i", 5*time.Minute, "Time between checks")
+	watchCmd.Flags().DurationVarP(&watchDeadline, "deadline", "d", 0, "Fail if checks are still failing after this long (0 waits forever)")
 }
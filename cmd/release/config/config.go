@@ -65,6 +65,14 @@ const (
 	RancherChartsRepositoryGitURI = "git@github.com/rancher/charts.git"
 )
 
+const (
+	// K3sBackendDocker runs the tag script of k3s releases in a golang image
+	K3sBackendDocker = "docker"
+	// K3sBackendLocal runs the tag script of k3s releases with the local Go
+	// toolchain, for machines without a Docker daemon, e.g. CI runners
+	K3sBackendLocal = "local"
+)
+
 const (
 	SuseStageRegistry    = "stgregistry.suse.com"
 	PrimeArtifactsBucket = "prime-artifacts"
@@ -86,6 +94,7 @@ type K3sRelease struct {
 	K8sRancherURL                 string `json:"k8s_rancher_url"`
 	K3sUpstreamURL                string `json:"k3s_upstream_url"`
 	DryRun                        bool   `json:"dry_run"`
+	Backend                       string `json:"backend,omitempty"`
 }
 
 // RancherRelease
@@ -130,6 +139,28 @@ type K3s struct {
 // Rancher
 type Rancher struct {
 	Versions map[string]RancherRelease `json:"versions"`
+	// RCDepsRules replace the default rules of list rancher rc-deps
+	RCDepsRules []RCDepsRule `json:"rc_deps_rules,omitempty"`
+}
+
+// RCDepsRule is a rule rc-deps evaluates against every line of the files
+// matching one of its globs. Lines matching the pattern are findings, unless
+// they also match one of the exceptions. Severity is either blocking or warning.
+type RCDepsRule struct {
+	Name       string   `json:"name"`
+	Files      []string `json:"files"`
+	Pattern    string   `json:"pattern"`
+	Severity   string   `json:"severity"`
+	Exceptions []string `json:"exceptions,omitempty"`
+}
+
+// ReleaseNotes configures the release notes of a repository. The template is
+// read from TemplatePath, or is Template if no path is set. Repositories
+// without a template use the default one, which only has the changelog.
+type ReleaseNotes struct {
+	Owner        string `json:"owner"`
+	TemplatePath string `json:"template_path,omitempty"`
+	Template     string `json:"template,omitempty"`
 }
 
 // Dashboard
@@ -151,26 +182,47 @@ type Auth struct {
 	AWSDefaultRegion   string `json:"aws_default_region"`
 }
 
+// RegistryAuth holds the credentials for a container registry. If neither
+// username nor credential helper are set, the docker config.json is used.
+type RegistryAuth struct {
+	Username         string `json:"username"`
+	Password         string `json:"password"`
+	CredentialHelper string `json:"credential_helper"`
+}
+
+// Sigstore configures the verification of image signatures, either with a
+// public key or with the keyless identity the images are signed by
+type Sigstore struct {
+	PublicKeyPath         string `json:"public_key_path"`
+	TrustedRootPath       string `json:"trusted_root_path"`
+	CertificateIdentity   string `json:"certificate_identity"`
+	CertificateOIDCIssuer string `json:"certificate_oidc_issuer"`
+	VerifySLSAProvenance  bool   `json:"verify_slsa_provenance"`
+}
+
 // Config
 type Config struct {
-	User                       *User          `json:"user"`
-	K3s                        *K3s           `json:"k3s"`
-	Rancher                    *Rancher       `json:"rancher"`
-	RKE2                       *RKE2          `json:"rke2"`
-	Charts                     *ChartsRelease `json:"charts"`
-	Auth                       *Auth          `json:"auth"`
-	Dashboard                  *Dashboard     `json:"dashboard"`
-	CLI                        *CLI           `json:"cli"`
-	PrimeRegistry              string         `json:"prime_registry"`
-	RancherGithubOrganization  string         `json:"rancher_github_organization"`
-	RancherRepositoryName      string         `json:"rancher_repository_name"`
-	RancherPrimeRepositoryName string         `json:"rancher_repository_name"`
-	RancherRepositoryGitURI    string         `json:"rancher_repository_git_uri"`
-	RancherRepositoryURL       string         `json:"rancher_repository_url"`
-	UIRepositoryName           string         `json:"ui_repository_name"`
-	DashboardRepositoryName    string         `json:"dashboard_repository_name"`
-	CLIRepositoryName          string         `json:"cli_repository_name"`
-	CLIRepositoryGitURI        string         `json:"cli_repository_git_uri"`
+	User                       *User                   `json:"user"`
+	K3s                        *K3s                    `json:"k3s"`
+	Rancher                    *Rancher                `json:"rancher"`
+	RKE2                       *RKE2                   `json:"rke2"`
+	Charts                     *ChartsRelease          `json:"charts"`
+	Auth                       *Auth                   `json:"auth"`
+	Sigstore                   *Sigstore               `json:"sigstore,omitempty"`
+	Registries                 map[string]RegistryAuth `json:"registries,omitempty"`
+	Dashboard                  *Dashboard              `json:"dashboard"`
+	CLI                        *CLI                    `json:"cli"`
+	ReleaseNotes               map[string]ReleaseNotes `json:"release_notes,omitempty"`
+	PrimeRegistry              string                  `json:"prime_registry"`
+	RancherGithubOrganization  string                  `json:"rancher_github_organization"`
+	RancherRepositoryName      string                  `json:"rancher_repository_name"`
+	RancherPrimeRepositoryName string                  `json:"rancher_prime_repository_name"`
+	RancherRepositoryGitURI    string                  `json:"rancher_repository_git_uri"`
+	RancherRepositoryURL       string                  `json:"rancher_repository_url"`
+	UIRepositoryName           string                  `json:"ui_repository_name"`
+	DashboardRepositoryName    string                  `json:"dashboard_repository_name"`
+	CLIRepositoryName          string                  `json:"cli_repository_name"`
+	CLIRepositoryGitURI        string                  `json:"cli_repository_git_uri"`
 }
 
 // OpenOnEditor opens the given config file on the user's default text editor.
@@ -209,6 +261,12 @@ func Read(r io.Reader) (*Config, error) {
 		return nil, err
 	}
 
+	// configs written before rancher_prime_repository_name set the prime
+	// repository name with rancher_repository_name
+	if c.RancherPrimeRepositoryName == "" {
+		c.RancherPrimeRepositoryName = c.RancherRepositoryName
+	}
+
 	return &c, nil
 }
 
@@ -237,6 +295,7 @@ func ExampleConfig() (string, error) {
 					K3sRepoOwner:                  "k3s-io",
 					K8sRancherURL:                 "git@github.com:k3s-io/kubernetes.git",
 					K3sUpstreamURL:                "git@github.com:k3s-io/k3s.git",
+					Backend:                       K3sBackendDocker,
 				},
 			},
 		},
@@ -266,6 +325,11 @@ func ExampleConfig() (string, error) {
 				},
 			},
 		},
+		ReleaseNotes: map[string]ReleaseNotes{
+			"rke2-packaging": {
+				Owner: "rancher",
+			},
+		},
 		Charts: &ChartsRelease{
 			Workspace:     filepath.Join(gopath, "src", "github.com", "rancher", "charts") + "/",
 			ChartsRepoURL: "https://github.com/rancher/charts",
@@ -280,14 +344,15 @@ func ExampleConfig() (string, error) {
 			AWSSessionToken:    "xxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxx",
 			AWSDefaultRegion:   "us-east-1",
 		},
-		PrimeRegistry:             "example.com",
-		RancherGithubOrganization: RancherGithubOrganization,
-		RancherRepositoryName:     RancherRepositoryName,
-		RancherRepositoryGitURI:   RancherRepositoryGitURI,
-		RancherRepositoryURL:      RancherRepositoryURL,
-		UIRepositoryName:          UIRepositoryName,
-		DashboardRepositoryName:   DashboardRepositoryName,
-		CLIRepositoryName:         CLIRepositoryName,
+		PrimeRegistry:              "example.com",
+		RancherGithubOrganization:  RancherGithubOrganization,
+		RancherRepositoryName:      RancherRepositoryName,
+		RancherPrimeRepositoryName: RancherPrimeRepositoryName,
+		RancherRepositoryGitURI:    RancherRepositoryGitURI,
+		RancherRepositoryURL:       RancherRepositoryURL,
+		UIRepositoryName:           UIRepositoryName,
+		DashboardRepositoryName:    DashboardRepositoryName,
+		CLIRepositoryName:          CLIRepositoryName,
 	}
 	b, err := json.MarshalIndent(conf, "", "  ")
 	if err != nil {
@@ -329,6 +394,7 @@ K3s {{ range $k3sVersion, $k3sValue := .K3s.Versions }}
 		New Suffix:       {{ $k3sValue.NewSuffix}}
 		Release Branch:   {{ $k3sValue.ReleaseBranch}}
 		Dry Run:          {{ $k3sValue.DryRun}}
+		Backend:          {{ $k3sValue.Backend}}
 		K3s Repo Owner:   {{ $k3sValue.K3sRepoOwner}}
 		K8s Rancher URL:  {{ $k3sValue.K8sRancherURL}}
 		Workspace:        {{ $k3sValue.Workspace}}
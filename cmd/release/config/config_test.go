@@ -15,3 +15,26 @@ func TestRead(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestReadPrimeRepositoryName(t *testing.T) {
+	tests := []struct {
+		name string
+		conf string
+		want string
+	}{
+		{name: "prime key", conf: `{"rancher_repository_name": "rancher", "rancher_prime_repository_name": "rancher-prime"}`, want: "rancher-prime"},
+		{name: "old key", conf: `{"rancher_repository_name": "rancher-prime"}`, want: "rancher-prime"},
+		{name: "no key", conf: `{}`, want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := Read(strings.NewReader(tt.conf))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if c.RancherPrimeRepositoryName != tt.want {
+				t.Errorf("RancherPrimeRepositoryName = %q, want %q", c.RancherPrimeRepositoryName, tt.want)
+			}
+		})
+	}
+}
@@ -13,12 +13,21 @@ import (
 )
 
 func RunCommand(dir, cmd string, args ...string) (string, error) {
+	return RunCommandWithEnv(dir, nil, cmd, args...)
+}
+
+// RunCommandWithEnv runs the command like RunCommand, with the variables of
+// env, e.g. GOTOOLCHAIN=local, added to the environment
+func RunCommandWithEnv(dir string, env []string, cmd string, args ...string) (string, error) {
 	command := exec.Command(cmd, args...)
 
 	var outb, errb bytes.Buffer
 	command.Stdout = &outb
 	command.Stderr = &errb
 	command.Dir = dir
+	if len(env) > 0 {
+		command.Env = append(os.Environ(), env...)
+	}
 	if err := command.Run(); err != nil {
 		return "", errors.New(errb.String())
 	}
@@ -0,0 +1,60 @@
+package registry
+
+import (
+	"context"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+// Digest returns the digest of the image in the client registry, or an empty
+// string if the image doesn't exist. Only the manifest headers are requested.
+func (c *Client) Digest(ctx context.Context, ref name.Reference) (string, error) {
+	tagRef, err := replaceRegistry(c.registry, ref)
+	if err != nil {
+		return "", err
+	}
+
+	desc, err := remote.Head(tagRef, c.options(ctx)...)
+	if err != nil {
+		if isNotFound(err) {
+			return "", nil
+		}
+		return "", err
+	}
+
+	return desc.Digest.String(), nil
+}
+
+// Copy copies the image from the client registry to the target registry.
+// Multi-arch indexes are copied with every platform manifest, so the image
+// keeps the same digest in both registries.
+func (c *Client) Copy(ctx context.Context, ref name.Reference, target *Client) error {
+	srcRef, err := replaceRegistry(c.registry, ref)
+	if err != nil {
+		return err
+	}
+	dstRef, err := replaceRegistry(target.registry, ref)
+	if err != nil {
+		return err
+	}
+
+	desc, err := remote.Get(srcRef, c.options(ctx)...)
+	if err != nil {
+		return err
+	}
+
+	if desc.MediaType.IsIndex() {
+		idx, err := desc.ImageIndex()
+		if err != nil {
+			return err
+		}
+		return remote.WriteIndex(dstRef, idx, target.options(ctx)...)
+	}
+
+	img, err := desc.Image()
+	if err != nil {
+		return err
+	}
+	return remote.Write(dstRef, img, target.options(ctx)...)
+}
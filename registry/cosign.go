@@ -0,0 +1,386 @@
+package registry
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+	protobundle "github.com/sigstore/protobuf-specs/gen/pb-go/bundle/v1"
+	protocommon "github.com/sigstore/protobuf-specs/gen/pb-go/common/v1"
+	protodsse "github.com/sigstore/protobuf-specs/gen/pb-go/dsse"
+	protorekor "github.com/sigstore/protobuf-specs/gen/pb-go/rekor/v1"
+	"github.com/sigstore/sigstore-go/pkg/bundle"
+	"github.com/sigstore/sigstore-go/pkg/root"
+	"github.com/sigstore/sigstore-go/pkg/verify"
+	"github.com/sigstore/sigstore/pkg/cryptoutils"
+	"github.com/sigstore/sigstore/pkg/signature"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+const (
+	simpleSigningMediaType = "application/vnd.dev.cosign.simplesigning.v1+json"
+	dsseMediaType          = "application/vnd.dsse.envelope.v1+json"
+	bundleMediaType        = "application/vnd.dev.sigstore.bundle+json;version=0.1"
+
+	signatureAnnotation   = "dev.cosignproject.cosign/signature"
+	certificateAnnotation = "dev.sigstore.cosign/certificate"
+	bundleAnnotation      = "dev.sigstore.cosign/bundle"
+
+	slsaProvenancePrefix = "https://slsa.dev/provenance/"
+)
+
+// VerificationStatus is the result of verifying a signature or attestation
+type VerificationStatus string
+
+const (
+	VerificationSkipped VerificationStatus = ""
+	VerificationMissing VerificationStatus = "missing"
+	VerificationFailed  VerificationStatus = "fail"
+	VerificationPassed  VerificationStatus = "pass"
+)
+
+// Verification contains the cosign signature and SLSA provenance
+// verification results for an image
+type Verification struct {
+	Signature  VerificationStatus `json:"signature,omitempty"`
+	Provenance VerificationStatus `json:"provenance,omitempty"`
+}
+
+// Verifier verifies cosign signatures and attestations with sigstore-go,
+// either against a public key or, for keyless signing, against a sigstore
+// trusted root and the identity in the Fulcio certificate. Keyless signatures
+// must have a Rekor entry and a timestamp of a certificate transparency log
+// of the trusted root.
+type Verifier struct {
+	verifier   *verify.Verifier
+	policy     verify.PolicyOption
+	provenance bool
+}
+
+// NewKeyVerifier creates a verifier for signatures made with the private key
+// matching the given PEM encoded public key.
+func NewKeyVerifier(keyPEM []byte) (*Verifier, error) {
+	key, err := cryptoutils.UnmarshalPEMToPublicKey(keyPEM)
+	if err != nil {
+		return nil, err
+	}
+	sv, err := signature.LoadVerifier(key, crypto.SHA256)
+	if err != nil {
+		return nil, err
+	}
+
+	material := root.NewTrustedPublicKeyMaterial(func(string) (root.TimeConstrainedVerifier, error) {
+		return root.NewExpiringKey(sv, time.Time{}, time.Time{}), nil
+	})
+	// cosign doesn't log signatures made with a key by default, so there is
+	// no timestamp to check them at
+	verifier, err := verify.NewVerifier(material, verify.WithNoObserverTimestamps())
+	if err != nil {
+		return nil, err
+	}
+
+	return &Verifier{verifier: verifier, policy: verify.WithKey()}, nil
+}
+
+// NewKeylessVerifier creates a verifier for keyless signatures whose
+// certificate was issued to identity by the OIDC issuer. trustedRootJSON is a
+// sigstore trusted_root.json holding the Fulcio roots and the Rekor and ct
+// log keys the signatures are verified with.
+func NewKeylessVerifier(trustedRootJSON []byte, identity, issuer string) (*Verifier, error) {
+	if identity == "" || issuer == "" {
+		return nil, errors.New("certificate identity and oidc issuer are required for keyless verification")
+	}
+
+	trustedRoot, err := root.NewTrustedRootFromJSON(trustedRootJSON)
+	if err != nil {
+		return nil, errors.New("invalid trusted root: " + err.Error())
+	}
+
+	verifier, err := verify.NewVerifier(trustedRoot,
+		verify.WithTransparencyLog(1),
+		verify.WithIntegratedTimestamps(1),
+		verify.WithSignedCertificateTimestamps(1),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	certIdentity, err := verify.NewShortCertificateIdentity(issuer, "", identity, "")
+	if err != nil {
+		return nil, err
+	}
+
+	return &Verifier{verifier: verifier, policy: verify.WithCertificateIdentity(certIdentity)}, nil
+}
+
+// WithProvenance enables the verification of SLSA provenance attestations
+func (v *Verifier) WithProvenance() *Verifier {
+	v.provenance = true
+	return v
+}
+
+// Verify checks the cosign signature and, if enabled, the SLSA provenance
+// attestation of the given image.
+func (c *Client) Verify(ctx context.Context, ref name.Reference, v *Verifier) (Verification, error) {
+	var result Verification
+
+	tagRef, err := replaceRegistry(c.registry, ref)
+	if err != nil {
+		return result, err
+	}
+
+	desc, err := remote.Head(tagRef, c.options(ctx)...)
+	if err != nil {
+		if isNotFound(err) {
+			result.Signature = VerificationMissing
+			if v.provenance {
+				result.Provenance = VerificationMissing
+			}
+			return result, nil
+		}
+		return result, err
+	}
+
+	result.Signature, err = c.verifyLayers(ctx, cosignTag(tagRef, desc.Digest, "sig"), simpleSigningMediaType, func(layer v1.Descriptor, content []byte) error {
+		return v.verifySignature(layer, content, desc.Digest)
+	})
+	if err != nil {
+		return result, err
+	}
+
+	if v.provenance {
+		result.Provenance, err = c.verifyLayers(ctx, cosignTag(tagRef, desc.Digest, "att"), dsseMediaType, func(layer v1.Descriptor, content []byte) error {
+			return v.verifyAttestation(layer, content, desc.Digest)
+		})
+		if err != nil {
+			return result, err
+		}
+	}
+
+	return result, nil
+}
+
+// cosignTag returns the tag cosign stores the signatures or attestations of
+// the image digest under, e.g. sha256-<hex>.sig
+func cosignTag(ref name.Tag, digest v1.Hash, suffix string) name.Tag {
+	return ref.Context().Tag(digest.Algorithm + "-" + digest.Hex + "." + suffix)
+}
+
+// verifyLayers passes every layer of the given media type to check, and
+// reports success if at least one of them is valid.
+func (c *Client) verifyLayers(ctx context.Context, tag name.Tag, mediaType string, check func(v1.Descriptor, []byte) error) (VerificationStatus, error) {
+	img, err := remote.Image(tag, c.options(ctx)...)
+	if err != nil {
+		if isNotFound(err) {
+			return VerificationMissing, nil
+		}
+		return VerificationFailed, err
+	}
+
+	manifest, err := img.Manifest()
+	if err != nil {
+		return VerificationFailed, err
+	}
+
+	status := VerificationMissing
+	for _, layer := range manifest.Layers {
+		if string(layer.MediaType) != mediaType {
+			continue
+		}
+
+		l, err := img.LayerByDigest(layer.Digest)
+		if err != nil {
+			return VerificationFailed, err
+		}
+		rc, err := l.Compressed()
+		if err != nil {
+			return VerificationFailed, err
+		}
+		content, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return VerificationFailed, err
+		}
+
+		if err := check(layer, content); err != nil {
+			status = VerificationFailed
+			continue
+		}
+
+		return VerificationPassed, nil
+	}
+
+	return status, nil
+}
+
+// simpleSigningPayload is the payload signed by cosign for an image
+type simpleSigningPayload struct {
+	Critical struct {
+		Image struct {
+			DockerManifestDigest string `json:"docker-manifest-digest"`
+		} `json:"image"`
+	} `json:"critical"`
+}
+
+func (v *Verifier) verifySignature(layer v1.Descriptor, payload []byte, digest v1.Hash) error {
+	sig, err := base64.StdEncoding.DecodeString(layer.Annotations[signatureAnnotation])
+	if err != nil {
+		return err
+	}
+
+	payloadDigest := sha256.Sum256(payload)
+	b, err := newBundle(layer.Annotations, &protobundle.Bundle{
+		Content: &protobundle.Bundle_MessageSignature{
+			MessageSignature: &protocommon.MessageSignature{
+				MessageDigest: &protocommon.HashOutput{
+					Algorithm: protocommon.HashAlgorithm_SHA2_256,
+					Digest:    payloadDigest[:],
+				},
+				Signature: sig,
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	if _, err := v.verifier.Verify(b, verify.NewPolicy(verify.WithArtifact(bytes.NewReader(payload)), v.policy)); err != nil {
+		return err
+	}
+
+	var p simpleSigningPayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		return err
+	}
+	if p.Critical.Image.DockerManifestDigest != digest.String() {
+		return errors.New("signature is for a different digest: " + p.Critical.Image.DockerManifestDigest)
+	}
+
+	return nil
+}
+
+func (v *Verifier) verifyAttestation(layer v1.Descriptor, content []byte, digest v1.Hash) error {
+	var envelope protodsse.Envelope
+	if err := (protojson.UnmarshalOptions{DiscardUnknown: true}).Unmarshal(content, &envelope); err != nil {
+		return err
+	}
+
+	b, err := newBundle(layer.Annotations, &protobundle.Bundle{
+		Content: &protobundle.Bundle_DsseEnvelope{DsseEnvelope: &envelope},
+	})
+	if err != nil {
+		return err
+	}
+
+	imageDigest, err := hex.DecodeString(digest.Hex)
+	if err != nil {
+		return err
+	}
+
+	// the digest policy checks the image is a subject of the statement
+	result, err := v.verifier.Verify(b, verify.NewPolicy(verify.WithArtifactDigest(digest.Algorithm, imageDigest), v.policy))
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(result.Statement.GetPredicateType(), slsaProvenancePrefix) {
+		return errors.New("attestation is not a SLSA provenance: " + result.Statement.GetPredicateType())
+	}
+
+	return nil
+}
+
+// rekorBundle is the transparency log entry cosign attaches to keyless
+// signatures, with the timestamp rekor signed it with
+type rekorBundle struct {
+	SignedEntryTimestamp []byte `json:"SignedEntryTimestamp"`
+	Payload              struct {
+		Body           []byte `json:"body"`
+		IntegratedTime int64  `json:"integratedTime"`
+		LogID          string `json:"logID"`
+		LogIndex       int64  `json:"logIndex"`
+	} `json:"Payload"`
+}
+
+// newBundle completes the sigstore bundle holding the signature or
+// attestation of a cosign layer with the certificate and rekor entry from the
+// layer annotations. Layers without a certificate were signed with a key.
+func newBundle(annotations map[string]string, b *protobundle.Bundle) (*bundle.Bundle, error) {
+	material := &protobundle.VerificationMaterial{
+		Content: &protobundle.VerificationMaterial_PublicKey{PublicKey: &protocommon.PublicKeyIdentifier{}},
+	}
+
+	if certPEM := annotations[certificateAnnotation]; certPEM != "" {
+		block, _ := pem.Decode([]byte(certPEM))
+		if block == nil {
+			return nil, errors.New("no signing certificate found")
+		}
+		material.Content = &protobundle.VerificationMaterial_X509CertificateChain{
+			X509CertificateChain: &protocommon.X509CertificateChain{
+				Certificates: []*protocommon.X509Certificate{{RawBytes: block.Bytes}},
+			},
+		}
+	}
+
+	if bundleJSON := annotations[bundleAnnotation]; bundleJSON != "" {
+		entry, err := logEntry(bundleJSON)
+		if err != nil {
+			return nil, errors.New("invalid rekor bundle: " + err.Error())
+		}
+		material.TlogEntries = []*protorekor.TransparencyLogEntry{entry}
+	}
+
+	b.MediaType = bundleMediaType
+	b.VerificationMaterial = material
+
+	return bundle.NewBundle(b)
+}
+
+// logEntry converts the rekor bundle annotation of cosign to a transparency
+// log entry, whose inclusion promise is the signed entry timestamp
+func logEntry(bundleJSON string) (*protorekor.TransparencyLogEntry, error) {
+	var b rekorBundle
+	if err := json.Unmarshal([]byte(bundleJSON), &b); err != nil {
+		return nil, err
+	}
+
+	logID, err := hex.DecodeString(b.Payload.LogID)
+	if err != nil {
+		return nil, err
+	}
+
+	var body struct {
+		Kind       string `json:"kind"`
+		APIVersion string `json:"apiVersion"`
+	}
+	if err := json.Unmarshal(b.Payload.Body, &body); err != nil {
+		return nil, err
+	}
+
+	return &protorekor.TransparencyLogEntry{
+		LogIndex:          b.Payload.LogIndex,
+		LogId:             &protocommon.LogId{KeyId: logID},
+		KindVersion:       &protorekor.KindVersion{Kind: body.Kind, Version: body.APIVersion},
+		IntegratedTime:    b.Payload.IntegratedTime,
+		InclusionPromise:  &protorekor.InclusionPromise{SignedEntryTimestamp: b.SignedEntryTimestamp},
+		CanonicalizedBody: b.Payload.Body,
+	}, nil
+}
+
+func isNotFound(err error) bool {
+	var transportErr *transport.Error
+	return errors.As(err, &transportErr) && transportErr.StatusCode == http.StatusNotFound
+}
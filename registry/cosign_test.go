@@ -0,0 +1,478 @@
+package registry
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/static"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/secure-systems-lab/go-securesystemslib/dsse"
+	"github.com/sigstore/sigstore-go/pkg/root"
+	"golang.org/x/crypto/cryptobyte"
+)
+
+func pushCosignImage(t *testing.T, tag name.Tag, mediaType string, content []byte, annotations map[string]string) {
+	t.Helper()
+
+	img, err := mutate.Append(empty.Image, mutate.Addendum{
+		Layer:       static.NewLayer(content, types.MediaType(mediaType)),
+		Annotations: annotations,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := remote.Write(tag, img); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func sign(t *testing.T, key *ecdsa.PrivateKey, data []byte) string {
+	t.Helper()
+
+	digest := sha256.Sum256(data)
+	sig, err := ecdsa.SignASN1(rand.Reader, key, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return base64.StdEncoding.EncodeToString(sig)
+}
+
+func TestClientVerify(t *testing.T) {
+	server := httptest.NewServer(registry.New())
+	defer server.Close()
+	host := strings.TrimPrefix(server.URL, "http://")
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifier, err := NewKeyVerifier(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pub}))
+	if err != nil {
+		t.Fatalf("NewKeyVerifier() error = %v", err)
+	}
+	verifier.WithProvenance()
+
+	pushImage := func(repo string) (name.Tag, v1.Hash) {
+		tag, err := name.NewTag(host + "/" + repo + ":v1.0.0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		img, err := random.Image(64, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := remote.Write(tag, img); err != nil {
+			t.Fatal(err)
+		}
+		digest, err := img.Digest()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tag, digest
+	}
+
+	signImage := func(tag name.Tag, digest v1.Hash, signedDigest string) {
+		payload := []byte(`{"critical":{"identity":{"docker-reference":"` + tag.Context().String() + `"},"image":{"docker-manifest-digest":"` +
+			signedDigest + `"},"type":"cosign container image signature"},"optional":null}`)
+		pushCosignImage(t, cosignTag(tag, digest, "sig"), simpleSigningMediaType, payload, map[string]string{
+			signatureAnnotation: sign(t, key, payload),
+		})
+	}
+
+	attestImage := func(tag name.Tag, digest v1.Hash) {
+		statement := []byte(`{"_type":"https://in-toto.io/Statement/v0.1","predicateType":"https://slsa.dev/provenance/v0.2","subject":[{"name":"` +
+			tag.Context().String() + `","digest":{"sha256":"` + digest.Hex + `"}}],"predicate":{}}`)
+		payloadType := "application/vnd.in-toto+json"
+		envelope, err := json.Marshal(map[string]interface{}{
+			"payloadType": payloadType,
+			"payload":     base64.StdEncoding.EncodeToString(statement),
+			"signatures":  []map[string]string{{"sig": sign(t, key, dsse.PAE(payloadType, statement))}},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		pushCosignImage(t, cosignTag(tag, digest, "att"), dsseMediaType, envelope, map[string]string{signatureAnnotation: ""})
+	}
+
+	signedTag, signedDigest := pushImage("rancher/signed")
+	signImage(signedTag, signedDigest, signedDigest.String())
+	attestImage(signedTag, signedDigest)
+
+	unsignedTag, _ := pushImage("rancher/unsigned")
+
+	tamperedTag, tamperedDigest := pushImage("rancher/tampered")
+	signImage(tamperedTag, tamperedDigest, signedDigest.String())
+
+	tests := []struct {
+		name string
+		ref  name.Tag
+		want Verification
+	}{
+		{
+			name: "signed with provenance",
+			ref:  signedTag,
+			want: Verification{Signature: VerificationPassed, Provenance: VerificationPassed},
+		},
+		{
+			name: "unsigned",
+			ref:  unsignedTag,
+			want: Verification{Signature: VerificationMissing, Provenance: VerificationMissing},
+		},
+		{
+			name: "signature for another digest",
+			ref:  tamperedTag,
+			want: Verification{Signature: VerificationFailed, Provenance: VerificationMissing},
+		},
+	}
+
+	client := NewClient(host, false)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := client.Verify(context.Background(), tt.ref, verifier)
+			if err != nil {
+				t.Fatalf("Verify() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Verify() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func generateKey(t *testing.T) *ecdsa.PrivateKey {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+// fulcio certificate extensions holding the OIDC issuer of the signer and
+// the signed certificate timestamps of the ct logs
+var (
+	oidIssuerV1 = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 57264, 1, 1}
+	oidSCTList  = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11129, 2, 4, 2}
+)
+
+// fulcioCertificate issues a code signing certificate to identity, embedding
+// a timestamp of the ct log like fulcio does
+func fulcioCertificate(t *testing.T, ca *x509.Certificate, caKey, ctLogKey, key *ecdsa.PrivateKey, identity, issuer string, notBefore time.Time) []byte {
+	t.Helper()
+
+	template := &x509.Certificate{
+		SerialNumber:   big.NewInt(2),
+		NotBefore:      notBefore,
+		NotAfter:       notBefore.Add(10 * time.Minute),
+		KeyUsage:       x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:    []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+		EmailAddresses: []string{identity},
+		ExtraExtensions: []pkix.Extension{
+			{Id: oidIssuerV1, Value: []byte(issuer)},
+		},
+	}
+
+	precertDER, err := x509.CreateCertificate(rand.Reader, template, ca, &key.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	precert, err := x509.ParseCertificate(precertDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctLogDER, err := x509.MarshalPKIXPublicKey(&ctLogKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logID := sha256.Sum256(ctLogDER)
+	issuerKeyHash := sha256.Sum256(ca.RawSubjectPublicKeyInfo)
+	timestamp := uint64(notBefore.UnixMilli())
+
+	var signed cryptobyte.Builder
+	signed.AddUint8(0)
+	signed.AddUint8(0)
+	signed.AddUint64(timestamp)
+	signed.AddUint16(1)
+	signed.AddBytes(issuerKeyHash[:])
+	signed.AddUint24LengthPrefixed(func(b *cryptobyte.Builder) { b.AddBytes(precert.RawTBSCertificate) })
+	signed.AddUint16(0)
+	sig, err := base64.StdEncoding.DecodeString(sign(t, ctLogKey, signed.BytesOrPanic()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var list cryptobyte.Builder
+	list.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+		b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+			b.AddUint8(0)
+			b.AddBytes(logID[:])
+			b.AddUint64(timestamp)
+			b.AddUint16(0)
+			b.AddUint8(4) // sha256
+			b.AddUint8(3) // ecdsa
+			b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) { b.AddBytes(sig) })
+		})
+	})
+	sctList, err := asn1.Marshal(list.BytesOrPanic())
+	if err != nil {
+		t.Fatal(err)
+	}
+	template.ExtraExtensions = append(template.ExtraExtensions, pkix.Extension{Id: oidSCTList, Value: sctList})
+
+	der, err := x509.CreateCertificate(rand.Reader, template, ca, &key.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+// rekorBundleJSON returns the bundle of the hashedrekord entry of the
+// signature, signed by the rekor key
+func rekorBundleJSON(t *testing.T, rekorKey *ecdsa.PrivateKey, certPEM, payload []byte, sig string, integratedTime int64) string {
+	t.Helper()
+
+	digest := sha256.Sum256(payload)
+	body, err := json.Marshal(map[string]interface{}{
+		"apiVersion": "0.0.1",
+		"kind":       "hashedrekord",
+		"spec": map[string]interface{}{
+			"data": map[string]interface{}{
+				"hash": map[string]string{"algorithm": "sha256", "value": hex.EncodeToString(digest[:])},
+			},
+			"signature": map[string]interface{}{
+				"content":   sig,
+				"publicKey": map[string]string{"content": base64.StdEncoding.EncodeToString(certPEM)},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rekorDER, err := x509.MarshalPKIXPublicKey(&rekorKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logID := sha256.Sum256(rekorDER)
+
+	// maps are encoded with sorted keys, which is the canonical form rekor signs
+	entry := map[string]interface{}{
+		"body":           base64.StdEncoding.EncodeToString(body),
+		"integratedTime": integratedTime,
+		"logID":          hex.EncodeToString(logID[:]),
+		"logIndex":       42,
+	}
+	canonical, err := json.Marshal(entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bundle, err := json.Marshal(map[string]interface{}{
+		"SignedEntryTimestamp": sign(t, rekorKey, canonical),
+		"Payload":              entry,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(bundle)
+}
+
+// trustedRootJSON returns a sigstore trusted root trusting the fulcio ca and
+// the rekor and ct log keys
+func trustedRootJSON(t *testing.T, ca *x509.Certificate, rekorKey, ctLogKey *ecdsa.PrivateKey) []byte {
+	t.Helper()
+
+	logs := func(key *ecdsa.PrivateKey) map[string]*root.TransparencyLog {
+		der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		id := sha256.Sum256(der)
+		return map[string]*root.TransparencyLog{
+			hex.EncodeToString(id[:]): {
+				ID:                  id[:],
+				PublicKey:           &key.PublicKey,
+				HashFunc:            crypto.SHA256,
+				SignatureHashFunc:   crypto.SHA256,
+				ValidityPeriodStart: ca.NotBefore,
+			},
+		}
+	}
+
+	trustedRoot, err := root.NewTrustedRoot(root.TrustedRootMediaType01,
+		[]root.CertificateAuthority{&root.FulcioCertificateAuthority{Root: ca, ValidityPeriodStart: ca.NotBefore}},
+		logs(ctLogKey), nil, logs(rekorKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := trustedRoot.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestClientVerifyKeyless(t *testing.T) {
+	server := httptest.NewServer(registry.New())
+	defer server.Close()
+	host := strings.TrimPrefix(server.URL, "http://")
+
+	const identity = "release@rancher.com"
+	const issuer = "https://token.actions.githubusercontent.com"
+
+	caKey := generateKey(t)
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "fulcio"},
+		NotBefore:             time.Now().Add(-24 * time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, err := x509.ParseCertificate(caDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rekorKey := generateKey(t)
+	ctLogKey := generateKey(t)
+	otherKey := generateKey(t)
+	signingKey := generateKey(t)
+
+	// the certificate expired long ago, it is only valid at the time of the
+	// rekor entry
+	signedAt := time.Now().Add(-2 * time.Hour)
+	certPEM := fulcioCertificate(t, ca, caKey, ctLogKey, signingKey, identity, issuer, signedAt)
+
+	signImage := func(repo string, integratedTime int64, bundleTime int64) name.Tag {
+		tag, err := name.NewTag(host + "/" + repo + ":v1.0.0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		img, err := random.Image(64, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := remote.Write(tag, img); err != nil {
+			t.Fatal(err)
+		}
+		digest, err := img.Digest()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		payload := []byte(`{"critical":{"identity":{"docker-reference":"` + tag.Context().String() + `"},"image":{"docker-manifest-digest":"` +
+			digest.String() + `"},"type":"cosign container image signature"},"optional":null}`)
+		sig := sign(t, signingKey, payload)
+		bundle := rekorBundleJSON(t, rekorKey, certPEM, payload, sig, integratedTime)
+		// a bundle whose time was changed after rekor signed it
+		bundle = strings.Replace(bundle, `"integratedTime":`+strconv.FormatInt(integratedTime, 10), `"integratedTime":`+strconv.FormatInt(bundleTime, 10), 1)
+
+		pushCosignImage(t, cosignTag(tag, digest, "sig"), simpleSigningMediaType, payload, map[string]string{
+			signatureAnnotation:   sig,
+			certificateAnnotation: string(certPEM),
+			bundleAnnotation:      bundle,
+		})
+		return tag
+	}
+
+	loggedAt := signedAt.Add(time.Minute).Unix()
+	signedTag := signImage("rancher/signed", loggedAt, loggedAt)
+	tamperedTag := signImage("rancher/tampered", loggedAt, loggedAt+60)
+
+	tests := []struct {
+		name        string
+		ref         name.Tag
+		trustedRoot []byte
+		identity    string
+		want        VerificationStatus
+	}{
+		{
+			name:        "verified transparency logs",
+			ref:         signedTag,
+			trustedRoot: trustedRootJSON(t, ca, rekorKey, ctLogKey),
+			identity:    identity,
+			want:        VerificationPassed,
+		},
+		{
+			name:        "bundle of another rekor",
+			ref:         signedTag,
+			trustedRoot: trustedRootJSON(t, ca, otherKey, ctLogKey),
+			identity:    identity,
+			want:        VerificationFailed,
+		},
+		{
+			name:        "sct of another ct log",
+			ref:         signedTag,
+			trustedRoot: trustedRootJSON(t, ca, rekorKey, otherKey),
+			identity:    identity,
+			want:        VerificationFailed,
+		},
+		{
+			name:        "tampered bundle",
+			ref:         tamperedTag,
+			trustedRoot: trustedRootJSON(t, ca, rekorKey, ctLogKey),
+			identity:    identity,
+			want:        VerificationFailed,
+		},
+		{
+			name:        "another identity",
+			ref:         signedTag,
+			trustedRoot: trustedRootJSON(t, ca, rekorKey, ctLogKey),
+			identity:    "someone@example.com",
+			want:        VerificationFailed,
+		},
+	}
+
+	client := NewClient(host, false)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verifier, err := NewKeylessVerifier(tt.trustedRoot, tt.identity, issuer)
+			if err != nil {
+				t.Fatalf("NewKeylessVerifier() error = %v", err)
+			}
+			got, err := client.Verify(context.Background(), tt.ref, verifier)
+			if err != nil {
+				t.Fatalf("Verify() error = %v", err)
+			}
+			if got.Signature != tt.want {
+				t.Errorf("Verify() signature = %q, want %q", got.Signature, tt.want)
+			}
+		})
+	}
+}
@@ -2,34 +2,197 @@ package registry
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"net/http"
+	"os/exec"
+	"strings"
 
+	"github.com/google/go-containerregistry/pkg/authn"
 	"github.com/google/go-containerregistry/pkg/name"
 	"github.com/google/go-containerregistry/pkg/v1/remote"
-	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
 )
 
 type Platform struct {
 	OS           string
 	Architecture string
+	// Variant tells apart the builds of an architecture, e.g. v6 and v7 for
+	// arm. It is empty for arm64, whose only variant is v8.
+	Variant string
+	// OSVersion tells apart the windows builds of an image, it is empty for linux
+	OSVersion string
+}
+
+// newPlatform returns the platform of an image, normalizing the arm64 variant
+// which images may or may not set
+func newPlatform(os, arch, variant, osVersion string) Platform {
+	if arch == "arm64" && variant == "v8" {
+		variant = ""
+	}
+	return Platform{OS: os, Architecture: arch, Variant: variant, OSVersion: osVersion}
 }
 
 func (p Platform) String() string {
-	return p.OS + "/" + p.Architecture
+	s := p.OS + "/" + p.Architecture
+	if p.Variant != "" {
+		s += "/" + p.Variant
+	}
+	if p.OSVersion != "" {
+		s += ":" + p.OSVersion
+	}
+	return s
+}
+
+// MarshalText implements encoding.TextMarshaler so platforms can be used as
+// keys in JSON and YAML documents
+func (p Platform) MarshalText() ([]byte, error) {
+	return []byte(p.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler for
+// os/arch[/variant][:osversion] strings
+func (p *Platform) UnmarshalText(text []byte) error {
+	platform, osVersion, _ := strings.Cut(string(text), ":")
+	parts := strings.Split(platform, "/")
+	if len(parts) < 2 || len(parts) > 3 {
+		return errors.New("invalid platform: " + string(text))
+	}
+	variant := ""
+	if len(parts) == 3 {
+		variant = parts[2]
+	}
+	*p = newPlatform(parts[0], parts[1], variant, osVersion)
+	return nil
 }
 
 type Image struct {
-	Platforms map[Platform]bool
-	Exists    bool
+	Platforms map[Platform]bool `json:"platforms"`
+	Exists    bool              `json:"exists"`
+	// Digest is the digest of the index for multi-arch images, or of the
+	// manifest for single-arch images
+	Digest string `json:"digest,omitempty"`
+	// PlatformDigests are the manifest digests for every platform
+	PlatformDigests map[Platform]string `json:"platform_digests,omitempty"`
+}
+
+// ImageClient is implemented by clients that read image manifests from a registry
+type ImageClient interface {
+	Image(ctx context.Context, ref name.Reference) (Image, error)
 }
 
+// Client reads images from a single registry. Requests are anonymous unless
+// credentials are configured with one of the Option functions.
 type Client struct {
-	registry string
+	registry  string
+	debug     bool
+	keychain  authn.Keychain
+	transport http.RoundTripper
+	// noPlatforms skips reading the platform of single-arch images
+	noPlatforms bool
+}
+
+// Option configures a Client
+type Option func(*Client)
+
+// WithBasicAuth authenticates with the given username and password
+func WithBasicAuth(username, password string) Option {
+	return func(c *Client) {
+		c.keychain = staticKeychain{&authn.Basic{Username: username, Password: password}}
+	}
+}
+
+// WithDockerConfig authenticates with the credentials in the docker
+// config.json, including the credential helpers configured in it
+func WithDockerConfig() Option {
+	return func(c *Client) {
+		c.keychain = authn.DefaultKeychain
+	}
+}
+
+// WithCredentialHelper authenticates with the credentials returned by the
+// docker credential helper, e.g. "ecr-login" runs docker-credential-ecr-login
+func WithCredentialHelper(helper string) Option {
+	return func(c *Client) {
+		c.keychain = authn.NewKeychainFromHelper(credentialHelper(helper))
+	}
+}
+
+// WithTransport sets the transport requests are sent with. Rate limited
+// responses are retried on top of it.
+func WithTransport(transport http.RoundTripper) Option {
+	return func(c *Client) {
+		c.transport = transport
+	}
+}
+
+// WithoutPlatforms skips reading the platform of single-arch images, which
+// takes a request for the image config, for clients that only check the images
+// exist. The platforms of multi-arch images are still read from their index.
+func WithoutPlatforms() Option {
+	return func(c *Client) {
+		c.noPlatforms = true
+	}
+}
+
+// NewClient creates a client for the given registry. When debug is set every
+// request is logged.
+func NewClient(registry string, debug bool, opts ...Option) *Client {
+	c := &Client{
+		registry:  registry,
+		debug:     debug,
+		keychain:  staticKeychain{authn.Anonymous},
+		transport: remote.DefaultTransport,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	c.transport = newRetryTransport(c.transport, debug)
+
+	return c
+}
+
+// options returns the remote options every request is made with
+func (c *Client) options(ctx context.Context) []remote.Option {
+	return []remote.Option{
+		remote.WithContext(ctx),
+		remote.WithAuthFromKeychain(c.keychain),
+		remote.WithTransport(c.transport),
+		remote.WithRetryPredicate(retryable),
+	}
 }
 
-func NewClient(registry string, debug bool) *Client {
-	return &Client{registry}
+// staticKeychain resolves the same authenticator for every registry
+type staticKeychain struct {
+	auth authn.Authenticator
+}
+
+func (k staticKeychain) Resolve(authn.Resource) (authn.Authenticator, error) {
+	return k.auth, nil
+}
+
+// credentialHelper implements authn.Helper by running a docker credential
+// helper binary
+type credentialHelper string
+
+func (h credentialHelper) Get(serverURL string) (string, string, error) {
+	cmd := exec.Command("docker-credential-"+string(h), "get")
+	cmd.Stdin = strings.NewReader(serverURL)
+
+	out, err := cmd.Output()
+	if err != nil {
+		return "", "", errors.New("credential helper " + string(h) + " failed: " + err.Error())
+	}
+
+	var creds struct {
+		Username string `json:"Username"`
+		Secret   string `json:"Secret"`
+	}
+	if err := json.Unmarshal(out, &creds); err != nil {
+		return "", "", err
+	}
+
+	return creds.Username, creds.Secret, nil
 }
 
 func replaceRegistry(registry string, ref name.Reference) (name.Tag, error) {
@@ -43,7 +206,8 @@ func replaceRegistry(registry string, ref name.Reference) (name.Tag, error) {
 
 func (c *Client) Image(ctx context.Context, ref name.Reference) (Image, error) {
 	info := Image{
-		Platforms: make(map[Platform]bool),
+		Platforms:       make(map[Platform]bool),
+		PlatformDigests: make(map[Platform]string),
 	}
 
 	tagRef, err := replaceRegistry(c.registry, ref)
@@ -51,22 +215,23 @@ func (c *Client) Image(ctx context.Context, ref name.Reference) (Image, error) {
 		return info, err
 	}
 
-	desc, err := remote.Get(tagRef)
+	desc, err := remote.Get(tagRef, c.options(ctx)...)
 	if err != nil {
-		var transportErr *transport.Error
-		if errors.As(err, &transportErr) && transportErr.StatusCode == http.StatusNotFound {
+		if isNotFound(err) {
 			return info, nil
 		}
 		return info, err
 	}
 
 	info.Exists = true
+	info.Digest = desc.Digest.String()
 
-	if desc.MediaType.IsIndex() {
+	switch {
+	case desc.MediaType.IsIndex():
 		if err := c.handleMultiArchImage(desc, &info); err != nil {
 			return info, err
 		}
-	} else {
+	case !c.noPlatforms:
 		if err := c.handleSingleArchImage(desc, &info); err != nil {
 			return info, err
 		}
@@ -87,11 +252,14 @@ func (c *Client) handleMultiArchImage(desc *remote.Descriptor, info *Image) erro
 	}
 
 	for _, m := range manifest.Manifests {
-		platform := Platform{
-			OS:           m.Platform.OS,
-			Architecture: m.Platform.Architecture,
+		// manifests without a platform, e.g. nested indexes, can't be matched
+		// to the platforms the image is expected on
+		if m.Platform == nil {
+			continue
 		}
+		platform := newPlatform(m.Platform.OS, m.Platform.Architecture, m.Platform.Variant, m.Platform.OSVersion)
 		info.Platforms[platform] = true
+		info.PlatformDigests[platform] = m.Digest.String()
 	}
 
 	return nil
@@ -108,11 +276,9 @@ func (c *Client) handleSingleArchImage(desc *remote.Descriptor, info *Image) err
 		return err
 	}
 
-	platform := Platform{
-		OS:           cfg.OS,
-		Architecture: cfg.Architecture,
-	}
+	platform := newPlatform(cfg.OS, cfg.Architecture, cfg.Variant, cfg.OSVersion)
 	info.Platforms[platform] = true
+	info.PlatformDigests[platform] = desc.Digest.String()
 
 	return nil
 }
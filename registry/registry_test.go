@@ -1,9 +1,22 @@
 package registry
 
 import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"syscall"
 	"testing"
+	"time"
 
+	"github.com/google/go-containerregistry/pkg/authn"
 	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
 )
 
 func TestReplaceRegistry(t *testing.T) {
@@ -49,3 +62,332 @@ func TestReplaceRegistry(t *testing.T) {
 		})
 	}
 }
+
+func TestClientImageDigests(t *testing.T) {
+	server := httptest.NewServer(registry.New())
+	defer server.Close()
+	host := strings.TrimPrefix(server.URL, "http://")
+
+	idx, err := random.Index(64, 1, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifest, err := idx.IndexManifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// random indexes have no platforms set, the last manifest is left without one
+	platforms := []v1.Platform{
+		{OS: "linux", Architecture: "amd64"},
+		{OS: "linux", Architecture: "arm64", Variant: "v8"},
+		{OS: "linux", Architecture: "arm", Variant: "v6"},
+		{OS: "linux", Architecture: "arm", Variant: "v7"},
+	}
+	var adds []mutate.IndexAddendum
+	for i, desc := range manifest.Manifests {
+		img, err := idx.Image(desc.Digest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var descriptor v1.Descriptor
+		if i < len(platforms) {
+			descriptor.Platform = &platforms[i]
+		}
+		adds = append(adds, mutate.IndexAddendum{Add: img, Descriptor: descriptor})
+	}
+	idx = mutate.AppendManifests(mutate.RemoveManifests(idx, func(v1.Descriptor) bool { return true }), adds...)
+
+	tag, err := name.NewTag(host + "/rancher/rke2-runtime:v1.23.4-rke2r1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := remote.WriteIndex(tag, idx); err != nil {
+		t.Fatal(err)
+	}
+
+	image, err := NewClient(host, false).Image(context.Background(), tag)
+	if err != nil {
+		t.Fatalf("Image() error = %v", err)
+	}
+
+	digest, err := idx.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if image.Digest != digest.String() {
+		t.Errorf("Image().Digest = %s, want %s", image.Digest, digest)
+	}
+
+	if len(image.Platforms) != len(platforms) {
+		t.Errorf("Image().Platforms = %v, want %d platforms", image.Platforms, len(platforms))
+	}
+
+	// the arm64 variant is normalized, the arm ones are kept apart
+	want := []Platform{
+		{OS: "linux", Architecture: "amd64"},
+		{OS: "linux", Architecture: "arm64"},
+		{OS: "linux", Architecture: "arm", Variant: "v6"},
+		{OS: "linux", Architecture: "arm", Variant: "v7"},
+	}
+	for i, p := range want {
+		img := adds[i].Add.(v1.Image)
+		wantDigest, err := img.Digest()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !image.Platforms[p] || image.PlatformDigests[p] != wantDigest.String() {
+			t.Errorf("platform %s: got digest %q, want %q", p, image.PlatformDigests[p], wantDigest)
+		}
+	}
+}
+
+func TestClientImageSingleArch(t *testing.T) {
+	reg := registry.New()
+	var blobRequests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.URL.Path, "/blobs/") && r.Method == http.MethodGet {
+			blobRequests++
+		}
+		reg.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+	host := strings.TrimPrefix(server.URL, "http://")
+
+	img, err := random.Image(64, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err = mutate.ConfigFile(img, &v1.ConfigFile{OS: "linux", Architecture: "arm", Variant: "v7"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tag, err := name.NewTag(host + "/rancher/rancher:v2.9.3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := remote.Write(tag, img); err != nil {
+		t.Fatal(err)
+	}
+	blobRequests = 0
+
+	image, err := NewClient(host, false).Image(context.Background(), tag)
+	if err != nil {
+		t.Fatalf("Image() error = %v", err)
+	}
+	if p := (Platform{OS: "linux", Architecture: "arm", Variant: "v7"}); !image.Platforms[p] {
+		t.Errorf("Image().Platforms = %v, want %s", image.Platforms, p)
+	}
+	if blobRequests != 1 {
+		t.Errorf("got %d blob requests, want the config blob request", blobRequests)
+	}
+
+	blobRequests = 0
+	image, err = NewClient(host, false, WithoutPlatforms()).Image(context.Background(), tag)
+	if err != nil {
+		t.Fatalf("Image() error = %v", err)
+	}
+	if !image.Exists || len(image.Platforms) != 0 {
+		t.Errorf("Image() = %+v, want an existing image without platforms", image)
+	}
+	if blobRequests != 0 {
+		t.Errorf("got %d blob requests without platforms, want 0", blobRequests)
+	}
+}
+
+func TestPlatformText(t *testing.T) {
+	for _, text := range []string{"linux/amd64", "linux/arm/v7", "windows/amd64:10.0.17763.5576"} {
+		var p Platform
+		if err := p.UnmarshalText([]byte(text)); err != nil {
+			t.Fatalf("UnmarshalText(%q) error = %v", text, err)
+		}
+		if got, _ := p.MarshalText(); string(got) != text {
+			t.Errorf("MarshalText() = %q, want %q", got, text)
+		}
+	}
+
+	var p Platform
+	if err := p.UnmarshalText([]byte("linux/arm64/v8")); err != nil || p != (Platform{OS: "linux", Architecture: "arm64"}) {
+		t.Errorf("UnmarshalText(linux/arm64/v8) = %+v, %v, want linux/arm64", p, err)
+	}
+	if err := p.UnmarshalText([]byte("linux")); err == nil {
+		t.Error("UnmarshalText(linux) succeeded, want error")
+	}
+}
+
+func TestRetryTransport(t *testing.T) {
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		switch requests {
+		case 1:
+			w.Header().Set("Retry-After", "7")
+			w.WriteHeader(http.StatusTooManyRequests)
+		case 2:
+			w.WriteHeader(http.StatusTooManyRequests)
+		default:
+			w.WriteHeader(http.StatusOK)
+		}
+	}))
+	defer server.Close()
+
+	var waits []time.Duration
+	transport := newRetryTransport(http.DefaultTransport, false)
+	transport.wait = func(_ context.Context, d time.Duration) error {
+		waits = append(waits, d)
+		return nil
+	}
+
+	req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := transport.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("RoundTrip() error = %v", err)
+	}
+	res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("RoundTrip() status = %d, want %d", res.StatusCode, http.StatusOK)
+	}
+	if len(waits) != 2 || waits[0] != 7*time.Second || waits[1] != initialBackoff {
+		t.Errorf("waits = %v, want [7s %s]", waits, initialBackoff)
+	}
+}
+
+func TestRetryable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{
+			name: "rate limited",
+			err: &transport.Error{
+				StatusCode: http.StatusTooManyRequests,
+				Errors:     []transport.Diagnostic{{Code: transport.TooManyRequestsErrorCode}},
+			},
+			want: false,
+		},
+		{
+			name: "unavailable",
+			err:  &transport.Error{StatusCode: http.StatusServiceUnavailable},
+			want: true,
+		},
+		{
+			name: "connection reset",
+			err:  syscall.ECONNRESET,
+			want: true,
+		},
+		{
+			name: "not found",
+			err:  &transport.Error{StatusCode: http.StatusNotFound},
+			want: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := retryable(tt.err); got != tt.want {
+				t.Errorf("retryable() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClientBasicAuth(t *testing.T) {
+	reg := registry.New()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if username, password, ok := r.BasicAuth(); !ok || username != "user" || password != "pass" {
+			w.Header().Set("WWW-Authenticate", `Basic realm="test"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		reg.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+	host := strings.TrimPrefix(server.URL, "http://")
+
+	tag, err := name.NewTag(host + "/rancher/rancher:v2.9.3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := random.Image(64, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := remote.Write(tag, img, remote.WithAuth(&authn.Basic{Username: "user", Password: "pass"})); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewClient(host, false).Image(context.Background(), tag); err == nil {
+		t.Error("Image() without credentials succeeded, want error")
+	}
+
+	image, err := NewClient(host, false, WithBasicAuth("user", "pass")).Image(context.Background(), tag)
+	if err != nil {
+		t.Fatalf("Image() error = %v", err)
+	}
+	if !image.Exists {
+		t.Error("Image().Exists = false, want true")
+	}
+}
+
+func TestClientCopy(t *testing.T) {
+	source := httptest.NewServer(registry.New())
+	defer source.Close()
+	target := httptest.NewServer(registry.New())
+	defer target.Close()
+
+	sourceClient := NewClient(strings.TrimPrefix(source.URL, "http://"), false)
+	targetClient := NewClient(strings.TrimPrefix(target.URL, "http://"), false)
+
+	idx, err := random.Index(64, 1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tag, err := name.NewTag(strings.TrimPrefix(source.URL, "http://") + "/rancher/rancher:v2.9.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := remote.WriteIndex(tag, idx); err != nil {
+		t.Fatal(err)
+	}
+	want, err := idx.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	if digest, err := targetClient.Digest(ctx, tag); err != nil || digest != "" {
+		t.Fatalf("Digest() before copy = %q, %v, want empty", digest, err)
+	}
+
+	if err := sourceClient.Copy(ctx, tag, targetClient); err != nil {
+		t.Fatalf("Copy() error = %v", err)
+	}
+
+	digest, err := targetClient.Digest(ctx, tag)
+	if err != nil {
+		t.Fatalf("Digest() error = %v", err)
+	}
+	if digest != want.String() {
+		t.Errorf("Digest() after copy = %s, want index digest %s", digest, want)
+	}
+
+	// every platform manifest is copied with the index
+	manifest, err := idx.IndexManifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range manifest.Manifests {
+		ref, err := name.NewDigest(strings.TrimPrefix(target.URL, "http://") + "/rancher/rancher@" + m.Digest.String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := remote.Head(ref); err != nil {
+			t.Errorf("manifest %s not copied: %v", m.Digest, err)
+		}
+	}
+}
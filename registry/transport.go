@@ -0,0 +1,129 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	maxRetries     = 5
+	initialBackoff = time.Second
+	maxBackoff     = 2 * time.Minute
+)
+
+// retryTransport retries rate limited requests, waiting for as long as the
+// registry asks in the Retry-After header or backing off exponentially. It is
+// the only layer retrying them, remote is kept from it with retryable.
+type retryTransport struct {
+	base  http.RoundTripper
+	debug bool
+	wait  func(ctx context.Context, d time.Duration) error
+}
+
+func newRetryTransport(base http.RoundTripper, debug bool) *retryTransport {
+	return &retryTransport{
+		base:  base,
+		debug: debug,
+		wait:  sleep,
+	}
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	backoff := initialBackoff
+
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req = req.Clone(req.Context())
+			req.Body = body
+		}
+
+		start := time.Now()
+		res, err := t.base.RoundTrip(req)
+		if err != nil {
+			return nil, err
+		}
+
+		if t.debug {
+			logrus.Info(req.Method + " " + req.URL.String() + " " + strconv.Itoa(res.StatusCode) + " " + time.Since(start).Round(time.Millisecond).String())
+		}
+
+		// requests with a body that can't be read again are not retried
+		replayable := req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+		if res.StatusCode != http.StatusTooManyRequests || attempt >= maxRetries || !replayable {
+			return res, nil
+		}
+
+		delay, ok := retryAfter(res.Header.Get("Retry-After"), time.Now())
+		if !ok {
+			delay = backoff
+			backoff = min(backoff*2, maxBackoff)
+		}
+		res.Body.Close()
+
+		logrus.Info("rate limited by " + req.URL.Host + ", retrying in " + delay.String())
+
+		if err := t.wait(req.Context(), delay); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// retryable is the retry predicate of remote, which retries temporary and
+// network errors. Rate limited requests were already retried by
+// retryTransport and aren't retried again.
+func retryable(err error) bool {
+	var transportErr *transport.Error
+	if errors.As(err, &transportErr) && transportErr.StatusCode == http.StatusTooManyRequests {
+		return false
+	}
+
+	var temporary interface{ Temporary() bool }
+	if errors.As(err, &temporary) && temporary.Temporary() && !errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+
+	return errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) || errors.Is(err, syscall.EPIPE) ||
+		errors.Is(err, syscall.ECONNRESET) || errors.Is(err, net.ErrClosed)
+}
+
+// retryAfter parses a Retry-After header, either in seconds or as an HTTP date
+func retryAfter(header string, now time.Time) (time.Duration, bool) {
+	if header == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(header); err == nil && seconds >= 0 {
+		return min(time.Duration(seconds)*time.Second, maxBackoff), true
+	}
+
+	if date, err := http.ParseTime(header); err == nil {
+		return min(max(date.Sub(now), 0), maxBackoff), true
+	}
+
+	return 0, false
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
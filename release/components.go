@@ -0,0 +1,410 @@
+package release
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"io/fs"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/google/go-github/v81/github"
+	"golang.org/x/mod/modfile"
+	"golang.org/x/mod/semver"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	containerdModule   = "github.com/containerd/containerd"
+	containerdV2Module = containerdModule + "/v2"
+
+	rke2ImagesFile    = "scripts/build-images"
+	rke2ChartsFile    = "charts/chart_versions.yaml"
+	k3sImagesFile     = "scripts/airgap/image-list.txt"
+	versionScriptFile = "scripts/version.sh"
+	sqliteBindingFile = "sqlite3-binding.h"
+	sqliteModule      = "github.com/mattn/go-sqlite3"
+)
+
+var sqliteVersionRegex = regexp.MustCompile(`^#define\s+SQLITE_VERSION\s+"(.+)"`)
+
+// ComponentSource reads the files of a repository at the git ref being released
+type ComponentSource interface {
+	ReadFile(name string) ([]byte, error)
+}
+
+// githubComponentSource reads the files of a repository from GitHub
+type githubComponentSource struct {
+	ctx    context.Context
+	client *github.Client
+	owner  string
+	repo   string
+	ref    string
+}
+
+// NewGithubComponentSource returns a source which reads the files of the
+// repository at ref with the GitHub API
+func NewGithubComponentSource(ctx context.Context, client *github.Client, owner, repo, ref string) ComponentSource {
+	return &githubComponentSource{ctx: ctx, client: client, owner: owner, repo: repo, ref: ref}
+}
+
+func (s *githubComponentSource) ReadFile(name string) ([]byte, error) {
+	content, _, _, err := s.client.Repositories.GetContents(s.ctx, s.owner, s.repo, name, &github.RepositoryContentGetOptions{Ref: s.ref})
+	if err != nil {
+		return nil, errors.New("failed to read " + name + " at " + s.owner + "/" + s.repo + "@" + s.ref + ": " + err.Error())
+	}
+	if content == nil {
+		return nil, errors.New(name + " at " + s.owner + "/" + s.repo + "@" + s.ref + " is a directory")
+	}
+
+	decoded, err := content.GetContent()
+	if err != nil {
+		return nil, err
+	}
+
+	return []byte(decoded), nil
+}
+
+// fsComponentSource reads the files of a repository from a local checkout
+type fsComponentSource struct {
+	fsys fs.FS
+}
+
+// NewFSComponentSource returns a source which reads the files of a local
+// checkout of the repository, or any other filesystem with the same layout
+func NewFSComponentSource(fsys fs.FS) ComponentSource {
+	return fsComponentSource{fsys}
+}
+
+func (s fsComponentSource) ReadFile(name string) ([]byte, error) {
+	return fs.ReadFile(s.fsys, name)
+}
+
+// Component is the version of a component of a release and the file it was resolved from
+type Component struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	File    string `json:"file"`
+}
+
+// componentRule resolves the version of a component from a file of the
+// repository. Every distinct version found is returned, so a component
+// declared more than once with different versions can be reported.
+type componentRule struct {
+	name     string
+	file     string
+	optional bool
+	versions func(content []byte) ([]string, error)
+}
+
+// optionalComponent marks a component which isn't in every release, like
+// traefik or the snapshot controller in rke2, so it's left out instead of
+// failing when it's missing
+func optionalComponent(rule componentRule) componentRule {
+	rule.optional = true
+	return rule
+}
+
+// goModuleComponent resolves the version of a module from the replace section
+// of go.mod or, if it isn't replaced, from the require section. The first
+// module path which is found is used.
+func goModuleComponent(name string, modulePaths ...string) componentRule {
+	return componentRule{
+		name: name,
+		file: "go.mod",
+		versions: func(content []byte) ([]string, error) {
+			modFile, err := modfile.Parse("go.mod", content, nil)
+			if err != nil {
+				return nil, err
+			}
+
+			for _, modulePath := range modulePaths {
+				var versions []string
+				for _, replace := range modFile.Replace {
+					if replace.Old.Path == modulePath {
+						versions = append(versions, replace.New.Version)
+					}
+				}
+				if len(versions) != 0 {
+					return versions, nil
+				}
+				for _, require := range modFile.Require {
+					if require.Mod.Path == modulePath {
+						versions = append(versions, require.Mod.Version)
+					}
+				}
+				if len(versions) != 0 {
+					return versions, nil
+				}
+			}
+
+			return nil, nil
+		},
+	}
+}
+
+// scriptVarComponent resolves the version assigned to a variable in a shell script
+func scriptVarComponent(name, file, variable string) componentRule {
+	re := regexp.MustCompile(`\b` + regexp.QuoteMeta(variable) + `\b.*?(v[\d\.]+(-k3s[\w\.]*)?)`)
+	return linesComponent(name, file, func(line string) string {
+		if submatch := re.FindStringSubmatch(line); submatch != nil {
+			return submatch[1]
+		}
+		return ""
+	})
+}
+
+// dockerfileComponent resolves the tag of the image a Dockerfile stage is built from
+func dockerfileComponent(name, image string) componentRule {
+	re := regexp.MustCompile(`^FROM\s+(?:--\S+\s+)*[\w\.-]+/` + regexp.QuoteMeta(image) + `:(\S*?)(-build\S*)?(\s|$)`)
+	return linesComponent(name, "Dockerfile", func(line string) string {
+		if submatch := re.FindStringSubmatch(strings.TrimSpace(line)); submatch != nil {
+			return submatch[1]
+		}
+		return ""
+	})
+}
+
+// imageComponent resolves the tag of an image in a list of images. The image
+// matches repositories with the same name, or the same name with a prefix
+// like mirrored- or hardened-. Tags with build metadata are trimmed to the
+// upstream version.
+func imageComponent(name, file, image string) componentRule {
+	return linesComponent(name, file, func(line string) string {
+		for _, field := range strings.Fields(line) {
+			idx := strings.LastIndex(field, ":")
+			if idx == -1 {
+				continue
+			}
+			repository, tag := field[:idx], field[idx+1:]
+			if tag == "" || strings.ContainsAny(tag, "/$") {
+				continue
+			}
+			if base := path.Base(repository); base != image && !strings.HasSuffix(base, "-"+image) {
+				continue
+			}
+			if strings.Contains(tag, "-build") {
+				tag = strings.Split(tag, "-")[0]
+			}
+			return tag
+		}
+		return ""
+	})
+}
+
+// chartComponent resolves the version of a chart in the rke2 chart versions file
+func chartComponent(name string) componentRule {
+	return componentRule{
+		name: name,
+		file: rke2ChartsFile,
+		versions: func(content []byte) ([]string, error) {
+			var c charts
+			if err := yaml.Unmarshal(content, &c); err != nil {
+				return nil, err
+			}
+
+			var versions []string
+			for _, chart := range c.Charts {
+				if path.Base(chart.Filename) == name+".yaml" {
+					versions = append(versions, chart.Version)
+				}
+			}
+
+			return versions, nil
+		},
+	}
+}
+
+// linesComponent resolves a component from every line of the file the
+// version func returns a non empty version for
+func linesComponent(name, file string, version func(line string) string) componentRule {
+	return componentRule{
+		name: name,
+		file: file,
+		versions: func(content []byte) ([]string, error) {
+			var versions []string
+			scanner := bufio.NewScanner(bytes.NewReader(content))
+			for scanner.Scan() {
+				if v := version(scanner.Text()); v != "" {
+					versions = append(versions, v)
+				}
+			}
+
+			return versions, scanner.Err()
+		},
+	}
+}
+
+type charts struct {
+	Charts []chart `yaml:"charts"`
+}
+
+type chart struct {
+	Version   string `yaml:"version"`
+	Filename  string `yaml:"filename"`
+	Bootstrap bool   `yaml:"bootstrap"`
+}
+
+// resolveComponents resolves every rule against the files of the source, each
+// file is only read once. Every component which is missing, unless it's
+// optional, or has more than one version is reported in the error.
+func resolveComponents(source ComponentSource, rules []componentRule) ([]Component, error) {
+	files := make(map[string][]byte)
+	fileErrs := make(map[string]error)
+	var components []Component
+	var failures []string
+
+	for _, rule := range rules {
+		content, ok := files[rule.file]
+		if !ok {
+			if err, failed := fileErrs[rule.file]; failed {
+				failures = append(failures, rule.name+": "+err.Error())
+				continue
+			}
+			b, err := source.ReadFile(rule.file)
+			if err != nil {
+				fileErrs[rule.file] = err
+				failures = append(failures, rule.name+": "+err.Error())
+				continue
+			}
+			files[rule.file] = b
+			content = b
+		}
+
+		versions, err := rule.versions(content)
+		if err != nil {
+			failures = append(failures, rule.name+": failed to parse "+rule.file+": "+err.Error())
+			continue
+		}
+		versions = dedup(versions)
+
+		switch {
+		case len(versions) == 0 && rule.optional:
+			continue
+		case len(versions) == 0:
+			failures = append(failures, rule.name+": not found in "+rule.file)
+		case len(versions) > 1:
+			failures = append(failures, rule.name+": ambiguous in "+rule.file+", found "+strings.Join(versions, ", "))
+		default:
+			components = append(components, Component{Name: rule.name, Version: versions[0], File: rule.file})
+		}
+	}
+
+	if len(failures) != 0 {
+		return nil, errors.New("failed to resolve components: " + strings.Join(failures, "; "))
+	}
+
+	return components, nil
+}
+
+// componentVersions maps the name of every component to its version
+func componentVersions(components []Component) map[string]string {
+	versions := make(map[string]string, len(components))
+	for _, c := range components {
+		versions[c.Name] = c.Version
+	}
+	return versions
+}
+
+// rke2ComponentRules are the components of an rke2 release of the Kubernetes
+// version. Only the components every supported minor ships are required, the
+// cloud provider, snapshot and traefik charts are left out of the releases of
+// older branches.
+func rke2ComponentRules(k8sVersion string) []componentRule {
+	containerd := dockerfileComponent("containerd", "hardened-containerd")
+	if mm, _ := majMin(k8sVersion); strings.TrimPrefix(mm, "v") == alternateVersion {
+		containerd = goModuleComponent("containerd", containerdV2Module, containerdModule)
+	}
+
+	return []componentRule{
+		containerd,
+		scriptVarComponent("etcd", versionScriptFile, "ETCD_VERSION"),
+		dockerfileComponent("runc", "hardened-runc"),
+		goModuleComponent("helm-controller", "github.com/k3s-io/helm-controller"),
+		imageComponent("coredns", rke2ImagesFile, "coredns"),
+		imageComponent("metrics-server", rke2ImagesFile, "metrics-server"),
+		imageComponent("ingress-nginx", rke2ImagesFile, "nginx-ingress-controller"),
+		imageComponent("flannel", rke2ImagesFile, "flannel"),
+		imageComponent("canal-calico", rke2ImagesFile, "hardened-calico"),
+		imageComponent("calico", rke2ImagesFile, "calico-node"),
+		imageComponent("cilium", rke2ImagesFile, "cilium-cilium"),
+		imageComponent("multus", rke2ImagesFile, "multus-cni"),
+		optionalComponent(imageComponent("traefik", rke2ImagesFile, "hardened-traefik")),
+		chartComponent("rke2-cilium"),
+		chartComponent("rke2-canal"),
+		chartComponent("rke2-calico"),
+		chartComponent("rke2-calico-crd"),
+		chartComponent("rke2-coredns"),
+		chartComponent("rke2-ingress-nginx"),
+		chartComponent("rke2-metrics-server"),
+		optionalComponent(chartComponent("rancher-vsphere-csi")),
+		optionalComponent(chartComponent("rancher-vsphere-cpi")),
+		optionalComponent(chartComponent("harvester-cloud-provider")),
+		optionalComponent(chartComponent("harvester-csi-driver")),
+		optionalComponent(chartComponent("rke2-snapshot-controller")),
+		optionalComponent(chartComponent("rke2-snapshot-controller-crd")),
+		optionalComponent(chartComponent("rke2-snapshot-validation-webhook")),
+		optionalComponent(chartComponent("rke2-traefik")),
+		optionalComponent(chartComponent("rke2-traefik-crd")),
+	}
+}
+
+// k3sComponentRules are the components of a k3s release of the Kubernetes version
+func k3sComponentRules(k8sVersion string) []componentRule {
+	containerd := goModuleComponent("containerd", containerdV2Module, containerdModule)
+	if semver.Compare(k8sVersion, "v1.24.0") == 1 && semver.Compare(k8sVersion, "v1.26.5") == -1 {
+		containerd = scriptVarComponent("containerd", versionScriptFile, "VERSION_CONTAINERD")
+	}
+	runc := goModuleComponent("runc", "github.com/opencontainers/runc")
+	if mm, _ := majMin(k8sVersion); strings.TrimPrefix(mm, "v") == alternateVersion {
+		runc = scriptVarComponent("runc", versionScriptFile, "VERSION_RUNC")
+	}
+
+	return []componentRule{
+		containerd,
+		runc,
+		goModuleComponent("kine", "github.com/k3s-io/kine"),
+		goModuleComponent("etcd", "go.etcd.io/etcd/api/v3"),
+		goModuleComponent("flannel", "github.com/flannel-io/flannel"),
+		goModuleComponent("helm-controller", "github.com/k3s-io/helm-controller"),
+		goModuleComponent("go-sqlite3", sqliteModule),
+		imageComponent("coredns", k3sImagesFile, "coredns"),
+		imageComponent("metrics-server", k3sImagesFile, "metrics-server"),
+		imageComponent("traefik", k3sImagesFile, "traefik"),
+		imageComponent("local-path-provisioner", k3sImagesFile, "local-path-provisioner"),
+	}
+}
+
+// sqliteComponentRules resolve the SQLite version go-sqlite3 is built with
+var sqliteComponentRules = []componentRule{
+	linesComponent("sqlite", sqliteBindingFile, func(line string) string {
+		if submatch := sqliteVersionRegex.FindStringSubmatch(line); submatch != nil {
+			return submatch[1]
+		}
+		return ""
+	}),
+}
+
+// ResolveRKE2Components resolves the versions of the components of the rke2
+// release from the files of the rke2 repository at the release tag
+func ResolveRKE2Components(source ComponentSource, version string) ([]Component, error) {
+	return resolveComponents(source, rke2ComponentRules(k8sVersion(version)))
+}
+
+// ResolveK3sComponents resolves the versions of the components of the k3s
+// release from the files of the k3s repository at the release tag
+func ResolveK3sComponents(source ComponentSource, version string) ([]Component, error) {
+	return resolveComponents(source, k3sComponentRules(k8sVersion(version)))
+}
+
+// k8sVersion returns the Kubernetes version of a k3s or rke2 version, without
+// the rc and the k3s or rke2 suffix
+func k8sVersion(version string) string {
+	version, _, _ = strings.Cut(version, "+")
+	if idx := strings.Index(version, "-rc"); idx != -1 {
+		version = version[:idx]
+	}
+	return version
+}
@@ -0,0 +1,117 @@
+package release
+
+import (
+	"fmt"
+	"strings"
+)
+
+// diffLine is a line of a diff, op is ' ' for the lines in both texts, '-'
+// for the lines only in the first one and '+' for the lines only in the second
+type diffLine struct {
+	op   byte
+	text string
+}
+
+// diffLines returns the lines of a and b along with how they changed, based
+// on the longest common subsequence of both
+func diffLines(a, b []string) []diffLine {
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	diff := make([]diffLine, 0, len(a)+len(b))
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			diff = append(diff, diffLine{' ', a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			diff = append(diff, diffLine{'-', a[i]})
+			i++
+		default:
+			diff = append(diff, diffLine{'+', b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		diff = append(diff, diffLine{'-', a[i]})
+	}
+	for ; j < len(b); j++ {
+		diff = append(diff, diffLine{'+', b[j]})
+	}
+
+	return diff
+}
+
+// UnifiedDiff renders the changes between a and b as a unified diff with
+// three lines of context, or returns an empty string if there are none. Line
+// endings and trailing whitespace are ignored.
+func UnifiedDiff(aName, bName, a, b string) string {
+	const contextLines = 3
+
+	splitLines := func(s string) []string {
+		lines := strings.Split(strings.TrimSpace(strings.ReplaceAll(s, "\r\n", "\n")), "\n")
+		for i, line := range lines {
+			lines[i] = strings.TrimRight(line, " \t")
+		}
+		return lines
+	}
+	diff := diffLines(splitLines(a), splitLines(b))
+
+	var changed []int
+	for i, d := range diff {
+		if d.op != ' ' {
+			changed = append(changed, i)
+		}
+	}
+	if len(changed) == 0 {
+		return ""
+	}
+
+	var sb strings.Builder
+	sb.WriteString("--- " + aName + "\n+++ " + bName + "\n")
+
+	// aLine and bLine are the line numbers, in a and b, of each line of the diff
+	aLine, bLine := make([]int, len(diff)+1), make([]int, len(diff)+1)
+	aLine[0], bLine[0] = 1, 1
+	for i, d := range diff {
+		aLine[i+1], bLine[i+1] = aLine[i], bLine[i]
+		if d.op != '+' {
+			aLine[i+1]++
+		}
+		if d.op != '-' {
+			bLine[i+1]++
+		}
+	}
+
+	for c := 0; c < len(changed); {
+		start := max(changed[c]-contextLines, 0)
+		end := changed[c]
+		// changes closer than twice the context share the hunk
+		for c < len(changed) && changed[c] <= end+2*contextLines {
+			end = changed[c]
+			c++
+		}
+		end = min(end+contextLines, len(diff)-1)
+
+		aCount, bCount := aLine[end+1]-aLine[start], bLine[end+1]-bLine[start]
+		fmt.Fprintf(&sb, "@@ -%d,%d +%d,%d @@\n", aLine[start], aCount, bLine[start], bCount)
+		for _, d := range diff[start : end+1] {
+			sb.WriteString(string(d.op) + d.text + "\n")
+		}
+	}
+
+	return sb.String()
+}
@@ -7,7 +7,9 @@ import (
 	"io"
 	"io/fs"
 	"net/http"
+	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
@@ -16,13 +18,14 @@ import (
 
 // FS implements fs.FS for GitHub release assets
 type FS struct {
-	ctx     context.Context
-	client  *github.Client
-	owner   string
-	repo    string
-	tag     string
-	release *github.RepositoryRelease
-	assets  map[string]*github.ReleaseAsset
+	ctx      context.Context
+	client   *github.Client
+	owner    string
+	repo     string
+	tag      string
+	release  *github.RepositoryRelease
+	assets   map[string]*github.ReleaseAsset
+	cacheDir string
 }
 
 // NewFS creates a new filesystem for accessing GitHub release assets
@@ -54,6 +57,19 @@ func NewFS(ctx context.Context, client *github.Client, owner, repo, tag string)
 	return fs, nil
 }
 
+// WithCache enables an on-disk cache for the downloaded assets. Assets are
+// keyed by their ID and last update time, so a re-uploaded asset is never
+// served from a stale cache entry.
+func (r *FS) WithCache(dir string) *FS {
+	r.cacheDir = dir
+	return r
+}
+
+// cachePath returns the path of the cache entry for the given asset
+func (r *FS) cachePath(asset *github.ReleaseAsset) string {
+	return filepath.Join(r.cacheDir, strconv.FormatInt(asset.GetID(), 10)+"-"+strconv.FormatInt(asset.GetUpdatedAt().Unix(), 10))
+}
+
 // Open implements fs.FS for a GitHub release, treating assets as a filesystem
 func (r *FS) Open(name string) (fs.File, error) {
 	// Clean and normalize the path
@@ -68,33 +84,205 @@ func (r *FS) Open(name string) (fs.File, error) {
 		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
 	}
 
-	rc, _, err := r.client.Repositories.DownloadReleaseAsset(r.ctx, r.owner, r.repo, asset.GetID(), http.DefaultClient)
+	if r.cacheDir == "" {
+		return &releaseFile{fs: r, asset: asset}, nil
+	}
+
+	if f, err := os.Open(r.cachePath(asset)); err == nil {
+		return &cachedFile{File: f, asset: asset}, nil
+	}
+
+	if err := os.MkdirAll(r.cacheDir, 0o755); err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+
+	tmp, err := os.CreateTemp(r.cacheDir, "download-*")
 	if err != nil {
 		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
 	}
 
-	return &releaseFile{
-		asset:      asset,
-		readCloser: rc,
-	}, nil
+	return &releaseFile{fs: r, asset: asset, cache: tmp}, nil
+}
+
+// download requests the asset content starting at offset. If end is
+// negative, the content is read until the end of the asset.
+func (r *FS) download(asset *github.ReleaseAsset, offset, end int64) (io.ReadCloser, error) {
+	req, err := r.client.NewRequest(http.MethodGet, fmt.Sprintf("repos/%s/%s/releases/assets/%d", r.owner, r.repo, asset.GetID()), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/octet-stream")
+
+	ranged := offset > 0 || end >= 0
+	if ranged {
+		byteRange := "bytes=" + strconv.FormatInt(offset, 10) + "-"
+		if end >= 0 {
+			byteRange += strconv.FormatInt(end, 10)
+		}
+		req.Header.Set("Range", byteRange)
+	}
+
+	// the API redirects to the storage backend, the range header is kept
+	// by the http client when following it
+	res, err := r.client.BareDo(r.ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	if ranged && res.StatusCode != http.StatusPartialContent {
+		res.Body.Close()
+		return nil, errors.New("range requests not supported for asset: " + asset.GetName())
+	}
+
+	return res.Body, nil
 }
 
-// releaseFile implements fs.File for a GitHub release asset
+// releaseFile implements fs.File for a GitHub release asset. Sequential
+// reads are served from a single download, while Seek and ReadAt use HTTP
+// range requests so large assets can be partially read.
 type releaseFile struct {
-	asset      *github.ReleaseAsset
-	readCloser io.ReadCloser
+	fs     *FS
+	asset  *github.ReleaseAsset
+	offset int64
+	body   io.ReadCloser
+
+	// cache is filled while the asset is read sequentially from the start,
+	// and moved into the cache directory once it was read completely.
+	cache *os.File
 }
 
 func (f *releaseFile) Stat() (fs.FileInfo, error) {
 	return &releaseFileInfo{asset: f.asset}, nil
 }
 
+func (f *releaseFile) size() int64 {
+	return int64(f.asset.GetSize())
+}
+
 func (f *releaseFile) Read(b []byte) (int, error) {
-	return f.readCloser.Read(b)
+	if f.body == nil {
+		if f.offset > 0 && f.offset >= f.size() {
+			return 0, io.EOF
+		}
+		body, err := f.fs.download(f.asset, f.offset, -1)
+		if err != nil {
+			return 0, err
+		}
+		f.body = body
+	}
+
+	n, err := f.body.Read(b)
+	if n > 0 && f.cache != nil {
+		if _, werr := f.cache.Write(b[:n]); werr != nil {
+			f.discardCache()
+		}
+	}
+	f.offset += int64(n)
+
+	if err == io.EOF && f.cache != nil {
+		f.commitCache()
+	}
+
+	return n, err
+}
+
+func (f *releaseFile) Seek(offset int64, whence int) (int64, error) {
+	var abs int64
+	switch whence {
+	case io.SeekStart:
+		abs = offset
+	case io.SeekCurrent:
+		abs = f.offset + offset
+	case io.SeekEnd:
+		abs = f.size() + offset
+	default:
+		return 0, errors.New("invalid whence")
+	}
+	if abs < 0 {
+		return 0, errors.New("negative position")
+	}
+
+	if abs != f.offset {
+		if f.body != nil {
+			f.body.Close()
+			f.body = nil
+		}
+		// the cache only holds complete assets
+		f.discardCache()
+		f.offset = abs
+	}
+
+	return abs, nil
+}
+
+func (f *releaseFile) ReadAt(b []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("negative offset")
+	}
+	if off >= f.size() {
+		return 0, io.EOF
+	}
+
+	end := off + int64(len(b))
+	if end > f.size() {
+		end = f.size()
+	}
+
+	body, err := f.fs.download(f.asset, off, end-1)
+	if err != nil {
+		return 0, err
+	}
+	defer body.Close()
+
+	n, err := io.ReadFull(body, b[:end-off])
+	if err != nil {
+		return n, err
+	}
+	if n < len(b) {
+		return n, io.EOF
+	}
+
+	return n, nil
 }
 
 func (f *releaseFile) Close() error {
-	return f.readCloser.Close()
+	f.discardCache()
+	if f.body == nil {
+		return nil
+	}
+	return f.body.Close()
+}
+
+func (f *releaseFile) commitCache() {
+	if f.offset != f.size() {
+		f.discardCache()
+		return
+	}
+	tmp := f.cache.Name()
+	f.cache.Close()
+	f.cache = nil
+	if err := os.Rename(tmp, f.fs.cachePath(f.asset)); err != nil {
+		os.Remove(tmp)
+	}
+}
+
+func (f *releaseFile) discardCache() {
+	if f.cache == nil {
+		return
+	}
+	f.cache.Close()
+	os.Remove(f.cache.Name())
+	f.cache = nil
+}
+
+// cachedFile implements fs.File for a release asset read from the cache
+type cachedFile struct {
+	*os.File
+	asset *github.ReleaseAsset
+}
+
+func (f *cachedFile) Stat() (fs.FileInfo, error) {
+	return &releaseFileInfo{asset: f.asset}, nil
 }
 
 // releaseFileInfo implements fs.FileInfo for a GitHub release asset
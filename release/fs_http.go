@@ -0,0 +1,102 @@
+package release
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// HTTPFS implements fs.FS for release assets served under a plain HTTP base
+// URL, such as an artifacts mirror like prime.ribs.rancher.io.
+type HTTPFS struct {
+	ctx     context.Context
+	client  *http.Client
+	baseURL string
+}
+
+// NewHTTPFS creates a filesystem where every asset is fetched from baseURL/name.
+// If client is nil, http.DefaultClient is used.
+func NewHTTPFS(ctx context.Context, client *http.Client, baseURL string) (*HTTPFS, error) {
+	if baseURL == "" {
+		return nil, errors.New("invalid base url provided")
+	}
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	return &HTTPFS{
+		ctx:     ctx,
+		client:  client,
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+	}, nil
+}
+
+// Open implements fs.FS by issuing a GET request for the asset
+func (h *HTTPFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) || name == "." {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+
+	req, err := http.NewRequestWithContext(h.ctx, http.MethodGet, h.baseURL+"/"+name, nil)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+
+	res, err := h.client.Do(req)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+
+	switch res.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound, http.StatusForbidden:
+		// s3 backed mirrors answer 403 for keys that don't exist
+		res.Body.Close()
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	default:
+		res.Body.Close()
+		return nil, &fs.PathError{Op: "open", Path: name, Err: errors.New("unexpected status code: " + strconv.Itoa(res.StatusCode))}
+	}
+
+	info := &httpFileInfo{
+		name: name,
+		size: res.ContentLength,
+	}
+	if lastModified, err := http.ParseTime(res.Header.Get("Last-Modified")); err == nil {
+		info.modTime = lastModified
+	}
+
+	return &httpFile{
+		info:       info,
+		readCloser: res.Body,
+	}, nil
+}
+
+// httpFile implements fs.File for an asset served over HTTP
+type httpFile struct {
+	info       *httpFileInfo
+	readCloser io.ReadCloser
+}
+
+func (f *httpFile) Stat() (fs.FileInfo, error) { return f.info, nil }
+func (f *httpFile) Read(b []byte) (int, error) { return f.readCloser.Read(b) }
+func (f *httpFile) Close() error               { return f.readCloser.Close() }
+
+// httpFileInfo implements fs.FileInfo for an asset served over HTTP
+type httpFileInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+}
+
+func (i *httpFileInfo) Name() string       { return i.name }
+func (i *httpFileInfo) Size() int64        { return i.size }
+func (i *httpFileInfo) Mode() fs.FileMode  { return 0o444 } // read only
+func (i *httpFileInfo) ModTime() time.Time { return i.modTime }
+func (i *httpFileInfo) IsDir() bool        { return false }
+func (i *httpFileInfo) Sys() interface{}   { return nil }
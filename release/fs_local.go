@@ -0,0 +1,220 @@
+package release
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"time"
+)
+
+// NewDirFS creates a filesystem for release assets stored in a local directory
+func NewDirFS(dir string) (fs.FS, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, errors.New("not a directory: " + dir)
+	}
+
+	return os.DirFS(dir), nil
+}
+
+// TarballFS implements fs.FS for release assets bundled in a .tar.gz file.
+// Only the headers are indexed in memory, file contents are read from the
+// archive every time they are opened.
+type TarballFS struct {
+	path    string
+	prefix  string
+	entries map[string]tarballEntry
+}
+
+// tarballEntry is the header of a file and its position in the archive. If
+// the archive has the same name more than once, the last one is kept, like
+// extracting it does.
+type tarballEntry struct {
+	hdr   *tar.Header
+	index int
+}
+
+// NewTarballFS indexes the given .tar.gz bundle. If every file in the bundle
+// is under the same top level directory, that directory is treated as the root.
+func NewTarballFS(tarball string) (*TarballFS, error) {
+	t := &TarballFS{
+		path:    tarball,
+		entries: make(map[string]tarballEntry),
+	}
+
+	roots := make(map[string]bool)
+
+	if err := t.walk(func(index int, hdr *tar.Header, _ io.Reader) (bool, error) {
+		if hdr.Typeflag != tar.TypeReg {
+			return false, nil
+		}
+		name := path.Clean(strings.TrimPrefix(hdr.Name, "./"))
+		root, _, _ := strings.Cut(name, "/")
+		if root == name {
+			root = ""
+		}
+		roots[root] = true
+		t.entries[name] = tarballEntry{hdr: hdr, index: index}
+		return false, nil
+	}); err != nil {
+		return nil, err
+	}
+
+	if len(roots) == 1 {
+		for root := range roots {
+			if root != "" {
+				t.prefix = root + "/"
+			}
+		}
+	}
+
+	return t, nil
+}
+
+// walk calls fn for every entry in the archive, along with its position,
+// until fn returns true
+func (t *TarballFS) walk(fn func(index int, hdr *tar.Header, r io.Reader) (bool, error)) error {
+	f, err := os.Open(t.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+
+	tr := tar.NewReader(gz)
+	for index := 0; ; index++ {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		done, err := fn(index, hdr, tr)
+		if err != nil || done {
+			return err
+		}
+	}
+}
+
+// Open implements fs.FS for a tarball, reading the archive until the entry is found
+func (t *TarballFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	if name == "." {
+		entries, err := t.ReadDir(name)
+		if err != nil {
+			return nil, err
+		}
+		return &tarballDir{entries: entries}, nil
+	}
+
+	entry, ok := t.entries[t.prefix+name]
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+
+	// the gzip stream can't be seeked, so the entry is copied out before the
+	// archive is closed. Image lists and checksums are small, large files
+	// should be extracted and read with NewDirFS instead.
+	var data []byte
+	if err := t.walk(func(index int, _ *tar.Header, r io.Reader) (bool, error) {
+		if index != entry.index {
+			return false, nil
+		}
+		var err error
+		data, err = io.ReadAll(r)
+		return true, err
+	}); err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+
+	return &tarballFile{
+		info:   entry.hdr.FileInfo(),
+		Reader: bytes.NewReader(data),
+	}, nil
+}
+
+// ReadDir lists the files at the root of the tarball, sorted by name
+func (t *TarballFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if name != "." {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+
+	var entries []fs.DirEntry
+	for entryName, entry := range t.entries {
+		rel := strings.TrimPrefix(entryName, t.prefix)
+		if strings.Contains(rel, "/") {
+			continue
+		}
+		entries = append(entries, fs.FileInfoToDirEntry(entry.hdr.FileInfo()))
+	}
+	slices.SortFunc(entries, func(a, b fs.DirEntry) int {
+		return strings.Compare(a.Name(), b.Name())
+	})
+
+	return entries, nil
+}
+
+// tarballFile implements fs.File for a tarball entry
+type tarballFile struct {
+	info fs.FileInfo
+	*bytes.Reader
+}
+
+func (f *tarballFile) Stat() (fs.FileInfo, error) { return f.info, nil }
+func (f *tarballFile) Close() error               { return nil }
+
+// tarballDir implements fs.ReadDirFile for the root of a tarball
+type tarballDir struct {
+	entries []fs.DirEntry
+	offset  int
+}
+
+func (d *tarballDir) Stat() (fs.FileInfo, error) { return tarballDirInfo{}, nil }
+func (d *tarballDir) Close() error               { return nil }
+
+func (d *tarballDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: ".", Err: errors.New("is a directory")}
+}
+
+// ReadDir returns the next n entries, or all the remaining ones if n <= 0
+func (d *tarballDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	remaining := d.entries[d.offset:]
+	if n <= 0 {
+		d.offset = len(d.entries)
+		return remaining, nil
+	}
+	if len(remaining) == 0 {
+		return nil, io.EOF
+	}
+	n = min(n, len(remaining))
+	d.offset += n
+	return remaining[:n], nil
+}
+
+// tarballDirInfo is the info of the root of a tarball
+type tarballDirInfo struct{}
+
+func (tarballDirInfo) Name() string       { return "." }
+func (tarballDirInfo) Size() int64        { return 0 }
+func (tarballDirInfo) Mode() fs.FileMode  { return fs.ModeDir | 0o555 }
+func (tarballDirInfo) ModTime() time.Time { return time.Time{} }
+func (tarballDirInfo) IsDir() bool        { return true }
+func (tarballDirInfo) Sys() any           { return nil }
@@ -0,0 +1,273 @@
+package release
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/google/go-github/v81/github"
+)
+
+const testImageList = "rancher/rke2-runtime:v1.23.4-rke2r1\n"
+
+func writeTestTarball(t *testing.T, files map[string]string) string {
+	t.Helper()
+
+	tarball := filepath.Join(t.TempDir(), "assets.tar.gz")
+	f, err := os.Create(tarball)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+	for name, content := range files {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: int64(len(content)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return tarball
+}
+
+func TestTarballFS(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+	}{
+		{
+			name:  "files at root",
+			files: map[string]string{"rke2-images-all.linux-amd64.txt": testImageList, "sha256sum-amd64.txt": ""},
+		},
+		{
+			name:  "files under a version directory",
+			files: map[string]string{"v1.23.4+rke2r1/rke2-images-all.linux-amd64.txt": testImageList, "v1.23.4+rke2r1/sha256sum-amd64.txt": ""},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tfs, err := NewTarballFS(writeTestTarball(t, tt.files))
+			if err != nil {
+				t.Fatalf("NewTarballFS() error = %v", err)
+			}
+
+			b, err := fs.ReadFile(tfs, "rke2-images-all.linux-amd64.txt")
+			if err != nil {
+				t.Fatalf("ReadFile() error = %v", err)
+			}
+			if string(b) != testImageList {
+				t.Errorf("ReadFile() = %q, want %q", b, testImageList)
+			}
+
+			if _, err := tfs.Open("missing.txt"); !errors.Is(err, fs.ErrNotExist) {
+				t.Errorf("Open() error = %v, want fs.ErrNotExist", err)
+			}
+
+			entries, err := fs.ReadDir(tfs, ".")
+			if err != nil {
+				t.Fatalf("ReadDir() error = %v", err)
+			}
+			if len(entries) != 2 {
+				t.Errorf("ReadDir() returned %d entries, want 2", len(entries))
+			}
+
+			if err := fstest.TestFS(tfs, "rke2-images-all.linux-amd64.txt", "sha256sum-amd64.txt"); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestTarballFSDuplicateNames(t *testing.T) {
+	tarball := filepath.Join(t.TempDir(), "assets.tar.gz")
+	f, err := os.Create(tarball)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	// the last entry of a name wins, like extracting the archive
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+	for _, content := range []string{"old\n", testImageList} {
+		if err := tw.WriteHeader(&tar.Header{Name: "rke2-images-all.linux-amd64.txt", Mode: 0o644, Size: int64(len(content)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	tfs, err := NewTarballFS(tarball)
+	if err != nil {
+		t.Fatalf("NewTarballFS() error = %v", err)
+	}
+	file, err := tfs.Open("rke2-images-all.linux-amd64.txt")
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer file.Close()
+	b, err := io.ReadAll(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != testImageList || info.Size() != int64(len(testImageList)) {
+		t.Errorf("Open() = %q of size %d, want %q", b, info.Size(), testImageList)
+	}
+}
+
+func TestHTTPFS(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/rke2/v1.23.4+rke2r1/rke2-images-all.linux-amd64.txt" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(testImageList))
+	}))
+	defer server.Close()
+
+	hfs, err := NewHTTPFS(context.Background(), server.Client(), server.URL+"/rke2/v1.23.4+rke2r1/")
+	if err != nil {
+		t.Fatalf("NewHTTPFS() error = %v", err)
+	}
+
+	f, err := hfs.Open("rke2-images-all.linux-amd64.txt")
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer f.Close()
+
+	b, err := io.ReadAll(f)
+	if err != nil {
+		t.Fatalf("ReadAll() error = %v", err)
+	}
+	if string(b) != testImageList {
+		t.Errorf("Read() = %q, want %q", b, testImageList)
+	}
+
+	if _, err := hfs.Open("missing.txt"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Open() error = %v, want fs.ErrNotExist", err)
+	}
+}
+
+func TestFSCacheAndRanges(t *testing.T) {
+	const content = "rancher/rke2-runtime:v1.23.4-rke2r1\nrancher/rke2-cloud-provider:v1.23.4-build20220228\n"
+	updatedAt := time.Date(2022, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	var downloads atomic.Int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/rancher/rke2/releases/tags/v1.23.4+rke2r1", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"id":1,"tag_name":"v1.23.4+rke2r1","assets":[{"id":42,"name":"rke2-images-all.linux-amd64.txt","size":` +
+			strconv.Itoa(len(content)) + `,"updated_at":"` + updatedAt.Format(time.RFC3339) + `"}]}`))
+	})
+	mux.HandleFunc("/repos/rancher/rke2/releases/assets/42", func(w http.ResponseWriter, r *http.Request) {
+		downloads.Add(1)
+		http.ServeContent(w, r, "", updatedAt, strings.NewReader(content))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client := github.NewClient(server.Client())
+	client.BaseURL, _ = url.Parse(server.URL + "/")
+
+	cacheDir := t.TempDir()
+	rfs, err := NewFS(context.Background(), client, "rancher", "rke2", "v1.23.4+rke2r1")
+	if err != nil {
+		t.Fatalf("NewFS() error = %v", err)
+	}
+	rfs.WithCache(cacheDir)
+
+	f, err := rfs.Open("rke2-images-all.linux-amd64.txt")
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+
+	readerAt, ok := f.(io.ReaderAt)
+	if !ok {
+		t.Fatal("release file doesn't implement io.ReaderAt")
+	}
+	b := make([]byte, 12)
+	if _, err := readerAt.ReadAt(b, 8); err != nil {
+		t.Fatalf("ReadAt() error = %v", err)
+	}
+	if string(b) != content[8:20] {
+		t.Errorf("ReadAt() = %q, want %q", b, content[8:20])
+	}
+
+	b, err = io.ReadAll(f)
+	if err != nil {
+		t.Fatalf("ReadAll() error = %v", err)
+	}
+	f.Close()
+	if string(b) != content {
+		t.Errorf("ReadAll() = %q, want %q", b, content)
+	}
+
+	// the second read is served from the cache
+	b, err = fs.ReadFile(rfs, "rke2-images-all.linux-amd64.txt")
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	if string(b) != content {
+		t.Errorf("ReadFile() = %q, want %q", b, content)
+	}
+	if n := downloads.Load(); n != 2 {
+		t.Errorf("expected 2 downloads (one ranged, one full), got %d", n)
+	}
+
+	// seeking streams from the new offset without populating the cache
+	os.RemoveAll(cacheDir)
+	f, err = rfs.Open("rke2-images-all.linux-amd64.txt")
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer f.Close()
+	if _, err := f.(io.Seeker).Seek(-10, io.SeekEnd); err != nil {
+		t.Fatalf("Seek() error = %v", err)
+	}
+	b, err = io.ReadAll(f)
+	if err != nil {
+		t.Fatalf("ReadAll() error = %v", err)
+	}
+	if string(b) != content[len(content)-10:] {
+		t.Errorf("ReadAll() after Seek() = %q, want %q", b, content[len(content)-10:])
+	}
+	if entries, _ := os.ReadDir(cacheDir); len(entries) != 0 {
+		t.Errorf("expected partially read asset not to be cached, found %d entries", len(entries))
+	}
+}
@@ -0,0 +1,138 @@
+package k3s
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	ecmConfig "github.com/rancher/ecm-distro-tools/cmd/release/config"
+	ecmExec "github.com/rancher/ecm-distro-tools/exec"
+)
+
+// localTagTools are the tools the tag script needs besides Go
+var localTagTools = []string{"bash", "git", "make", "rsync", "tar", "gzip", "curl"}
+
+// tagBackend runs the tag script of the kubernetes repository, which builds
+// the k3s-io/kubernetes release and prints the commands to push its tags
+type tagBackend interface {
+	// prepare sets up the backend to build with the Go version of k8s
+	prepare(r *ecmConfig.K3sRelease, goVersion string) error
+	// runTagScript runs the tag script and returns its output
+	runTagScript(r *ecmConfig.K3sRelease, gitConfigFile string) (string, error)
+}
+
+// newTagBackend returns the backend set in the config of the release, docker
+// by default
+func newTagBackend(r *ecmConfig.K3sRelease) (tagBackend, error) {
+	switch r.Backend {
+	case "", ecmConfig.K3sBackendDocker:
+		return &dockerTagBackend{}, nil
+	case ecmConfig.K3sBackendLocal:
+		return &localTagBackend{}, nil
+	default:
+		return nil, errors.New("invalid backend " + r.Backend + ", must be one of: " + ecmConfig.K3sBackendDocker + ", " + ecmConfig.K3sBackendLocal)
+	}
+}
+
+// dockerTagBackend runs the tag script in a golang image with the tools the
+// script needs, which requires a Docker daemon
+type dockerTagBackend struct {
+	image string
+}
+
+func (b *dockerTagBackend) prepare(r *ecmConfig.K3sRelease, goVersion string) error {
+	image, err := buildGoWrapper(r, goVersion)
+	if err != nil {
+		return err
+	}
+	b.image = image
+	return nil
+}
+
+func (b *dockerTagBackend) runTagScript(r *ecmConfig.K3sRelease, gitConfigFile string) (string, error) {
+	const containerK8sPath = "/home/go/src/kubernetes"
+	const containerGoCachePath = "/home/go/.cache"
+	uid := strconv.Itoa(os.Getuid())
+	gid := strconv.Itoa(os.Getgid())
+
+	gopath, err := ecmExec.RunCommand(r.Workspace, "go", "env", "GOPATH")
+	if err != nil {
+		return "", err
+	}
+	gopath = strings.Trim(gopath, "\n")
+	fmt.Println("gopath: " + gopath)
+
+	k8sDir := filepath.Join(r.Workspace, "kubernetes")
+
+	// prep the docker run command
+	args := []string{
+		"run",
+		"-u", uid + ":" + gid,
+		"-v", gopath + ":/home/go:rw",
+		"-v", gitConfigFile + ":/home/go/.gitconfig:rw",
+		"-v", k8sDir + ":" + containerK8sPath + ":rw",
+		"-v", gopath + "/.cache:" + containerGoCachePath + ":rw",
+		"-e", "HOME=/home/go",
+		"-e", "GOCACHE=" + containerGoCachePath,
+		"-w", containerK8sPath,
+		b.image,
+		"./tag.sh", r.NewK8sVersion + "-" + r.NewSuffix,
+	}
+
+	fmt.Println("running tag script")
+	return ecmExec.RunCommand(k8sDir, "docker", args...)
+}
+
+// localTagBackend runs the tag script with the local tools, which must include
+// the Go version of k8s
+type localTagBackend struct{}
+
+func (b *localTagBackend) prepare(r *ecmConfig.K3sRelease, goVersion string) error {
+	fmt.Println("verifying the local tools")
+	var missing []string
+	for _, tool := range append([]string{"go"}, localTagTools...) {
+		if _, err := exec.LookPath(tool); err != nil {
+			missing = append(missing, tool)
+		}
+	}
+	if len(missing) > 0 {
+		return errors.New("the local backend requires " + strings.Join(missing, ", ") + " in the PATH")
+	}
+
+	// the toolchain directive of go.mod mustn't switch to another Go version
+	localVersion, err := ecmExec.RunCommandWithEnv(r.Workspace, []string{"GOTOOLCHAIN=local"}, "go", "env", "GOVERSION")
+	if err != nil {
+		return err
+	}
+
+	return checkLocalGoVersion(localVersion, goVersion, r.NewK8sVersion)
+}
+
+// checkLocalGoVersion verifies the local Go version, as printed by go env
+// GOVERSION, is the Go version of the k8s version
+func checkLocalGoVersion(localVersion, goVersion, k8sVersion string) error {
+	fields := strings.Fields(localVersion)
+	if len(fields) == 0 {
+		return errors.New("failed to get the local Go version")
+	}
+	if strings.TrimPrefix(fields[0], "go") != goVersion {
+		return errors.New("local Go is " + fields[0] + " but k8s " + k8sVersion + " requires go" + goVersion)
+	}
+
+	return nil
+}
+
+func (b *localTagBackend) runTagScript(r *ecmConfig.K3sRelease, gitConfigFile string) (string, error) {
+	k8sDir := filepath.Join(r.Workspace, "kubernetes")
+	env := []string{
+		"GIT_CONFIG_GLOBAL=" + gitConfigFile,
+		"GOTOOLCHAIN=local",
+	}
+
+	fmt.Println("running tag script")
+	return ecmExec.RunCommandWithEnv(k8sDir, env, "./tag.sh", r.NewK8sVersion+"-"+r.NewSuffix)
+}
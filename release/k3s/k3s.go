@@ -44,11 +44,9 @@ ARG UID=1000
 ARG GID=1000
 RUN addgroup -S -g $GID ecmgroup && adduser -S -G ecmgroup -u $UID user
 USER user`
-	updateK3sScriptName       = "update_k3s_references.sh"
-	updateK3sReferencesScript = `#!/bin/bash
+	prepareK3sBranchScriptName = "prepare_k3s_branch.sh"
+	prepareK3sBranchScript     = `#!/bin/bash
 set -ex
-OS=$(uname -s)
-DRY_RUN={{ .K3s.DryRun }}
 BRANCH_NAME={{ .K3s.NewK8sVersion }}-{{ .K3s.NewSuffix }}
 cd {{ .K3s.Workspace }}
 # using ls | grep is not a good idea because it doesn't support non-alphanumeric filenames, but since we're only ever checking 'k3s' it isn't a problem https://www.shellcheck.net/wiki/SC2010
@@ -59,46 +57,35 @@ git fetch upstream
 git stash
 git branch -D "${BRANCH_NAME}" &>/dev/null || true
 git checkout -B "${BRANCH_NAME}" upstream/{{.K3s.ReleaseBranch}}
-git clean -xfd
-
-case ${OS} in
-Darwin)
-	sed -Ei '' "\|github.com/k3s-io/kubernetes| s|{{ replaceAll .K3s.OldK8sVersion "." "\\." }}-{{ .K3s.OldSuffix }}|{{ replaceAll .K3s.NewK8sVersion "." "\\." }}-{{ .K3s.NewSuffix }}|" go.mod
-	sed -Ei '' "s/k8s.io\/kubernetes v\S+/k8s.io\/kubernetes {{ replaceAll .K3s.NewK8sVersion "." "\\." }}/" go.mod
-	sed -Ei '' "s/{{ replaceAll .K3s.OldK8sClient "." "\\." }}/{{ replaceAll .K3s.NewK8sClient "." "\\." }}/g" go.mod # This should only change ~6 lines in go.mod
-	sed -Ei '' "s/golang:.*-/golang:{{ .K3s.NewGoVersion }}-/g" Dockerfile.*
-	sed -Ei '' "s/go-version:.*$/go-version:\ '{{ .K3s.NewGoVersion }}'/g" .github/workflows/integration.yaml .github/workflows/unitcoverage.yaml
-	;;
-Linux)
-	sed -Ei "\|github.com/k3s-io/kubernetes| s|{{ replaceAll .K3s.OldK8sVersion "." "\\." }}-{{ .K3s.OldSuffix }}|{{ replaceAll .K3s.NewK8sVersion "." "\\." }}-{{ .K3s.NewSuffix }}|" go.mod
-	sed -Ei "s/k8s.io\/kubernetes v\S+/k8s.io\/kubernetes {{ replaceAll .K3s.NewK8sVersion "." "\\." }}/" go.mod
-	sed -Ei "s/{{ replaceAll .K3s.OldK8sClient "." "\\." }}/{{ replaceAll .K3s.NewK8sClient "." "\\." }}/g" go.mod # This should only change ~6 lines in go.mod
-	sed -Ei "s/golang:.*-/golang:{{ .K3s.NewGoVersion }}-/g" Dockerfile.*
-	sed -Ei "s/go-version:.*$/go-version:\ '{{ .K3s.NewGoVersion }}'/g" .github/workflows/integration.yaml .github/workflows/unitcoverage.yaml
-	;;
-*)
-	>&2 echo "$(OS) not supported yet"
-	exit 1
-	;;
-esac
-
-go mod tidy
-
-git add go.mod go.sum Dockerfile.* .github/workflows/integration.yaml .github/workflows/unitcoverage.yaml
-	git commit --signoff -m "Update to {{ .K3s.NewK8sVersion }}"
+git clean -xfd`
+	commitK3sReferencesScriptName = "commit_k3s_references.sh"
+	commitK3sReferencesScript     = `#!/bin/bash
+set -ex
+DRY_RUN={{ .K3s.DryRun }}
+BRANCH_NAME={{ .K3s.NewK8sVersion }}-{{ .K3s.NewSuffix }}
+cd {{ .K3s.Workspace }}/k3s
+
+git add go.sum{{ range .Files }} "{{ . }}"{{ end }}
+git commit --signoff -m "Update to {{ .K3s.NewK8sVersion }}"
 if [ "${DRY_RUN}" = false ]; then
 	git push --set-upstream origin "${BRANCH_NAME}" # run git remote -v for your origin
 fi`
 )
 
 type UpdateScriptVars struct {
-	K3s  *ecmConfig.K3sRelease
-	User *ecmConfig.User
+	K3s   *ecmConfig.K3sRelease
+	User  *ecmConfig.User
+	Files []string
 }
 
 // GenerateTags will clone the kubernetes repository, rebase it with the k3s-io fork and
 // generate tags to be pushed
 func GenerateTags(ctx context.Context, ghClient *github.Client, r *ecmConfig.K3sRelease, u *ecmConfig.User, sshKeyPath string) error {
+	fmt.Println("validating release config")
+	if err := validateReleaseRefs(ctx, ghClient, r); err != nil {
+		return errors.New("invalid release config:\n" + err.Error())
+	}
+
 	fmt.Println("setting up k8s remotes")
 	if err := setupK8sRemotes(r, u, sshKeyPath); err != nil {
 		return errors.New("failed to clone and setup remotes for k8s repos: " + err.Error())
@@ -229,15 +216,25 @@ func setupK8sRemotes(r *ecmConfig.K3sRelease, u *ecmConfig.User, sshKeyPath stri
 }
 
 func rebaseAndTag(ctx context.Context, ghClient *github.Client, r *ecmConfig.K3sRelease, u *ecmConfig.User) ([]string, error) {
-	rebaseOut, err := gitRebaseOnto(ctx, ghClient, r)
+	backend, err := newTagBackend(r)
 	if err != nil {
 		return nil, err
 	}
-	fmt.Println(rebaseOut)
-	wrapperImageTag, err := buildGoWrapper(r)
+
+	fmt.Println("getting go version for k8s")
+	goVersion, err := goVersion(r)
+	if err != nil {
+		return nil, err
+	}
+	if err := backend.prepare(r, goVersion); err != nil {
+		return nil, err
+	}
+
+	rebaseOut, err := gitRebaseOnto(ctx, ghClient, r)
 	if err != nil {
 		return nil, err
 	}
+	fmt.Println(rebaseOut)
 
 	// setup gitconfig
 	gitconfigFile, err := setupGitArtifacts(r, u)
@@ -255,7 +252,7 @@ func rebaseAndTag(ctx context.Context, ghClient *github.Client, r *ecmConfig.K3s
 			return nil, err
 		}
 	}
-	out, err := runTagScript(r, gitconfigFile, wrapperImageTag)
+	out, err := backend.runTagScript(r, gitconfigFile)
 	if err != nil {
 		return nil, err
 	}
@@ -374,13 +371,7 @@ func goVersion(r *ecmConfig.K3sRelease) (string, error) {
 	return "", errors.New("can not find Go dependency")
 }
 
-func buildGoWrapper(r *ecmConfig.K3sRelease) (string, error) {
-	fmt.Println("getting go version for k8s")
-	goVersion, err := goVersion(r)
-	if err != nil {
-		return "", err
-	}
-
+func buildGoWrapper(r *ecmConfig.K3sRelease, goVersion string) (string, error) {
 	goImageVersion := fmt.Sprintf("golang:%s-alpine", goVersion)
 	fmt.Println("go image version: " + goImageVersion)
 
@@ -424,40 +415,6 @@ func setupGitArtifacts(r *ecmConfig.K3sRelease, u *ecmConfig.User) (string, erro
 	return gitconfigFile, nil
 }
 
-func runTagScript(r *ecmConfig.K3sRelease, gitConfigFile, wrapperImageTag string) (string, error) {
-	const containerK8sPath = "/home/go/src/kubernetes"
-	const containerGoCachePath = "/home/go/.cache"
-	uid := strconv.Itoa(os.Getuid())
-	gid := strconv.Itoa(os.Getgid())
-
-	gopath, err := ecmExec.RunCommand(r.Workspace, "go", "env", "GOPATH")
-	if err != nil {
-		return "", err
-	}
-	gopath = strings.Trim(gopath, "\n")
-	fmt.Println("gopath: " + gopath)
-
-	k8sDir := filepath.Join(r.Workspace, "kubernetes")
-
-	// prep the docker run command
-	args := []string{
-		"run",
-		"-u", uid + ":" + gid,
-		"-v", gopath + ":/home/go:rw",
-		"-v", gitConfigFile + ":/home/go/.gitconfig:rw",
-		"-v", k8sDir + ":" + containerK8sPath + ":rw",
-		"-v", gopath + "/.cache:" + containerGoCachePath + ":rw",
-		"-e", "HOME=/home/go",
-		"-e", "GOCACHE=" + containerGoCachePath,
-		"-w", containerK8sPath,
-		wrapperImageTag,
-		"./tag.sh", r.NewK8sVersion + "-" + r.NewSuffix,
-	}
-
-	fmt.Println("running tag script")
-	return ecmExec.RunCommand(k8sDir, "docker", args...)
-}
-
 func tagPushLines(out string) []string {
 	var tagCmds []string
 
@@ -585,30 +542,28 @@ func PushTags(ghClient *github.Client, r *ecmConfig.K3sRelease, u *ecmConfig.Use
 	return nil
 }
 
-func UpdateK3sReferences(ctx context.Context, ghClient *github.Client, r *ecmConfig.K3sRelease, u *ecmConfig.User) error {
-	if err := updateK3sReferencesAndPush(r, u); err != nil {
+// UpdateK3sReferences updates the references, pushes them and creates the
+// PR. With review, it asks before committing the changes.
+func UpdateK3sReferences(ctx context.Context, ghClient *github.Client, r *ecmConfig.K3sRelease, u *ecmConfig.User, review bool) error {
+	if _, err := updateK3sReferencesAndPush(r, u, review); err != nil {
 		return err
 	}
 
-	if r.DryRun {
-		fmt.Println("dry run, skipping creating PR")
-		return nil
-	}
-
-	return createK3sReferencesPR(ctx, ghClient, r, u)
+	_, err := createK3sReferencesPR(ctx, ghClient, r, u)
+	return err
 }
 
-func updateK3sReferencesAndPush(r *ecmConfig.K3sRelease, u *ecmConfig.User) error {
+func updateK3sReferencesAndPush(r *ecmConfig.K3sRelease, u *ecmConfig.User, review bool) (string, error) {
 	fmt.Println("verifying if workspace dir exists")
 	if _, err := os.Stat(r.Workspace); err != nil {
 		if !os.IsNotExist(err) {
-			return err
+			return "", err
 		}
 
 		fmt.Println("workspace dir doesn't exists, creating it")
 
 		if err := os.MkdirAll(r.Workspace, 0o755); err != nil {
-			return err
+			return "", err
 		}
 	}
 
@@ -616,24 +571,74 @@ func updateK3sReferencesAndPush(r *ecmConfig.K3sRelease, u *ecmConfig.User) erro
 
 	goVersion, err := goVersion(r)
 	if err != nil {
-		return err
+		return "", err
 	}
 	r.NewGoVersion = goVersion
 
-	funcMap := template.FuncMap{"replaceAll": strings.ReplaceAll}
-	fmt.Println("creating update k3s references script template")
 	scriptVars := UpdateScriptVars{K3s: r, User: u}
-	updateScriptOut, err := ecmExec.RunTemplatedScript(r.Workspace, updateK3sScriptName, updateK3sReferencesScript, funcMap, scriptVars)
+	fmt.Println("preparing the k3s branch")
+	prepareOut, err := ecmExec.RunTemplatedScript(r.Workspace, prepareK3sBranchScriptName, prepareK3sBranchScript, template.FuncMap{}, scriptVars)
 	if err != nil {
-		return err
+		return "", err
 	}
-	fmt.Println(updateScriptOut)
-	return nil
+	fmt.Println(prepareOut)
+
+	k3sDir := filepath.Join(r.Workspace, k3sRepo)
+	fmt.Println("updating k8s and Go references")
+	scriptVars.Files, err = updateK3sReferencesFiles(k3sDir, r)
+	if err != nil {
+		return "", err
+	}
+
+	fmt.Println("running go mod tidy")
+	if _, err := ecmExec.RunCommand(k3sDir, "go", "mod", "tidy"); err != nil {
+		return "", errors.New("failed to run go mod tidy: " + err.Error())
+	}
+
+	diff, err := ecmExec.RunCommand(k3sDir, "git", "diff")
+	if err != nil {
+		return "", err
+	}
+	fmt.Println(diff)
+
+	if review && !ecmExec.UserInput("Commit the changes?") {
+		return "", errors.New("changes left uncommitted in " + k3sDir)
+	}
+
+	commitOut, err := ecmExec.RunTemplatedScript(r.Workspace, commitK3sReferencesScriptName, commitK3sReferencesScript, template.FuncMap{}, scriptVars)
+	if err != nil {
+		return "", err
+	}
+	fmt.Println(commitOut)
+
+	commit, err := ecmExec.RunCommand(k3sDir, "git", "rev-parse", "HEAD")
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(commit), nil
 }
 
-func createK3sReferencesPR(ctx context.Context, ghClient *github.Client, r *ecmConfig.K3sRelease, u *ecmConfig.User) error {
+// createK3sReferencesPR creates the PR of the pushed references, it returns
+// nil in dry runs
+func createK3sReferencesPR(ctx context.Context, ghClient *github.Client, r *ecmConfig.K3sRelease, u *ecmConfig.User) (*github.PullRequest, error) {
 	const repo = "k3s"
 
+	if r.DryRun {
+		fmt.Println("dry run, skipping creating PR")
+		return nil, nil
+	}
+
+	// the Go version is set when the references are updated, which is an
+	// earlier step of resumed runs
+	if r.NewGoVersion == "" {
+		goVersion, err := goVersion(r)
+		if err != nil {
+			return nil, err
+		}
+		r.NewGoVersion = goVersion
+	}
+
 	pull := &github.NewPullRequest{
 		Title:               github.String(fmt.Sprintf("[%s] Update to %s-%s and Go %s", r.ReleaseBranch, r.NewK8sVersion, r.NewSuffix, r.NewGoVersion)),
 		Base:                github.String(r.ReleaseBranch),
@@ -642,9 +647,13 @@ func createK3sReferencesPR(ctx context.Context, ghClient *github.Client, r *ecmC
 	}
 
 	// creating a pr from your fork branch
-	_, _, err := ghClient.PullRequests.Create(ctx, r.K3sRepoOwner, repo, pull)
+	pr, _, err := ghClient.PullRequests.Create(ctx, r.K3sRepoOwner, repo, pull)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Println("pull request created: " + pr.GetHTMLURL())
 
-	return err
+	return pr, nil
 }
 
 func NewGithubClient(ctx context.Context, token string) (*github.Client, error) {
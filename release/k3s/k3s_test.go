@@ -0,0 +1,502 @@
+package k3s
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/google/go-github/v81/github"
+	ecmConfig "github.com/rancher/ecm-distro-tools/cmd/release/config"
+	"github.com/rancher/ecm-distro-tools/repository"
+	"github.com/rancher/ecm-distro-tools/repository/githubtest"
+)
+
+func TestCreateRelease(t *testing.T) {
+	fake := githubtest.NewServer()
+	defer fake.Close()
+
+	fake.AddCommits("k3s-io", "k3s", "a1", "b2")
+	fake.AddRelease("k3s-io", "k3s", &github.RepositoryRelease{TagName: github.Ptr("v1.30.1+k3s1")})
+	fake.AddRelease("k3s-io", "k3s", &github.RepositoryRelease{TagName: github.Ptr("v1.30.2-rc1+k3s1"), Prerelease: github.Ptr(true)})
+
+	ctx := context.Background()
+	client, err := repository.NewGithubWithURL(ctx, "token", fake.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := &ecmConfig.K3sRelease{
+		OldK8sVersion: "v1.30.1",
+		NewK8sVersion: "v1.30.2",
+		OldSuffix:     "k3s1",
+		NewSuffix:     "k3s1",
+	}
+	newOpts := func() *repository.CreateReleaseOpts {
+		return &repository.CreateReleaseOpts{Owner: "k3s-io", Repo: "k3s", Branch: "release-1.30", Tag: "v1.30.2+k3s1"}
+	}
+
+	// the next rc is created after the latest one
+	if err := CreateRelease(ctx, client, r, newOpts(), true); err != nil {
+		t.Fatalf("CreateRelease() error = %v", err)
+	}
+	releases := fake.Releases("k3s-io", "k3s")
+	if len(releases) != 3 {
+		t.Fatalf("got %d releases, want 3", len(releases))
+	}
+	created := releases[2]
+	if created.GetTagName() != "v1.30.2-rc2+k3s1" || created.GetName() != "v1.30.2-rc2+k3s1" {
+		t.Errorf("CreateRelease() created %s (%s), want v1.30.2-rc2+k3s1", created.GetTagName(), created.GetName())
+	}
+	if !created.GetPrerelease() || created.GetDraft() || created.GetTargetCommitish() != "release-1.30" {
+		t.Errorf("CreateRelease() created %+v, want a published pre-release from release-1.30", created)
+	}
+
+	// dry runs don't create releases
+	r.DryRun = true
+	if err := CreateRelease(ctx, client, r, newOpts(), true); err != nil {
+		t.Fatalf("CreateRelease() error = %v", err)
+	}
+	if n := len(fake.Releases("k3s-io", "k3s")); n != 3 {
+		t.Errorf("dry run created releases, got %d releases, want 3", n)
+	}
+
+	// a final release needs a previous rc
+	r.NewK8sVersion = "v1.31.0"
+	if err := CreateRelease(ctx, client, r, newOpts(), false); err == nil {
+		t.Error("CreateRelease() expected error without a previous rc")
+	}
+}
+
+func TestRewriteK3sReferences(t *testing.T) {
+	checkout := fstest.MapFS{
+		"go.mod": {Data: []byte(`module github.com/k3s-io/k3s
+
+go 1.22.0
+
+replace (
+	github.com/containerd/containerd => github.com/k3s-io/containerd v1.7.17-k3s1
+	k8s.io/api => github.com/k3s-io/kubernetes/staging/src/k8s.io/api v1.30.1-k3s1
+	k8s.io/client-go => github.com/k3s-io/kubernetes/staging/src/k8s.io/client-go v1.30.1-k3s1
+	k8s.io/kubernetes => github.com/k3s-io/kubernetes v1.30.1-k3s1
+)
+
+require (
+	github.com/rancher/wharfie v0.30.1
+	k8s.io/api v0.30.1
+	k8s.io/client-go v0.30.1 // indirect
+	k8s.io/kubernetes v1.30.1
+	k8s.io/utils v0.0.0-20240502163921-fe8a2dddb1d0
+)
+`)},
+		"Dockerfile.dapper": {Data: []byte(`ARG GOLANG=golang:1.22.2-alpine3.19
+FROM ${GOLANG}
+RUN apk -U --no-cache add bash git
+`)},
+		"Dockerfile.local": {Data: []byte(`FROM --platform=$BUILDPLATFORM golang:1.22.2-alpine3.19 AS build
+FROM alpine:3.19
+`)},
+		".github/workflows/integration.yaml": {Data: []byte(`name: Integration Test Coverage
+jobs:
+  test:
+    steps:
+      - name: Install Go
+        uses: actions/setup-go@v5
+        with:
+          go-version: '1.22.2' # match k8s
+          check-latest: true
+`)},
+	}
+	r := &ecmConfig.K3sRelease{
+		OldK8sVersion: "v1.30.1",
+		NewK8sVersion: "v1.30.2",
+		OldK8sClient:  "v0.30.1",
+		NewK8sClient:  "v0.30.2",
+		OldSuffix:     "k3s1",
+		NewSuffix:     "k3s1",
+		NewGoVersion:  "1.22.4",
+	}
+
+	changes, err := rewriteK3sReferences(checkout, r)
+	if err != nil {
+		t.Fatalf("rewriteK3sReferences() error = %v", err)
+	}
+	got := make(map[string]string)
+	for _, change := range changes {
+		got[change.name] = string(change.new)
+	}
+
+	want := map[string]string{
+		"go.mod": `module github.com/k3s-io/k3s
+
+go 1.22.0
+
+replace (
+	github.com/containerd/containerd => github.com/k3s-io/containerd v1.7.17-k3s1
+	k8s.io/api => github.com/k3s-io/kubernetes/staging/src/k8s.io/api v1.30.2-k3s1
+	k8s.io/client-go => github.com/k3s-io/kubernetes/staging/src/k8s.io/client-go v1.30.2-k3s1
+	k8s.io/kubernetes => github.com/k3s-io/kubernetes v1.30.2-k3s1
+)
+
+require (
+	github.com/rancher/wharfie v0.30.1
+	k8s.io/api v0.30.2
+	k8s.io/client-go v0.30.2 // indirect
+	k8s.io/kubernetes v1.30.2
+	k8s.io/utils v0.0.0-20240502163921-fe8a2dddb1d0
+)
+`,
+		"Dockerfile.dapper": `ARG GOLANG=golang:1.22.4-alpine3.19
+FROM ${GOLANG}
+RUN apk -U --no-cache add bash git
+`,
+		"Dockerfile.local": `FROM --platform=$BUILDPLATFORM golang:1.22.4-alpine3.19 AS build
+FROM alpine:3.19
+`,
+		".github/workflows/integration.yaml": `name: Integration Test Coverage
+jobs:
+  test:
+    steps:
+      - name: Install Go
+        uses: actions/setup-go@v5
+        with:
+          go-version: '1.22.4' # match k8s
+          check-latest: true
+`,
+	}
+	for name, content := range want {
+		if got[name] != content {
+			t.Errorf("rewriteK3sReferences() %s =\n%s\nwant\n%s", name, got[name], content)
+		}
+	}
+	if len(got) != len(want) {
+		t.Errorf("rewriteK3sReferences() changed %d files, want %d", len(got), len(want))
+	}
+
+	// the references are already updated
+	for _, change := range changes {
+		checkout[change.name] = &fstest.MapFile{Data: change.new}
+	}
+	if changes, err := rewriteK3sReferences(checkout, r); err != nil || len(changes) != 0 {
+		t.Errorf("rewriteK3sReferences() = %d changes, %v, want no changes", len(changes), err)
+	}
+
+	// the go.mod isn't at the previous release
+	r.OldK8sVersion, r.NewK8sVersion = "v1.30.0", "v1.30.1"
+	if _, err := rewriteK3sReferences(checkout, r); err == nil || !strings.Contains(err.Error(), "expected v1.30.0-k3s1") {
+		t.Errorf("rewriteK3sReferences() error = %v, want an unexpected replace version", err)
+	}
+}
+
+func TestRunSteps(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "release-state-v1.30.3+k3s1.json")
+
+	var ran []string
+	fail := map[string]bool{StepUpdateReferences: true}
+	steps := []runStep{
+		{name: StepGenerateTags, run: func(_ context.Context, _ *RunState) (*StepState, error) {
+			ran = append(ran, StepGenerateTags)
+			return &StepState{Tags: []string{"v1.30.3-k3s1"}}, nil
+		}},
+		{name: StepPushTags, destructive: true, run: func(_ context.Context, _ *RunState) (*StepState, error) {
+			ran = append(ran, StepPushTags)
+			return &StepState{}, nil
+		}},
+		{name: StepUpdateReferences, destructive: true, run: func(_ context.Context, _ *RunState) (*StepState, error) {
+			ran = append(ran, StepUpdateReferences)
+			if fail[StepUpdateReferences] {
+				return nil, errors.New("push rejected")
+			}
+			return &StepState{Commit: "abc123"}, nil
+		}},
+		{name: StepReferencesPR, destructive: true, run: func(_ context.Context, state *RunState) (*StepState, error) {
+			ran = append(ran, StepReferencesPR)
+			if fail[StepReferencesPR] {
+				return nil, errors.New("validation failed")
+			}
+			return &StepState{Commit: state.Step(StepUpdateReferences).Commit, PullRequest: 42, URL: "https://github.com/k3s-io/k3s/pull/42"}, nil
+		}},
+	}
+	load := func() *RunState {
+		t.Helper()
+		state, err := LoadRunState(path, "v1.30.3+k3s1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return state
+	}
+
+	// the run stops at the failed step, and saves the steps before it
+	err := runSteps(context.Background(), load(), steps, &RunOpts{}, true)
+	if err == nil || !strings.Contains(err.Error(), "step update-references failed: push rejected") {
+		t.Fatalf("expected update-references to fail, got: %v", err)
+	}
+	if got := strings.Join(ran, ","); got != "generate-tags,push-tags,update-references" {
+		t.Errorf("ran %s", got)
+	}
+	state := load()
+	if state.Step(StepPushTags) == nil || state.Step(StepUpdateReferences) != nil {
+		t.Fatalf("unexpected saved state: %+v", state.Steps)
+	}
+	if tags := state.Step(StepGenerateTags).Tags; len(tags) != 1 || tags[0] != "v1.30.3-k3s1" {
+		t.Errorf("unexpected tags: %v", tags)
+	}
+
+	// the run resumes from the failed step, and the pushed references are
+	// saved even if their PR fails
+	ran = nil
+	fail[StepUpdateReferences] = false
+	fail[StepReferencesPR] = true
+	err = runSteps(context.Background(), load(), steps, &RunOpts{}, true)
+	if err == nil || !strings.Contains(err.Error(), "step references-pr failed: validation failed") {
+		t.Fatalf("expected references-pr to fail, got: %v", err)
+	}
+	if got := strings.Join(ran, ","); got != "update-references,references-pr" {
+		t.Errorf("ran %s", got)
+	}
+	if step := load().Step(StepUpdateReferences); step == nil || step.Commit != "abc123" {
+		t.Errorf("unexpected update-references state: %+v", step)
+	}
+
+	// the references aren't pushed again when the PR is retried
+	ran = nil
+	fail[StepReferencesPR] = false
+	if err := runSteps(context.Background(), load(), steps, &RunOpts{}, true); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(ran, ","); got != "references-pr" {
+		t.Errorf("ran %s", got)
+	}
+	if step := load().Step(StepReferencesPR); step == nil || step.Commit != "abc123" || step.PullRequest != 42 {
+		t.Errorf("unexpected references-pr state: %+v", step)
+	}
+
+	// completed destructive steps aren't run again unless forced
+	ran = nil
+	err = runSteps(context.Background(), load(), steps, &RunOpts{From: StepPushTags}, true)
+	if err == nil || !strings.Contains(err.Error(), "step push-tags already completed") {
+		t.Fatalf("expected push-tags to be refused, got: %v", err)
+	}
+	if len(ran) != 0 {
+		t.Errorf("ran %v", ran)
+	}
+	if err := runSteps(context.Background(), load(), steps, &RunOpts{From: StepPushTags, Force: true}, true); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(ran, ","); got != "push-tags,update-references,references-pr" {
+		t.Errorf("ran %s", got)
+	}
+
+	// steps which don't push are run again without --force
+	ran = nil
+	if err := runSteps(context.Background(), load(), steps[:1], &RunOpts{From: StepGenerateTags}, true); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(ran, ","); got != "generate-tags" {
+		t.Errorf("ran %s", got)
+	}
+
+	if _, err := LoadRunState(path, "v1.29.7+k3s1"); err == nil {
+		t.Error("expected the state file of another version to be refused")
+	}
+	if err := runSteps(context.Background(), load(), steps, &RunOpts{From: "tag"}, true); err == nil {
+		t.Error("expected an invalid step to be refused")
+	}
+}
+
+func TestTagBackend(t *testing.T) {
+	for backend, want := range map[string]tagBackend{
+		"":       &dockerTagBackend{},
+		"docker": &dockerTagBackend{},
+		"local":  &localTagBackend{},
+	} {
+		got, err := newTagBackend(&ecmConfig.K3sRelease{Backend: backend})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fmt.Sprintf("%T", got) != fmt.Sprintf("%T", want) {
+			t.Errorf("backend %q: expected %T, got %T", backend, want, got)
+		}
+	}
+	if _, err := newTagBackend(&ecmConfig.K3sRelease{Backend: "podman"}); err == nil || !strings.Contains(err.Error(), "invalid backend podman") {
+		t.Errorf("expected an invalid backend error, got: %v", err)
+	}
+
+	if err := checkLocalGoVersion("go1.22.5\n", "1.22.5", "v1.30.3"); err != nil {
+		t.Error(err)
+	}
+	if err := checkLocalGoVersion("go1.22.5 X:boringcrypto\n", "1.22.5", "v1.30.3"); err != nil {
+		t.Error(err)
+	}
+	err := checkLocalGoVersion("go1.23.1\n", "1.22.5", "v1.30.3")
+	if err == nil || err.Error() != "local Go is go1.23.1 but k8s v1.30.3 requires go1.22.5" {
+		t.Errorf("expected a Go version mismatch, got: %v", err)
+	}
+}
+
+func TestValidateRelease(t *testing.T) {
+	fake := githubtest.NewServer()
+	defer fake.Close()
+
+	fake.SetUser("release-captain", "token")
+	fake.AddTag("kubernetes", "kubernetes", "v1.30.2", "a1")
+	fake.AddTag("kubernetes", "kubernetes", "v1.30.3", "b2")
+	fake.AddTag("k3s-io", "kubernetes", "v1.30.2-k3s1", "c3")
+	fake.AddTag("k3s-io", "kubernetes", "v1.30.2-k3s2", "d4")
+	fake.AddBranch("k3s-io", "k3s", "release-1.30", "e5")
+
+	ctx := context.Background()
+	client, err := repository.NewGithubWithURL(ctx, "token", fake.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	valid := ecmConfig.K3sRelease{
+		OldK8sVersion: "v1.30.2",
+		NewK8sVersion: "v1.30.3",
+		OldK8sClient:  "v0.30.2",
+		NewK8sClient:  "v0.30.3",
+		OldSuffix:     "k3s2",
+		NewSuffix:     "k3s1",
+		ReleaseBranch: "release-1.30",
+		Workspace:     t.TempDir(),
+		K3sRepoOwner:  "k3s-io",
+	}
+	if errs := append(validateReleaseConfig(&valid), validateReleaseGithub(ctx, client, &valid)...); len(errs) > 0 {
+		t.Fatalf("unexpected problems: %v", errs)
+	}
+
+	invalid := valid
+	invalid.OldSuffix = "k3s1"
+	invalid.NewSuffix = "rke2r1"
+	invalid.NewK8sClient = "v0.29.3"
+	invalid.NewK8sVersion = "v1.30.4"
+	invalid.ReleaseBranch = "release-1.31"
+	invalid.K3sRepoOwner = ""
+	invalid.Backend = "podman"
+	expected := []string{
+		"k3s_repo_owner is required",
+		"new_suffix rke2r1 isn't in the form k3sN",
+		"new_k8s_client v0.29.3 doesn't match the minor of new_k8s_version v1.30.4, expected v0.30.x",
+		"invalid backend podman, must be one of: docker, local",
+		"new_k8s_version v1.30.4: tags/v1.30.4 not found in kubernetes/kubernetes",
+		"old_suffix k3s1 doesn't match the previous k3s release v1.30.2-k3s2",
+	}
+	// every problem is reported, not only the first one
+	errs := append(validateReleaseConfig(&invalid), validateReleaseGithub(ctx, client, &invalid)...)
+	var got []string
+	for _, err := range errs {
+		got = append(got, err.Error())
+	}
+	if strings.Join(got, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("expected problems:\n%s\ngot:\n%s", strings.Join(expected, "\n"), strings.Join(got, "\n"))
+	}
+
+	invalid = valid
+	invalid.K3sRepoOwner = "k3s-io"
+	invalid.ReleaseBranch = "release-1.31"
+	errs = validateReleaseGithub(ctx, client, &invalid)
+	if len(errs) != 1 || errs[0].Error() != "release_branch release-1.31: heads/release-1.31 not found in k3s-io/k3s" {
+		t.Errorf("expected a missing branch, got: %v", errs)
+	}
+
+	unauthenticated, err := repository.NewGithubWithURL(ctx, "expired", fake.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	errs = validateReleaseGithub(ctx, unauthenticated, &valid)
+	if len(errs) != 1 || !strings.HasPrefix(errs[0].Error(), "github token doesn't authenticate") {
+		t.Errorf("expected the token to be refused, got: %v", errs)
+	}
+
+	if err := validateSSHKey(ctx, &valid, filepath.Join(t.TempDir(), "id_ed25519")); err == nil || !strings.HasPrefix(err.Error(), "invalid ssh key") {
+		t.Errorf("expected a missing ssh key to be refused, got: %v", err)
+	}
+	if err := validateWorkspaceSpace(filepath.Join(valid.Workspace, "k3s", "v1.30.3")); err != nil && !strings.Contains(err.Error(), "GiB are needed") {
+		t.Errorf("unexpected workspace error: %v", err)
+	}
+}
+
+func TestSuggestReleases(t *testing.T) {
+	fake := githubtest.NewServer()
+	defer fake.Close()
+
+	for _, tag := range []string{"v1.27.9+k3s1", "v1.28.11+k3s1", "v1.28.11+k3s2", "v1.29.6+k3s1", "v1.29.7-rc1+k3s1", "v1.30.2+k3s1"} {
+		fake.AddTag("k3s-io", "k3s", tag, "a1")
+	}
+	for _, tag := range []string{"v1.28.11", "v1.29.6", "v1.29.7-rc.0", "v1.29.7", "v1.30.2", "v1.30.3", "v1.30.10", "v1.31.0"} {
+		fake.AddTag("kubernetes", "kubernetes", tag, "b2")
+	}
+	for _, tag := range []string{"v1.29.6-k3s1", "v1.30.2-k3s1", "v1.30.2-k3s2"} {
+		fake.AddTag("k3s-io", "kubernetes", tag, "c3")
+	}
+
+	ctx := context.Background()
+	client, err := repository.NewGithubWithURL(ctx, "token", fake.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	base := ecmConfig.K3sRelease{
+		OldK8sVersion: "v1.30.1",
+		NewK8sVersion: "v1.30.2",
+		Workspace:     "/go/src/github.com/k3s-io/kubernetes/v1.30.2/",
+		K3sRepoOwner:  "k3s-io",
+		K8sRancherURL: "git@github.com:k3s-io/kubernetes.git",
+		Backend:       ecmConfig.K3sBackendLocal,
+	}
+	suggestions, err := SuggestReleases(ctx, client, base, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]ecmConfig.K3sRelease{
+		"v1.29.7": {
+			OldK8sVersion: "v1.29.6",
+			NewK8sVersion: "v1.29.7",
+			OldK8sClient:  "v0.29.6",
+			NewK8sClient:  "v0.29.7",
+			OldSuffix:     "k3s1",
+			NewSuffix:     "k3s1",
+			ReleaseBranch: "release-1.29",
+			Workspace:     "/go/src/github.com/k3s-io/kubernetes/v1.29.7",
+			K3sRepoOwner:  "k3s-io",
+			K8sRancherURL: "git@github.com:k3s-io/kubernetes.git",
+			Backend:       ecmConfig.K3sBackendLocal,
+		},
+		"v1.30.10": {
+			OldK8sVersion: "v1.30.2",
+			NewK8sVersion: "v1.30.10",
+			OldK8sClient:  "v0.30.2",
+			NewK8sClient:  "v0.30.10",
+			OldSuffix:     "k3s2",
+			NewSuffix:     "k3s1",
+			ReleaseBranch: "release-1.30",
+			Workspace:     "/go/src/github.com/k3s-io/kubernetes/v1.30.10",
+			K3sRepoOwner:  "k3s-io",
+			K8sRancherURL: "git@github.com:k3s-io/kubernetes.git",
+			Backend:       ecmConfig.K3sBackendLocal,
+		},
+	}
+	if len(suggestions.Versions) != len(expected) {
+		t.Errorf("expected %d suggestions, got %+v", len(expected), suggestions.Versions)
+	}
+	for version, want := range expected {
+		if got := suggestions.Versions[version]; got != want {
+			t.Errorf("%s:\nexpected %+v\ngot      %+v", version, want, got)
+		}
+	}
+	// v1.27 isn't one of the 3 latest minors, and v1.31 has no k3s release yet
+	if strings.Join(suggestions.UpToDate, ",") != "v1.28.11+k3s2" {
+		t.Errorf("unexpected up to date releases: %v", suggestions.UpToDate)
+	}
+
+	for _, minors := range []int{0, -1} {
+		if _, err := SuggestReleases(ctx, client, base, minors); err == nil {
+			t.Errorf("expected an error for %d minors", minors)
+		}
+	}
+}
@@ -0,0 +1,259 @@
+package k3s
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	ecmConfig "github.com/rancher/ecm-distro-tools/cmd/release/config"
+	"golang.org/x/mod/modfile"
+	"gopkg.in/yaml.v3"
+)
+
+const k3sKubernetesModule = "github.com/k3s-io/kubernetes"
+
+// k3sWorkflowFiles are the workflows which set up Go with the version of k8s
+var k3sWorkflowFiles = []string{".github/workflows/integration.yaml", ".github/workflows/unitcoverage.yaml"}
+
+// fileChange is a file of the k3s repository and its contents before and
+// after updating the references
+type fileChange struct {
+	name string
+	old  []byte
+	new  []byte
+}
+
+// rewriteK3sReferences updates the k8s and Go references of the k3s
+// repository in fsys to the new versions of the release. It returns the files
+// which changed, without writing them.
+func rewriteK3sReferences(fsys fs.FS, r *ecmConfig.K3sRelease) ([]fileChange, error) {
+	var changes []fileChange
+	rewrite := func(name string, fn func([]byte) ([]byte, error)) error {
+		old, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return err
+		}
+		updated, err := fn(old)
+		if err != nil {
+			return errors.New("failed to update " + name + ": " + err.Error())
+		}
+		if !bytes.Equal(old, updated) {
+			changes = append(changes, fileChange{name: name, old: old, new: updated})
+		}
+		return nil
+	}
+
+	if err := rewrite("go.mod", func(data []byte) ([]byte, error) {
+		return rewriteGoMod(data, r)
+	}); err != nil {
+		return nil, err
+	}
+
+	dockerfiles, err := fs.Glob(fsys, "Dockerfile.*")
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range dockerfiles {
+		if err := rewrite(name, func(data []byte) ([]byte, error) {
+			return rewriteDockerfileGoVersion(data, r.NewGoVersion)
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, name := range k3sWorkflowFiles {
+		err := rewrite(name, func(data []byte) ([]byte, error) {
+			return rewriteWorkflowGoVersion(data, r.NewGoVersion)
+		})
+		// not every release branch has every workflow
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+	}
+
+	return changes, nil
+}
+
+// rewriteGoMod points the replace directives of k3s-io/kubernetes and its
+// staging modules to the new k3s tag, and updates the requirements of
+// k8s.io/kubernetes and of the k8s clients, e.g. k8s.io/client-go.
+func rewriteGoMod(data []byte, r *ecmConfig.K3sRelease) ([]byte, error) {
+	f, err := modfile.Parse("go.mod", data, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	oldRef := r.OldK8sVersion + "-" + r.OldSuffix
+	newRef := r.NewK8sVersion + "-" + r.NewSuffix
+
+	var replaced int
+	for _, rep := range f.Replace {
+		if rep.New.Path != k3sKubernetesModule && !strings.HasPrefix(rep.New.Path, k3sKubernetesModule+"/") {
+			continue
+		}
+		if rep.New.Version != oldRef && rep.New.Version != newRef {
+			return nil, errors.New(rep.Old.Path + " is replaced with " + rep.New.Path + " " + rep.New.Version + ", expected " + oldRef)
+		}
+		if err := f.AddReplace(rep.Old.Path, rep.Old.Version, rep.New.Path, newRef); err != nil {
+			return nil, err
+		}
+		replaced++
+	}
+	if replaced == 0 {
+		return nil, errors.New("no replace directives for " + k3sKubernetesModule)
+	}
+
+	requires := make(map[string]string)
+	for _, req := range f.Require {
+		switch {
+		case req.Mod.Path == "k8s.io/kubernetes":
+			requires[req.Mod.Path] = r.NewK8sVersion
+		case strings.HasPrefix(req.Mod.Path, "k8s.io/") && req.Mod.Version == r.OldK8sClient:
+			requires[req.Mod.Path] = r.NewK8sClient
+		}
+	}
+	for modPath, version := range requires {
+		if err := f.AddRequire(modPath, version); err != nil {
+			return nil, err
+		}
+	}
+
+	f.Cleanup()
+	return modfile.Format(f.Syntax), nil
+}
+
+// golangImageTag returns the image with the Go version of its tag replaced,
+// if it's a golang image with a variant, e.g. golang:1.22.4-alpine3.19
+func golangImageTag(image, goVersion string) (string, bool) {
+	idx := strings.LastIndex(image, ":")
+	if idx == -1 || strings.Contains(image[idx:], "/") {
+		return image, false
+	}
+	name, tag := image[:idx], image[idx+1:]
+	if path.Base(name) != "golang" {
+		return image, false
+	}
+	_, variant, ok := strings.Cut(tag, "-")
+	if !ok {
+		return image, false
+	}
+
+	return name + ":" + goVersion + "-" + variant, true
+}
+
+// rewriteDockerfileGoVersion updates the Go version of the golang images of
+// the FROM instructions, and of the default values of ARG instructions, e.g.
+// ARG GOLANG=golang:1.22.4-alpine3.19
+func rewriteDockerfileGoVersion(data []byte, goVersion string) ([]byte, error) {
+	var out bytes.Buffer
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := scanner.Text()
+		fields := strings.Fields(line)
+
+		if len(fields) > 1 {
+			switch strings.ToUpper(fields[0]) {
+			case "FROM":
+				for _, field := range fields[1:] {
+					if strings.HasPrefix(field, "--") {
+						continue
+					}
+					if image, ok := golangImageTag(field, goVersion); ok {
+						line = strings.Replace(line, field, image, 1)
+					}
+					break
+				}
+			case "ARG":
+				if _, value, ok := strings.Cut(fields[1], "="); ok {
+					if image, ok := golangImageTag(strings.Trim(value, `"'`), goVersion); ok {
+						line = strings.Replace(line, strings.Trim(value, `"'`), image, 1)
+					}
+				}
+			}
+		}
+
+		out.WriteString(line + "\n")
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	// keep the file without a trailing newline if it had none
+	if !bytes.HasSuffix(data, []byte("\n")) {
+		return bytes.TrimSuffix(out.Bytes(), []byte("\n")), nil
+	}
+	return out.Bytes(), nil
+}
+
+// rewriteWorkflowGoVersion sets every go-version of the workflow to the Go
+// version. The values are replaced where the YAML parser found them, so the
+// rest of the file keeps its formatting and comments.
+func rewriteWorkflowGoVersion(data []byte, goVersion string) ([]byte, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+
+	var values []*yaml.Node
+	var walk func(n *yaml.Node)
+	walk = func(n *yaml.Node) {
+		if n.Kind == yaml.MappingNode {
+			for i := 0; i+1 < len(n.Content); i += 2 {
+				if n.Content[i].Value == "go-version" && n.Content[i+1].Kind == yaml.ScalarNode {
+					values = append(values, n.Content[i+1])
+				}
+			}
+		}
+		for _, child := range n.Content {
+			walk(child)
+		}
+	}
+	walk(&doc)
+
+	lines := strings.Split(string(data), "\n")
+	for _, value := range values {
+		line := lines[value.Line-1]
+		start := value.Column - 1
+		end := start + len(value.Value)
+
+		quoted := "'" + goVersion + "'"
+		switch value.Style {
+		case yaml.DoubleQuotedStyle:
+			end += 2
+			quoted = `"` + goVersion + `"`
+		case yaml.SingleQuotedStyle:
+			end += 2
+		}
+		if end > len(line) {
+			return nil, errors.New("unsupported go-version value in line " + line)
+		}
+
+		lines[value.Line-1] = line[:start] + quoted + line[end:]
+	}
+
+	return []byte(strings.Join(lines, "\n")), nil
+}
+
+// updateK3sReferencesFiles updates the references of the k3s repository in
+// dir and writes the changed files. It returns the names of the changed files.
+func updateK3sReferencesFiles(dir string, r *ecmConfig.K3sRelease) ([]string, error) {
+	changes, err := rewriteK3sReferences(os.DirFS(dir), r)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(changes))
+	for _, change := range changes {
+		if err := os.WriteFile(filepath.Join(dir, change.name), change.new, 0o644); err != nil {
+			return nil, err
+		}
+		names = append(names, change.name)
+	}
+
+	return names, nil
+}
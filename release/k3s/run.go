@@ -0,0 +1,322 @@
+package k3s
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v81/github"
+	ecmConfig "github.com/rancher/ecm-distro-tools/cmd/release/config"
+	"github.com/rancher/ecm-distro-tools/repository"
+)
+
+// Steps of a k3s release run, in the order they run
+const (
+	StepGenerateTags     = "generate-tags"
+	StepPushTags         = "push-tags"
+	StepUpdateReferences = "update-references"
+	StepReferencesPR     = "references-pr"
+	StepTagRC            = "tag-rc"
+)
+
+// RunSteps are the steps of a k3s release run, in the order they run
+var RunSteps = []string{StepGenerateTags, StepPushTags, StepUpdateReferences, StepReferencesPR, StepTagRC}
+
+// StepState is a completed step of a run and its outputs
+type StepState struct {
+	Name        string    `json:"name"`
+	CompletedAt time.Time `json:"completed_at"`
+	Tags        []string  `json:"tags,omitempty"`
+	Commit      string    `json:"commit,omitempty"`
+	PullRequest int       `json:"pull_request,omitempty"`
+	URL         string    `json:"url,omitempty"`
+}
+
+// RunState is the progress of the run of a k3s release, saved in the
+// workspace after every step
+type RunState struct {
+	Version string      `json:"version"`
+	Steps   []StepState `json:"steps"`
+	path    string
+}
+
+// RunStatePath returns the path of the state file of the version in the workspace
+func RunStatePath(r *ecmConfig.K3sRelease, version string) string {
+	return filepath.Join(r.Workspace, "release-state-"+version+".json")
+}
+
+// LoadRunState reads the state of a run, which is empty if the run didn't start
+func LoadRunState(path, version string) (*RunState, error) {
+	state := RunState{Version: version, Steps: make([]StepState, 0), path: path}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &state, nil
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &state); err != nil {
+		return nil, errors.New("invalid state file " + path + ": " + err.Error())
+	}
+	if state.Version != version {
+		return nil, errors.New("state file " + path + " is of version " + state.Version + ", not " + version)
+	}
+
+	return &state, nil
+}
+
+// Step returns the state of the step, or nil if it didn't complete
+func (s *RunState) Step(name string) *StepState {
+	for i := range s.Steps {
+		if s.Steps[i].Name == name {
+			return &s.Steps[i]
+		}
+	}
+	return nil
+}
+
+// complete records the step as completed, replacing its previous state
+func (s *RunState) complete(step StepState) {
+	s.Steps = slices.DeleteFunc(s.Steps, func(st StepState) bool {
+		return st.Name == step.Name
+	})
+	s.Steps = append(s.Steps, step)
+}
+
+func (s *RunState) save() error {
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(s.path, b, 0o644)
+}
+
+// runStep is a step of a run. Destructive steps change remote repositories,
+// so they aren't run again once completed unless forced.
+type runStep struct {
+	name        string
+	destructive bool
+	run         func(ctx context.Context, state *RunState) (*StepState, error)
+}
+
+// RunOpts are the options of a k3s release run
+type RunOpts struct {
+	// From is the step to start from, running it and every step after it
+	// again even if they completed. Runs resume after the last completed step by default.
+	From string
+	// Force allows running destructive steps again
+	Force bool
+}
+
+// Run runs the steps of the k3s release of the version which didn't complete
+// yet, saving their outputs in the state file of the version in the
+// workspace. Dry runs don't save the state. It returns the state of the run,
+// even if a step failed.
+func Run(ctx context.Context, client *github.Client, r *ecmConfig.K3sRelease, u *ecmConfig.User, sshKeyPath, version string, opts *RunOpts) (*RunState, error) {
+	state, err := LoadRunState(RunStatePath(r, version), version)
+	if err != nil {
+		return nil, err
+	}
+
+	return state, runSteps(ctx, state, k3sRunSteps(client, r, u, sshKeyPath, version), opts, !r.DryRun)
+}
+
+func runSteps(ctx context.Context, state *RunState, steps []runStep, opts *RunOpts, save bool) error {
+	start := 0
+	if opts.From != "" {
+		start = slices.IndexFunc(steps, func(step runStep) bool {
+			return step.name == opts.From
+		})
+		if start == -1 {
+			return errors.New("invalid step " + opts.From + ", must be one of: " + strings.Join(RunSteps, ", "))
+		}
+	}
+
+	// refuse before running anything, so a run doesn't stop halfway
+	for _, step := range steps[start:] {
+		if opts.From != "" && step.destructive && state.Step(step.name) != nil && !opts.Force {
+			return errors.New("step " + step.name + " already completed and can't be run again without --force")
+		}
+	}
+
+	for i, step := range steps {
+		if done := state.Step(step.name); done != nil && (opts.From == "" || i < start) {
+			fmt.Println("step " + step.name + " completed at " + done.CompletedAt.Format(time.RFC3339) + ", skipping")
+			continue
+		}
+
+		fmt.Println("running step " + step.name)
+		result, err := step.run(ctx, state)
+		if err != nil {
+			return errors.New("step " + step.name + " failed: " + err.Error())
+		}
+		result.Name = step.name
+		result.CompletedAt = time.Now().UTC()
+		state.complete(*result)
+
+		if !save {
+			fmt.Println("dry run, skipping saving the state of step " + step.name)
+			continue
+		}
+		if err := state.save(); err != nil {
+			return errors.New("failed to save the state of step " + step.name + ": " + err.Error())
+		}
+	}
+
+	return nil
+}
+
+// tagsFromFile returns the tags of the tags file of the release
+func tagsFromFile(r *ecmConfig.K3sRelease) ([]string, error) {
+	tagCmds, err := tagsCmdsFromFile(r)
+	if err != nil {
+		return nil, err
+	}
+
+	tags := make([]string, 0, len(tagCmds))
+	for _, tagCmd := range tagCmds {
+		// git push $REMOTE <tag>
+		if fields := strings.Fields(tagCmd); len(fields) > 3 {
+			tags = append(tags, fields[3])
+		}
+	}
+
+	return tags, nil
+}
+
+func k3sRunSteps(client *github.Client, r *ecmConfig.K3sRelease, u *ecmConfig.User, sshKeyPath, version string) []runStep {
+	return []runStep{
+		{
+			name: StepGenerateTags,
+			run: func(ctx context.Context, _ *RunState) (*StepState, error) {
+				// the tags file of a previous generate k3s tags is reused
+				exists, err := tagsFileExists(r)
+				if err != nil {
+					return nil, err
+				}
+				if !exists {
+					if err := GenerateTags(ctx, client, r, u, sshKeyPath); err != nil {
+						return nil, err
+					}
+				}
+
+				tags, err := tagsFromFile(r)
+				if err != nil {
+					return nil, err
+				}
+				return &StepState{Tags: tags}, nil
+			},
+		},
+		{
+			name:        StepPushTags,
+			destructive: true,
+			run: func(_ context.Context, state *RunState) (*StepState, error) {
+				if err := PushTags(client, r, u, sshKeyPath); err != nil {
+					return nil, err
+				}
+				return &StepState{Tags: state.Step(StepGenerateTags).Tags}, nil
+			},
+		},
+		{
+			name:        StepUpdateReferences,
+			destructive: true,
+			run: func(_ context.Context, _ *RunState) (*StepState, error) {
+				commit, err := updateK3sReferencesAndPush(r, u, false)
+				if err != nil {
+					return nil, err
+				}
+				return &StepState{Commit: commit}, nil
+			},
+		},
+		{
+			// the PR is a step of its own, so a failure to create it doesn't
+			// push the references again on resume
+			name:        StepReferencesPR,
+			destructive: true,
+			run: func(ctx context.Context, state *RunState) (*StepState, error) {
+				pushed := state.Step(StepUpdateReferences)
+				pr, err := createK3sReferencesPR(ctx, client, r, u)
+				if err != nil {
+					return nil, err
+				}
+				return &StepState{Commit: pushed.Commit, PullRequest: pr.GetNumber(), URL: pr.GetHTMLURL()}, nil
+			},
+		},
+		{
+			name:        StepTagRC,
+			destructive: true,
+			run: func(ctx context.Context, state *RunState) (*StepState, error) {
+				// the rc is tagged from the release branch, once the references are merged
+				number := state.Step(StepReferencesPR).PullRequest
+				if number == 0 {
+					// dry runs don't create the pull request
+					fmt.Println("no references pull request recorded, skipping the merged check")
+				} else {
+					pr, _, err := client.PullRequests.Get(ctx, r.K3sRepoOwner, k3sRepo, number)
+					if err != nil {
+						return nil, err
+					}
+					if !pr.GetMerged() {
+						return nil, errors.New("pull request " + pr.GetHTMLURL() + " isn't merged yet, run again once it is")
+					}
+				}
+
+				opts := repository.CreateReleaseOpts{
+					Tag:    version,
+					Repo:   k3sRepo,
+					Owner:  r.K3sRepoOwner,
+					Branch: r.ReleaseBranch,
+				}
+				if err := CreateRelease(ctx, client, r, &opts, true); err != nil {
+					return nil, err
+				}
+
+				// the tag of the rc is set by CreateRelease
+				step := StepState{Tags: []string{opts.Tag}}
+				if !r.DryRun {
+					created, _, err := client.Repositories.GetReleaseByTag(ctx, r.K3sRepoOwner, k3sRepo, opts.Tag)
+					if err != nil {
+						return nil, err
+					}
+					step.URL = created.GetHTMLURL()
+				}
+				return &step, nil
+			},
+		},
+	}
+}
+
+// String renders the steps of the run and their outputs
+func (s *RunState) String() string {
+	var sb strings.Builder
+	for _, name := range RunSteps {
+		step := s.Step(name)
+		if step == nil {
+			sb.WriteString(name + ": pending\n")
+			continue
+		}
+
+		sb.WriteString(name + ": completed at " + step.CompletedAt.Format(time.RFC3339) + "\n")
+		if len(step.Tags) > 0 {
+			sb.WriteString("  tags: " + strings.Join(step.Tags, ", ") + "\n")
+		}
+		if step.Commit != "" {
+			sb.WriteString("  commit: " + step.Commit + "\n")
+		}
+		if step.PullRequest != 0 {
+			sb.WriteString("  pull request: #" + strconv.Itoa(step.PullRequest) + "\n")
+		}
+		if step.URL != "" {
+			sb.WriteString("  url: " + step.URL + "\n")
+		}
+	}
+	return sb.String()
+}
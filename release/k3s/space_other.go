@@ -0,0 +1,10 @@
+//go:build !unix
+
+package k3s
+
+import "errors"
+
+// availableSpace isn't supported, the workspace space check is skipped
+func availableSpace(path string) (uint64, error) {
+	return 0, errors.ErrUnsupported
+}
@@ -0,0 +1,15 @@
+//go:build unix
+
+package k3s
+
+import "syscall"
+
+// availableSpace returns the bytes available to the user in the filesystem of
+// the path
+func availableSpace(path string) (uint64, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return 0, err
+	}
+	return uint64(stat.Bavail) * uint64(stat.Bsize), nil
+}
@@ -0,0 +1,173 @@
+package k3s
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/google/go-github/v81/github"
+	ecmConfig "github.com/rancher/ecm-distro-tools/cmd/release/config"
+	"golang.org/x/mod/semver"
+)
+
+var (
+	// k8sPatchTagRegex matches the refs of the GA tags of kubernetes, e.g. refs/tags/v1.30.2
+	k8sPatchTagRegex = regexp.MustCompile(`^refs/tags/v1\.(\d+)\.(\d+)$`)
+	// k3sReleaseTagRegex matches the refs of the GA tags of k3s, e.g. refs/tags/v1.30.2+k3s1
+	k3sReleaseTagRegex = regexp.MustCompile(`^refs/tags/v1\.(\d+)\.(\d+)\+k3s(\d+)$`)
+)
+
+// k3sTag is a GA release of k3s, or of kubernetes if suffix is 0
+type k3sTag struct {
+	minor, patch, suffix int
+}
+
+func (t k3sTag) k8sVersion() string {
+	return "v1." + strconv.Itoa(t.minor) + "." + strconv.Itoa(t.patch)
+}
+
+func (t k3sTag) k8sClient() string {
+	return "v0." + strconv.Itoa(t.minor) + "." + strconv.Itoa(t.patch)
+}
+
+func (t k3sTag) String() string {
+	if t.suffix == 0 {
+		return t.k8sVersion()
+	}
+	return t.k8sVersion() + "+k3s" + strconv.Itoa(t.suffix)
+}
+
+func (t k3sTag) newer(o k3sTag) bool {
+	if t.patch != o.patch {
+		return t.patch > o.patch
+	}
+	return t.suffix > o.suffix
+}
+
+// ReleaseSuggestions are the proposed k3s releases of the active minors
+type ReleaseSuggestions struct {
+	// Versions are the proposed releases, keyed by their new k8s version like
+	// the k3s versions of the config
+	Versions map[string]ecmConfig.K3sRelease
+	// UpToDate are the last k3s releases of the minors with no newer k8s patch
+	UpToDate []string
+}
+
+// SuggestReleases proposes the config of the next k3s release of each of the
+// latest minors which have a k3s release: from the last k3s release of the
+// minor to the latest kubernetes patch. The fields which aren't derived from
+// the tags, e.g. the workspace and the repository URLs, are copied from base.
+func SuggestReleases(ctx context.Context, client *github.Client, base ecmConfig.K3sRelease, minors int) (*ReleaseSuggestions, error) {
+	if base.K3sRepoOwner == "" {
+		return nil, errors.New("k3s repo owner is required")
+	}
+	if minors < 1 {
+		return nil, errors.New("minors must be at least 1, got " + strconv.Itoa(minors))
+	}
+
+	refs, err := matchingRefs(ctx, client, base.K3sRepoOwner, k3sRepo, "tags/v1.")
+	if err != nil {
+		return nil, errors.New("failed to list the k3s tags: " + err.Error())
+	}
+	lastReleases := latestTags(refs, k3sReleaseTagRegex)
+	if len(lastReleases) == 0 {
+		return nil, errors.New("no k3s releases found in " + base.K3sRepoOwner + "/" + k3sRepo)
+	}
+
+	activeMinors := make([]int, 0, len(lastReleases))
+	for minor := range lastReleases {
+		activeMinors = append(activeMinors, minor)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(activeMinors)))
+	activeMinors = activeMinors[:min(minors, len(activeMinors))]
+
+	suggestions := ReleaseSuggestions{Versions: make(map[string]ecmConfig.K3sRelease), UpToDate: make([]string, 0)}
+	for _, minor := range activeMinors {
+		last := lastReleases[minor]
+
+		refs, err := matchingRefs(ctx, client, k8sUpstreamOwner, k8sUpstreamRepo, "tags/v1."+strconv.Itoa(minor)+".")
+		if err != nil {
+			return nil, errors.New("failed to list the kubernetes tags of v1." + strconv.Itoa(minor) + ": " + err.Error())
+		}
+		latest, ok := latestTags(refs, k8sPatchTagRegex)[minor]
+		if !ok || latest.patch <= last.patch {
+			suggestions.UpToDate = append(suggestions.UpToDate, last.String())
+			continue
+		}
+
+		r := base
+		r.OldK8sVersion = last.k8sVersion()
+		r.NewK8sVersion = latest.k8sVersion()
+		r.OldK8sClient = last.k8sClient()
+		r.NewK8sClient = latest.k8sClient()
+		r.NewSuffix = ecmConfig.K3sSuffixBase + "1"
+		r.ReleaseBranch = "release-1." + strconv.Itoa(minor)
+		// workspaces are usually named after the k8s version
+		if base.Workspace != "" && semver.IsValid(filepath.Base(base.Workspace)) {
+			r.Workspace = filepath.Join(filepath.Dir(filepath.Clean(base.Workspace)), r.NewK8sVersion)
+		}
+
+		// the old suffix is the one of the k3s-io/kubernetes tag of the last
+		// release, which go.mod replaces kubernetes with
+		prevK3sTag, err := previousK3sReleaseTag(ctx, client, &r)
+		if err != nil {
+			return nil, err
+		}
+		r.OldSuffix = ecmConfig.K3sSuffixBase + strconv.Itoa(last.suffix)
+		if prevK3sTag != "" {
+			r.OldSuffix = strings.TrimPrefix(prevK3sTag, r.OldK8sVersion+"-")
+		}
+
+		suggestions.Versions[r.NewK8sVersion] = r
+	}
+
+	return &suggestions, nil
+}
+
+// latestTags returns the latest tag of each minor of the refs matching the
+// regex, whose groups are the minor, the patch and optionally the k3s suffix
+func latestTags(refs []string, regex *regexp.Regexp) map[int]k3sTag {
+	latest := make(map[int]k3sTag)
+	for _, ref := range refs {
+		m := regex.FindStringSubmatch(ref)
+		if m == nil {
+			continue
+		}
+
+		var tag k3sTag
+		tag.minor, _ = strconv.Atoi(m[1])
+		tag.patch, _ = strconv.Atoi(m[2])
+		if len(m) > 3 {
+			tag.suffix, _ = strconv.Atoi(m[3])
+		}
+
+		if current, ok := latest[tag.minor]; !ok || tag.newer(current) {
+			latest[tag.minor] = tag
+		}
+	}
+	return latest
+}
+
+// matchingRefs returns the names of the refs of the repository starting with
+// ref, e.g. tags/v1.30.
+func matchingRefs(ctx context.Context, client *github.Client, owner, repo, ref string) ([]string, error) {
+	var names []string
+	opts := &github.ReferenceListOptions{Ref: ref, ListOptions: github.ListOptions{PerPage: 100}}
+	for {
+		refs, resp, err := client.Git.ListMatchingRefs(ctx, owner, repo, opts)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range refs {
+			names = append(names, r.GetRef())
+		}
+		if resp.NextPage == 0 {
+			return names, nil
+		}
+		opts.Page = resp.NextPage
+	}
+}
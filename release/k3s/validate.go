@@ -0,0 +1,239 @@
+package k3s
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/storage/memory"
+	"github.com/google/go-github/v81/github"
+	ecmConfig "github.com/rancher/ecm-distro-tools/cmd/release/config"
+	"golang.org/x/mod/semver"
+)
+
+const (
+	k8sUpstreamOwner = "kubernetes"
+	k8sUpstreamRepo  = "kubernetes"
+	// minWorkspaceSpace is the free space needed to clone and build kubernetes
+	minWorkspaceSpace = 10 << 30
+)
+
+var k3sSuffixRegex = regexp.MustCompile(`^k3s[1-9][0-9]*$`)
+
+// ValidateRelease checks the config of the release before running it: the
+// fields are set and consistent, the k8s tags and the release branch exist,
+// the previous k3s release resolves, the workspace has enough free space and
+// the GitHub token and the SSH key authenticate. Every problem found is
+// returned, joined in a single error.
+func ValidateRelease(ctx context.Context, client *github.Client, r *ecmConfig.K3sRelease, sshKeyPath string) error {
+	errs := validateReleaseConfig(r)
+	errs = append(errs, validateReleaseGithub(ctx, client, r)...)
+
+	if r.Workspace != "" {
+		if err := validateWorkspaceSpace(r.Workspace); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if err := validateSSHKey(ctx, r, sshKeyPath); err != nil {
+		errs = append(errs, err)
+	}
+
+	return errors.Join(errs...)
+}
+
+// validateReleaseRefs checks the config of the release and the refs it needs
+// in GitHub, without the checks of the environment running it. Steps running
+// in an existing workspace use it, since the clone counts towards the free
+// space of the workspace.
+func validateReleaseRefs(ctx context.Context, client *github.Client, r *ecmConfig.K3sRelease) error {
+	errs := validateReleaseConfig(r)
+	errs = append(errs, validateReleaseGithub(ctx, client, r)...)
+	return errors.Join(errs...)
+}
+
+// validateReleaseConfig checks the fields of the release config
+func validateReleaseConfig(r *ecmConfig.K3sRelease) []error {
+	var errs []error
+
+	for _, field := range []struct{ name, value string }{
+		{"old_k8s_version", r.OldK8sVersion},
+		{"new_k8s_version", r.NewK8sVersion},
+		{"old_k8s_client", r.OldK8sClient},
+		{"new_k8s_client", r.NewK8sClient},
+		{"old_suffix", r.OldSuffix},
+		{"new_suffix", r.NewSuffix},
+		{"release_branch", r.ReleaseBranch},
+		{"workspace", r.Workspace},
+		{"k3s_repo_owner", r.K3sRepoOwner},
+	} {
+		if field.value == "" {
+			errs = append(errs, errors.New(field.name+" is required"))
+		}
+	}
+
+	for _, version := range []struct{ name, value string }{
+		{"old_k8s_version", r.OldK8sVersion},
+		{"new_k8s_version", r.NewK8sVersion},
+		{"old_k8s_client", r.OldK8sClient},
+		{"new_k8s_client", r.NewK8sClient},
+	} {
+		if version.value != "" && !semver.IsValid(version.value) {
+			errs = append(errs, errors.New(version.name+" "+version.value+" isn't a valid semver"))
+		}
+	}
+
+	for _, suffix := range []struct{ name, value string }{
+		{"old_suffix", r.OldSuffix},
+		{"new_suffix", r.NewSuffix},
+	} {
+		if suffix.value != "" && !k3sSuffixRegex.MatchString(suffix.value) {
+			errs = append(errs, errors.New(suffix.name+" "+suffix.value+" isn't in the form k3sN"))
+		}
+	}
+
+	// the k8s clients of k8s v1.x.y are v0.x.y
+	for _, client := range []struct{ name, value, k8sName, k8sVersion string }{
+		{"old_k8s_client", r.OldK8sClient, "old_k8s_version", r.OldK8sVersion},
+		{"new_k8s_client", r.NewK8sClient, "new_k8s_version", r.NewK8sVersion},
+	} {
+		if !semver.IsValid(client.value) || !semver.IsValid(client.k8sVersion) {
+			continue
+		}
+		expected := "v0." + minor(client.k8sVersion)
+		if semver.MajorMinor(client.value) != expected {
+			errs = append(errs, errors.New(client.name+" "+client.value+" doesn't match the minor of "+client.k8sName+" "+client.k8sVersion+", expected "+expected+".x"))
+		}
+	}
+
+	if semver.IsValid(r.OldK8sVersion) && semver.IsValid(r.NewK8sVersion) && semver.Compare(r.NewK8sVersion, r.OldK8sVersion) < 0 {
+		errs = append(errs, errors.New("new_k8s_version "+r.NewK8sVersion+" is older than old_k8s_version "+r.OldK8sVersion))
+	}
+
+	if _, err := newTagBackend(r); err != nil {
+		errs = append(errs, err)
+	}
+
+	return errs
+}
+
+// minor returns the minor of a valid semver, e.g. 30 for v1.30.2
+func minor(version string) string {
+	majorMinor := semver.MajorMinor(version)
+	return majorMinor[len(semver.Major(version))+1:]
+}
+
+// validateReleaseGithub checks the refs of the release exist in GitHub, and
+// that the client authenticates
+func validateReleaseGithub(ctx context.Context, client *github.Client, r *ecmConfig.K3sRelease) []error {
+	var errs []error
+
+	if _, _, err := client.Users.Get(ctx, ""); err != nil {
+		errs = append(errs, errors.New("github token doesn't authenticate: "+err.Error()))
+	}
+
+	for _, version := range []struct{ name, value string }{
+		{"old_k8s_version", r.OldK8sVersion},
+		{"new_k8s_version", r.NewK8sVersion},
+	} {
+		if !semver.IsValid(version.value) {
+			continue
+		}
+		if err := refExists(ctx, client, k8sUpstreamOwner, k8sUpstreamRepo, "tags/"+version.value); err != nil {
+			errs = append(errs, errors.New(version.name+" "+version.value+": "+err.Error()))
+		}
+	}
+
+	if r.K3sRepoOwner != "" && r.ReleaseBranch != "" {
+		if err := refExists(ctx, client, r.K3sRepoOwner, k3sRepo, "heads/"+r.ReleaseBranch); err != nil {
+			errs = append(errs, errors.New("release_branch "+r.ReleaseBranch+": "+err.Error()))
+		}
+	}
+
+	if semver.IsValid(r.OldK8sVersion) {
+		prevK3sTag, err := previousK3sReleaseTag(ctx, client, r)
+		switch {
+		case err != nil:
+			errs = append(errs, errors.New("failed to resolve the previous k3s release: "+err.Error()))
+		case prevK3sTag == "":
+			errs = append(errs, errors.New("no k3s release of old_k8s_version "+r.OldK8sVersion+" in "+ecmConfig.K3sGithubOrganization+"/"+ecmConfig.K3sK8sRepositoryName))
+		case r.OldSuffix != "" && prevK3sTag != r.OldK8sVersion+"-"+r.OldSuffix:
+			errs = append(errs, errors.New("old_suffix "+r.OldSuffix+" doesn't match the previous k3s release "+prevK3sTag))
+		}
+	}
+
+	return errs
+}
+
+// refExists returns an error if the ref, e.g. tags/v1.30.2 or heads/master,
+// doesn't exist in the repository
+func refExists(ctx context.Context, client *github.Client, owner, repo, ref string) error {
+	if _, _, err := client.Git.GetRef(ctx, owner, repo, ref); err != nil {
+		if isNotFound(err) {
+			return errors.New(ref + " not found in " + owner + "/" + repo)
+		}
+		return err
+	}
+	return nil
+}
+
+func isNotFound(err error) bool {
+	var ghErr *github.ErrorResponse
+	return errors.As(err, &ghErr) && ghErr.Response != nil && ghErr.Response.StatusCode == http.StatusNotFound
+}
+
+// validateWorkspaceSpace checks the workspace, or the directory it will be
+// created in, has enough free space
+func validateWorkspaceSpace(workspace string) error {
+	dir := filepath.Clean(workspace)
+	for {
+		if _, err := os.Stat(dir); err == nil {
+			break
+		} else if !os.IsNotExist(err) {
+			return errors.New("workspace " + workspace + ": " + err.Error())
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			break
+		}
+		dir = parent
+	}
+
+	available, err := availableSpace(dir)
+	if errors.Is(err, errors.ErrUnsupported) {
+		return nil
+	}
+	if err != nil {
+		return errors.New("workspace " + workspace + ": " + err.Error())
+	}
+	if available < minWorkspaceSpace {
+		return errors.New("workspace " + workspace + " has " + strconv.FormatUint(available>>20, 10) + " MiB free, at least " + strconv.Itoa(minWorkspaceSpace>>30) + " GiB are needed")
+	}
+
+	return nil
+}
+
+// validateSSHKey checks the SSH key authenticates by listing the refs of the
+// k3s-io/kubernetes repository
+func validateSSHKey(ctx context.Context, r *ecmConfig.K3sRelease, sshKeyPath string) error {
+	auth, err := getAuth(sshKeyPath)
+	if err != nil {
+		return errors.New("invalid ssh key: " + err.Error())
+	}
+
+	url := r.K8sRancherURL
+	if url == "" {
+		url = k8sRancherURL
+	}
+	remote := git.NewRemote(memory.NewStorage(), &config.RemoteConfig{Name: "origin", URLs: []string{url}})
+	if _, err := remote.ListContext(ctx, &git.ListOptions{Auth: auth}); err != nil {
+		return errors.New("ssh key doesn't authenticate with " + url + ": " + err.Error())
+	}
+
+	return nil
+}
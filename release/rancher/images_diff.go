@@ -0,0 +1,178 @@
+package rancher
+
+import (
+	"bufio"
+	"io"
+	"io/fs"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+// ImagesListAsset is the release asset with every image a Rancher version uses
+const ImagesListAsset = "rancher-images.txt"
+
+// RepositoryImagesDiff are the tags of a repository which are only in one of the image lists
+type RepositoryImagesDiff struct {
+	Repository string   `json:"repository"`
+	OldTags    []string `json:"old_tags,omitempty"`
+	NewTags    []string `json:"new_tags,omitempty"`
+}
+
+// ImagesDiff are the repositories added, removed and with changed tags between two image lists
+type ImagesDiff struct {
+	Old     string                 `json:"old"`
+	New     string                 `json:"new"`
+	Added   []RepositoryImagesDiff `json:"added"`
+	Removed []RepositoryImagesDiff `json:"removed"`
+	Changed []RepositoryImagesDiff `json:"changed"`
+}
+
+// ImagesFromFS reads the images list from the release assets of a Rancher version
+func ImagesFromFS(fsys fs.FS) ([]string, error) {
+	f, err := fsys.Open(ImagesListAsset)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var images []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if image := strings.TrimSpace(scanner.Text()); image != "" {
+			images = append(images, image)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return images, nil
+}
+
+// DiffImages compares the image lists of two versions. Repositories only in the new
+// list are added, only in the old list are removed, and in both lists with different
+// tags are changed. Every group is sorted by repository.
+func DiffImages(oldVersion, newVersion string, oldImages, newImages []string) (*ImagesDiff, error) {
+	oldTags, err := repositoryTags(oldImages)
+	if err != nil {
+		return nil, err
+	}
+	newTags, err := repositoryTags(newImages)
+	if err != nil {
+		return nil, err
+	}
+
+	diff := ImagesDiff{
+		Old:     oldVersion,
+		New:     newVersion,
+		Added:   make([]RepositoryImagesDiff, 0),
+		Removed: make([]RepositoryImagesDiff, 0),
+		Changed: make([]RepositoryImagesDiff, 0),
+	}
+
+	for repository, tags := range newTags {
+		if _, ok := oldTags[repository]; !ok {
+			diff.Added = append(diff.Added, RepositoryImagesDiff{Repository: repository, NewTags: sortedTags(tags)})
+		}
+	}
+
+	for repository, tags := range oldTags {
+		current, ok := newTags[repository]
+		if !ok {
+			diff.Removed = append(diff.Removed, RepositoryImagesDiff{Repository: repository, OldTags: sortedTags(tags)})
+			continue
+		}
+
+		changed := RepositoryImagesDiff{Repository: repository}
+		for tag := range tags {
+			if !current[tag] {
+				changed.OldTags = append(changed.OldTags, tag)
+			}
+		}
+		for tag := range current {
+			if !tags[tag] {
+				changed.NewTags = append(changed.NewTags, tag)
+			}
+		}
+		if len(changed.OldTags) != 0 || len(changed.NewTags) != 0 {
+			sort.Strings(changed.OldTags)
+			sort.Strings(changed.NewTags)
+			diff.Changed = append(diff.Changed, changed)
+		}
+	}
+
+	for _, group := range [][]RepositoryImagesDiff{diff.Added, diff.Removed, diff.Changed} {
+		sort.Slice(group, func(i, j int) bool {
+			return group[i].Repository < group[j].Repository
+		})
+	}
+
+	return &diff, nil
+}
+
+// repositoryTags maps every repository in the list to the set of its tags
+func repositoryTags(images []string) (map[string]map[string]bool, error) {
+	repositories := make(map[string]map[string]bool)
+
+	for _, imageAndVersion := range images {
+		image, version, err := splitImageAndVersion(imageAndVersion)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := repositories[image]; !ok {
+			repositories[image] = make(map[string]bool)
+		}
+		repositories[image][version] = true
+	}
+
+	return repositories, nil
+}
+
+func sortedTags(tags map[string]bool) []string {
+	sorted := make([]string, 0, len(tags))
+	for tag := range tags {
+		sorted = append(sorted, tag)
+	}
+	sort.Strings(sorted)
+
+	return sorted
+}
+
+// Markdown writes the diff as the images section of a release announcement
+func (d *ImagesDiff) Markdown(w io.Writer) error {
+	tmpl, err := template.New("images-diff").Funcs(template.FuncMap{"join": strings.Join}).Parse(imagesDiffTemplate)
+	if err != nil {
+		return err
+	}
+
+	return tmpl.Execute(w, d)
+}
+
+const imagesDiffTemplate = `# Images changed between {{ .Old }} and {{ .New }}
+{{- if .Added }}
+
+## Added
+{{ range .Added }}
+* {{ .Repository }}: {{ join .NewTags ", " }}
+{{- end }}
+{{- end }}
+{{- if .Removed }}
+
+## Removed
+{{ range .Removed }}
+* {{ .Repository }}: {{ join .OldTags ", " }}
+{{- end }}
+{{- end }}
+{{- if .Changed }}
+
+## Changed
+{{ range .Changed }}
+* {{ .Repository }}: {{ if .OldTags }}{{ join .OldTags ", " }}{{ else }}-{{ end }} -> {{ if .NewTags }}{{ join .NewTags ", " }}{{ else }}-{{ end }}
+{{- end }}
+{{- end }}
+{{- if not (or .Added .Removed .Changed) }}
+
+No images changed.
+{{- end }}
+`
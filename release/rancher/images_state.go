@@ -0,0 +1,151 @@
+package rancher
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	// stateSaveBatch and stateSavePeriod bound the results lost if a run is
+	// interrupted, the state is saved when either of them is reached
+	stateSaveBatch  = 100
+	stateSavePeriod = 10 * time.Second
+)
+
+// ImageCheckStatus is the result of checking if an image exists in a registry
+type ImageCheckStatus string
+
+const (
+	ImageFound      ImageCheckStatus = "found"
+	ImageMissing    ImageCheckStatus = "missing"
+	ImageCheckError ImageCheckStatus = "error"
+)
+
+// ImageCheck is the last result of checking an image
+type ImageCheck struct {
+	Status    ImageCheckStatus `json:"status"`
+	Error     string           `json:"error,omitempty"`
+	CheckedAt time.Time        `json:"checked_at"`
+}
+
+// ImageChecksState persists the result of every image checked by
+// MissingImagesFromRegistry to a file, so a run that failed midway can be
+// resumed without checking again the images that were already found or missing.
+type ImageChecksState struct {
+	Registry string                `json:"registry"`
+	Images   map[string]ImageCheck `json:"images"`
+
+	path    string
+	mu      sync.Mutex
+	unsaved int
+	savedAt time.Time
+}
+
+// NewImageChecksState creates an empty state for the registry which is saved to path
+func NewImageChecksState(path, registry string) *ImageChecksState {
+	return &ImageChecksState{
+		Registry: registry,
+		Images:   make(map[string]ImageCheck),
+		path:     path,
+		savedAt:  time.Now(),
+	}
+}
+
+// LoadImageChecksState reads the state saved at path by a previous run. If the
+// file doesn't exist an empty state is returned.
+func LoadImageChecksState(path, registry string) (*ImageChecksState, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return NewImageChecksState(path, registry), nil
+		}
+		return nil, err
+	}
+
+	state := NewImageChecksState(path, registry)
+	if err := json.Unmarshal(b, state); err != nil {
+		return nil, errors.New("failed to read state file " + path + ": " + err.Error())
+	}
+	if state.Registry != registry {
+		return nil, errors.New("state file " + path + " is for registry " + state.Registry + ", not " + registry)
+	}
+	if state.Images == nil {
+		state.Images = make(map[string]ImageCheck)
+	}
+
+	return state, nil
+}
+
+// checked returns the result of a previous check if the image was found or is
+// missing. Images which failed to be checked, or were never checked, return false.
+func (s *ImageChecksState) checked(image string) (ImageCheck, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	check, ok := s.Images[image]
+	if !ok || check.Status == ImageCheckError {
+		return check, false
+	}
+	return check, true
+}
+
+// set records the result of checking the image. The state is saved in
+// batches, so saving doesn't grow with the number of images checked.
+func (s *ImageChecksState) set(image string, check ImageCheck) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.Images[image] = check
+	s.unsaved++
+
+	if s.unsaved < stateSaveBatch && time.Since(s.savedAt) < stateSavePeriod {
+		return nil
+	}
+	return s.save()
+}
+
+// Save writes the results which weren't saved yet to the state file
+func (s *ImageChecksState) Save() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.unsaved == 0 {
+		return nil
+	}
+	return s.save()
+}
+
+// save writes the state to a temporary file which is then renamed, so an
+// interrupted run never leaves a truncated state file behind
+func (s *ImageChecksState) save() error {
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return err
+	}
+
+	s.unsaved = 0
+	s.savedAt = time.Now()
+	return nil
+}
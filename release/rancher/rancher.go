@@ -2,7 +2,6 @@ package rancher
 
 import (
 	"bufio"
-	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
@@ -15,14 +14,14 @@ import (
 	"sort"
 	"strconv"
 	"strings"
-	"sync"
-	"text/template"
 	"time"
 
+	"github.com/google/go-containerregistry/pkg/name"
 	"github.com/google/go-github/v81/github"
 	ecmConfig "github.com/rancher/ecm-distro-tools/cmd/release/config"
 	ecmExec "github.com/rancher/ecm-distro-tools/exec"
 	ecmHTTP "github.com/rancher/ecm-distro-tools/http"
+	reg "github.com/rancher/ecm-distro-tools/registry"
 	"github.com/rancher/ecm-distro-tools/release"
 	"github.com/rancher/ecm-distro-tools/release/cli"
 	"github.com/rancher/ecm-distro-tools/repository"
@@ -34,14 +33,6 @@ import (
 const (
 	rancherOrg                    = "rancher"
 	rancherRepo                   = rancherOrg
-	rancherRegistryBaseURL        = "https://registry.rancher.com"
-	stagingRancherRegistryBaseURL = "https://stgregistry.suse.com"
-	sccSUSEURL                    = "https://scc.suse.com/api/registry/authorize"
-	stagingSccSUSEURL             = "https://stgscc.suse.com/api/registry/authorize"
-	dockerRegistryURL             = "https://registry-1.docker.io"
-	dockerAuthURL                 = "https://auth.docker.io/token"
-	sccSUSEService                = "SUSE+Linux+Docker+Registry"
-	dockerService                 = "registry.docker.io"
 	dashboardUpdateRefsBranchBase = "update-dashboard-refs"
 )
 
@@ -65,57 +56,32 @@ var regsyncDefaultMediaTypes = []string{
 	"application/vnd.oci.image.index.v1+json",
 }
 
+// registriesInfo contains the regsync credentials templates for the registries images are synced between
 var registriesInfo = map[string]registryInfo{
 	"registry.rancher.com": {
-		BaseURL:     rancherRegistryBaseURL,
-		AuthURL:     sccSUSEURL,
-		Service:     sccSUSEService,
 		UserEnv:     `{{env "PRIME_REGISTRY_USERNAME"}}`,
 		PasswordEnv: `{{env "PRIME_REGISTRY_PASSWORD"}}`,
 	},
 	"stgregistry.suse.com": {
-		BaseURL:     stagingRancherRegistryBaseURL,
-		AuthURL:     stagingSccSUSEURL,
-		Service:     sccSUSEService,
 		UserEnv:     `{{env "STAGING_REGISTRY_USERNAME"}}`,
 		PasswordEnv: `{{env "STAGING_REGISTRY_PASSWORD"}}`,
 	},
 	"docker.io": {
-		BaseURL:     dockerRegistryURL,
-		AuthURL:     dockerAuthURL,
-		Service:     dockerService,
 		UserEnv:     `{{env "DOCKERIO_REGISTRY_USERNAME"}}`,
 		PasswordEnv: `{{env "DOCKERIO_REGISTRY_PASSWORD"}}`,
 	},
 }
 
 type registryInfo struct {
-	BaseURL     string
-	AuthURL     string
-	Service     string
 	UserEnv     string
 	PasswordEnv string
 }
 
-type imageDigest map[string]string
-
-type RancherRCDepsLine struct {
-	Line    int    `json:"line"`
-	File    string `json:"file"`
-	Content string `json:"content"`
-}
+// RegistryClient is implemented by the clients images are checked with,
+// such as registry.Client for any OCI registry
+type RegistryClient = reg.ImageClient
 
-type RancherRCDeps struct {
-	RancherImages  []RancherRCDepsLine `json:"rancherImages"`
-	FilesWithRC    []RancherRCDepsLine `json:"filesWithRc"`
-	MinFilesWithRC []RancherRCDepsLine `json:"minFilesWithRc"`
-	ChartsWithDev  []RancherRCDepsLine `json:"chartsWithDev"`
-	KDMWithDev     []RancherRCDepsLine `json:"kdmWithDev"`
-}
-
-type registryAuthToken struct {
-	Token string `json:"token"`
-}
+type imageDigest map[string]string
 
 type regsyncConfig struct {
 	Version  int             `json:"version"`
@@ -297,71 +263,6 @@ func CreateRelease(ctx context.Context, ghClient *github.Client, r *ecmConfig.Ra
 	return createdRelease.GetHTMLURL(), err
 }
 
-func CheckRancherRCDeps(ctx context.Context, org, gitRef string) (*RancherRCDeps, error) {
-	var content RancherRCDeps
-	files := []string{"Dockerfile.dapper", "go.mod", "/package/Dockerfile", "/pkg/apis/go.mod", "/pkg/settings/setting.go", "/scripts/package-env"}
-	devDependencyPattern := regexp.MustCompile(`dev-v[0-9]+\.[0-9]+`)
-	rcTagPattern := regexp.MustCompile(`-rc[0-9]+`)
-	ghClient := repository.NewGithub(ctx, "")
-
-	for _, filePath := range files {
-		var scanner *bufio.Scanner
-
-		fileContent, err := remoteGitContent(ctx, ghClient, org, rancherRepo, gitRef, filePath)
-		if err != nil {
-			return nil, err
-		}
-
-		scanner = bufio.NewScanner(strings.NewReader(fileContent))
-		lineNum := 1
-
-		for scanner.Scan() {
-			line := scanner.Text()
-			if strings.Contains(line, "indirect") {
-				continue
-			}
-
-			if devDependencyPattern.MatchString(line) {
-				lineContent := RancherRCDepsLine{File: filePath, Line: lineNum, Content: formatContentLine(line)}
-				lineContentLower := strings.ToLower(lineContent.Content)
-
-				if strings.Contains(lineContentLower, "chart") {
-					content.ChartsWithDev = append(content.ChartsWithDev, lineContent)
-				} else if strings.Contains(lineContentLower, "kdm") {
-					content.KDMWithDev = append(content.KDMWithDev, lineContent)
-				}
-			}
-			if strings.Contains(filePath, "/package/Dockerfile") {
-				if regexp.MustCompile(`CATTLE_(\S+)_MIN_VERSION`).MatchString(line) && strings.Contains(line, "-rc") {
-					lineContent := RancherRCDepsLine{Line: lineNum, File: filePath, Content: formatContentLine(line)}
-					content.MinFilesWithRC = append(content.MinFilesWithRC, lineContent)
-				}
-			}
-
-			if rcTagPattern.MatchString(line) {
-				lineContent := RancherRCDepsLine{File: filePath, Line: lineNum, Content: formatContentLine(line)}
-				content.FilesWithRC = append(content.FilesWithRC, lineContent)
-			}
-
-			lineNum++
-		}
-		if err := scanner.Err(); err != nil {
-			return nil, err
-		}
-	}
-
-	return &content, nil
-}
-
-func (r *RancherRCDeps) ToString() (string, error) {
-	tmpl := template.New("rancher-release-rc-dev-deps")
-	tmpl = template.Must(tmpl.Parse(checkRancherRCDepsTemplate))
-	buff := bytes.NewBuffer(nil)
-	err := tmpl.ExecuteTemplate(buff, "componentsFile", r)
-
-	return buff.String(), err
-}
-
 func remoteGitContent(ctx context.Context, ghClient *github.Client, org, repo, gitRef, filePath string) (string, error) {
 	content, _, _, err := ghClient.Repositories.GetContents(ctx, org, repo, filePath, &github.RepositoryContentGetOptions{Ref: gitRef})
 	if err != nil {
@@ -385,17 +286,17 @@ func formatContentLine(line string) string {
 
 // ImagesLocations searches for missing images in a registry and creates a map with the locations of the images, or if they are missing
 // this map can be used to identify where which image should be synced from
-func ImagesLocations(username, password string, concurrencyLimit int, checkImages, ignoreImages []string, targetRegistry string, imagesRegiestries []string) (map[string][]string, error) {
+func ImagesLocations(ctx context.Context, newClient func(registry string) RegistryClient, concurrencyLimit int, checkImages, ignoreImages []string, targetRegistry string, imagesRegiestries []string) (map[string][]string, error) {
 	imagesLocations := make(map[string][]string)
 
-	missingFromTarget, err := MissingImagesFromRegistry(username, password, targetRegistry, concurrencyLimit, checkImages, ignoreImages)
+	missingFromTarget, err := MissingImagesFromRegistry(ctx, newClient(targetRegistry), concurrencyLimit, checkImages, ignoreImages, nil)
 	if err != nil {
 		return nil, err
 	}
 
 	lastMissingImages := missingFromTarget
 	for _, registry := range imagesRegiestries {
-		missingFromRegistry, err := MissingImagesFromRegistry(username, password, registry, concurrencyLimit, lastMissingImages, ignoreImages)
+		missingFromRegistry, err := MissingImagesFromRegistry(ctx, newClient(registry), concurrencyLimit, lastMissingImages, ignoreImages, nil)
 		if err != nil {
 			return nil, err
 		}
@@ -434,34 +335,31 @@ func imagesDiff(source, compare []string) ([]string, error) {
 	return diff, nil
 }
 
-// MissingImagesFromRegistry receives registry information and a list of images and checks which images are missing from that registry
-// it uses the docker http api v2 to check images concurrently
-func MissingImagesFromRegistry(username, password, registry string, concurrencyLimit int, checkImages, ignoreImages []string) ([]string, error) {
+// imageCheckRetries is how many times a failed image check is retried
+const imageCheckRetries = 3
+
+// imageCheckBackoff is the wait before the first retry of an image check, it doubles on every retry
+var imageCheckBackoff = time.Second
+
+// MissingImagesFromRegistry receives a registry client and a list of images and checks which images are missing from that registry
+// images are checked concurrently, up to concurrencyLimit at a time, and failed checks are retried with backoff.
+// If state is not nil, the result of every check is saved to it and images that were already found or missing are not checked again,
+// images which still fail after the retries are recorded as errors instead of stopping the run, so they can be checked again later.
+func MissingImagesFromRegistry(ctx context.Context, client RegistryClient, concurrencyLimit int, checkImages, ignoreImages []string, state *ImageChecksState) ([]string, error) {
 	ignore, err := imageSliceToMap(ignoreImages, true)
 	if err != nil {
 		return nil, err
 	}
 
 	// create an error group with a limit to prevent accidentaly doing a DOS attack against our registry
-	ctx, cancel := context.WithCancel(context.Background())
 	errGroup, ctx := errgroup.WithContext(ctx)
 	errGroup.SetLimit(concurrencyLimit)
 	missingImagesChan := make(chan string, len(checkImages))
-
-	// auth tokens can be reused, but maps need a lock for reading and writing in go routines
-	repositoryAuths := make(map[string]string)
-	mu := sync.RWMutex{}
-
-	rgInfo, ok := registriesInfo[registry]
-	if !ok {
-		cancel()
-		return nil, errors.New("registry must be one of the following: 'docker.io', 'registry.rancher.com' or 'stgregistry.suse.com'")
-	}
+	failedImagesChan := make(chan string, len(checkImages))
 
 	for _, imageAndVersion := range checkImages {
-		image, imageVersion, err := splitImageAndVersion(imageAndVersion)
+		image, _, err := splitImageAndVersion(imageAndVersion)
 		if err != nil {
-			cancel()
 			return nil, err
 		}
 
@@ -469,59 +367,97 @@ func MissingImagesFromRegistry(username, password, registry string, concurrencyL
 			continue
 		}
 
-		func(ctx context.Context, missingImagesChan chan string, image, imageVersion, username, password string, repositoryAuths map[string]string, mu *sync.RWMutex) {
-			errGroup.Go(func() error {
-				// if any other check failed, stop running to prevent wasting resources
-				// this doesn't include 404's since it is expected. Any other errors are included
-				select {
-				case <-ctx.Done():
-					return ctx.Err()
-				default:
-					mu.Lock()
-
-					var ok bool
-					var auth string
-					var err error
-
-					auth, ok = repositoryAuths[image]
-					if !ok {
-						auth, err = registryAuth(rgInfo.AuthURL, rgInfo.Service, image, username, password)
-						if err != nil {
-							cancel()
-							return err
-						}
-						repositoryAuths[image] = auth
-					}
-					mu.Unlock()
+		ref, err := name.ParseReference(imageAndVersion)
+		if err != nil {
+			return nil, err
+		}
 
-					exists, err := checkIfImageExists(rgInfo.BaseURL, image, imageVersion, auth)
-					if err != nil {
-						cancel()
-						return err
-					}
+		errGroup.Go(func() error {
+			// if any other check failed, stop running to prevent wasting resources
+			// this doesn't include 404's since it is expected. Any other errors are included
+			if err := ctx.Err(); err != nil {
+				return err
+			}
 
-					fullImage := image + ":" + imageVersion
-					if !exists {
-						missingImagesChan <- fullImage
+			if state != nil {
+				if check, ok := state.checked(imageAndVersion); ok {
+					if check.Status == ImageMissing {
+						missingImagesChan <- imageAndVersion
 					}
 					return nil
 				}
-			})
-		}(ctx, missingImagesChan, image, imageVersion, username, password, repositoryAuths, &mu)
+			}
 
+			img, err := imageWithRetries(ctx, client, ref)
+			if state == nil {
+				if err != nil {
+					return errors.New("failed to check " + imageAndVersion + ": " + err.Error())
+				}
+			} else {
+				check := ImageCheck{Status: ImageFound, CheckedAt: time.Now().UTC()}
+				switch {
+				case err != nil:
+					check.Status = ImageCheckError
+					check.Error = err.Error()
+					failedImagesChan <- imageAndVersion
+				case !img.Exists:
+					check.Status = ImageMissing
+				}
+				if saveErr := state.set(imageAndVersion, check); saveErr != nil {
+					return errors.New("failed to save state: " + saveErr.Error())
+				}
+				if err != nil {
+					return nil
+				}
+			}
+
+			if !img.Exists {
+				missingImagesChan <- imageAndVersion
+			}
+			return nil
+		})
+	}
+	err = errGroup.Wait()
+	// the results not saved by the last batch are saved even if the run failed
+	if state != nil {
+		if saveErr := state.Save(); saveErr != nil && err == nil {
+			err = errors.New("failed to save state: " + saveErr.Error())
+		}
 	}
-	if err := errGroup.Wait(); err != nil {
-		cancel()
+	if err != nil {
 		return nil, err
 	}
-	cancel()
 
 	close(missingImagesChan)
 	missingImages := readStringChan(missingImagesChan)
 
+	close(failedImagesChan)
+	if failedImages := readStringChan(failedImagesChan); len(failedImages) != 0 {
+		sort.Strings(failedImages)
+		return missingImages, errors.New("failed to check " + strconv.Itoa(len(failedImages)) + " images: " + strings.Join(failedImages, ","))
+	}
+
 	return missingImages, nil
 }
 
+// imageWithRetries gets the image from the registry, retrying failed requests with exponential backoff
+func imageWithRetries(ctx context.Context, client RegistryClient, ref name.Reference) (reg.Image, error) {
+	backoff := imageCheckBackoff
+	for attempt := 0; ; attempt++ {
+		img, err := client.Image(ctx, ref)
+		if err == nil || attempt == imageCheckRetries {
+			return img, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return img, ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
 func GenerateImagesSyncConfig(images []string, sourceRegistry, targetRegistry, outputPath string) error {
 	config, err := generateRegsyncConfig(images, sourceRegistry, targetRegistry)
 	if err != nil {
@@ -536,6 +472,77 @@ func GenerateImagesSyncConfig(images []string, sourceRegistry, targetRegistry, o
 	return os.WriteFile(outputPath, b, 0o644)
 }
 
+// ImageCopy is the copy of an image between two registries
+type ImageCopy struct {
+	Image  string `json:"image"`
+	Digest string `json:"digest"`
+	// Skipped is set when the target registry already has the image with the same digest
+	Skipped bool `json:"skipped"`
+}
+
+// SyncImages copies the images from the source registry to the target registry without regsync.
+// images are copied concurrently, up to concurrencyLimit at a time, and images which already have
+// the same digest in the target registry are skipped. If dryRun is set nothing is copied and the
+// returned slice is the copy plan.
+func SyncImages(ctx context.Context, source, target *reg.Client, concurrencyLimit int, images []string, dryRun bool) ([]ImageCopy, error) {
+	copies := make([]ImageCopy, len(images))
+	refs := make([]name.Reference, len(images))
+
+	for i, imageAndVersion := range images {
+		if _, _, err := splitImageAndVersion(imageAndVersion); err != nil {
+			return nil, err
+		}
+		ref, err := name.ParseReference(imageAndVersion)
+		if err != nil {
+			return nil, err
+		}
+		refs[i] = ref
+		copies[i].Image = imageAndVersion
+	}
+
+	errGroup, ctx := errgroup.WithContext(ctx)
+	errGroup.SetLimit(concurrencyLimit)
+
+	for i := range copies {
+		errGroup.Go(func() error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			digest, err := source.Digest(ctx, refs[i])
+			if err != nil {
+				return errors.New("failed to check " + copies[i].Image + ": " + err.Error())
+			}
+			if digest == "" {
+				return errors.New("image not found in source registry: " + copies[i].Image)
+			}
+			copies[i].Digest = digest
+
+			targetDigest, err := target.Digest(ctx, refs[i])
+			if err != nil {
+				return errors.New("failed to check " + copies[i].Image + ": " + err.Error())
+			}
+			if targetDigest == digest {
+				copies[i].Skipped = true
+				return nil
+			}
+
+			if dryRun {
+				return nil
+			}
+			if err := source.Copy(ctx, refs[i], target); err != nil {
+				return errors.New("failed to copy " + copies[i].Image + ": " + err.Error())
+			}
+			return nil
+		})
+	}
+	if err := errGroup.Wait(); err != nil {
+		return nil, err
+	}
+
+	return copies, nil
+}
+
 func generateRegsyncConfig(images []string, sourceRegistry, targetRegistry string) (*regsyncConfig, error) {
 	sourceRegistryInfo, ok := registriesInfo[sourceRegistry]
 	if !ok {
@@ -623,27 +630,62 @@ func validateRepoImage(repoImage string) error {
 	return nil
 }
 
-func GenerateDockerImageDigests(outputFile, imagesFileURL, registry, username, password string, verbose bool) error {
-	imagesDigests, err := dockerImagesDigests(imagesFileURL, registry, username, password)
+// Formats supported by GenerateDockerImageDigests
+const (
+	DigestsFormatText = "text"
+	DigestsFormatJSON = "json"
+	DigestsFormatYAML = "yaml"
+)
+
+// ImageDigests holds the digests of an image. Digest is the manifest list
+// digest for multi-arch images, and Platforms the digest of every platform
+// manifest, windows builds are told apart by their os version.
+type ImageDigests struct {
+	Image     string                  `json:"image"`
+	Digest    string                  `json:"digest"`
+	Platforms map[reg.Platform]string `json:"platforms,omitempty"`
+}
+
+// GenerateDockerImageDigests writes the digests of every image in the list to
+// outputFile. The text format only includes the top level digest, json and
+// yaml also include the digest of every platform.
+func GenerateDockerImageDigests(ctx context.Context, client RegistryClient, outputFile, imagesFileURL, registry, format string) error {
+	digests, err := dockerImagesDigests(ctx, client, imagesFileURL, registry)
 	if err != nil {
 		return err
 	}
-	return createAssetFile(outputFile, imagesDigests)
+
+	switch format {
+	case "", DigestsFormatText:
+		imagesDigests := make(imageDigest, len(digests))
+		for _, d := range digests {
+			imagesDigests[d.Image] = d.Digest
+		}
+		return createAssetFile(outputFile, imagesDigests)
+	case DigestsFormatJSON:
+		b, err := json.MarshalIndent(digests, "", "  ")
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(outputFile, append(b, '\n'), 0o644)
+	case DigestsFormatYAML:
+		b, err := yaml.Marshal(digests)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(outputFile, b, 0o644)
+	default:
+		return errors.New("invalid format: " + format)
+	}
 }
 
-func dockerImagesDigests(imagesFileURL, registry, username, password string) (imageDigest, error) {
+func dockerImagesDigests(ctx context.Context, client RegistryClient, imagesFileURL, registry string) ([]ImageDigests, error) {
 	imagesList, err := artifactImageList(imagesFileURL, registry)
 	if err != nil {
 		return nil, err
 	}
 
-	rgInfo, ok := registriesInfo[registry]
-	if !ok {
-		return nil, errors.New("registry must be one of the following: 'docker.io', 'registry.rancher.com' or 'stgregistry.suse.com'")
-	}
-
-	imagesDigests := make(imageDigest)
-	repositoryAuths := make(map[string]string)
+	var digests []ImageDigests
 
 	for _, imageAndVersion := range imagesList {
 		if imageAndVersion == "" || imageAndVersion == " " {
@@ -652,25 +694,32 @@ func dockerImagesDigests(imagesFileURL, registry, username, password string) (im
 		if !strings.Contains(imageAndVersion, ":") {
 			return nil, errors.New("malformed image name: , missing ':'")
 		}
-		splitImage := strings.Split(imageAndVersion, ":")
-		image := splitImage[0]
-		imageVersion := splitImage[1]
 
-		if _, ok := repositoryAuths[image]; !ok {
-			auth, err := registryAuth(rgInfo.AuthURL, rgInfo.Service, image, username, password)
-			if err != nil {
-				return nil, err
-			}
-			repositoryAuths[image] = auth
+		ref, err := name.ParseReference(imageAndVersion)
+		if err != nil {
+			return nil, err
 		}
-		digest, _, err := dockerImageDigest(rgInfo.BaseURL, image, imageVersion, repositoryAuths[image])
+
+		img, err := client.Image(ctx, ref)
 		if err != nil {
 			return nil, err
 		}
+		if !img.Exists {
+			return nil, errors.New("image not found in " + registry + ": " + imageAndVersion)
+		}
 		// e.g: registry.rancher.com/rancher/rancher:v2.9.0 = sha256:1234567890
-		imagesDigests[registry+"/"+imageAndVersion] = digest
+		digests = append(digests, ImageDigests{
+			Image:     registry + "/" + imageAndVersion,
+			Digest:    img.Digest,
+			Platforms: img.PlatformDigests,
+		})
 	}
-	return imagesDigests, nil
+
+	sort.Slice(digests, func(i, j int) bool {
+		return digests[i].Image < digests[j].Image
+	})
+
+	return digests, nil
 }
 
 func createAssetFile(outputFile string, contents fmt.Stringer) error {
@@ -747,81 +796,6 @@ func getLinesFromReader(body io.Reader) ([]string, error) {
 	return strings.Split(string(lines), "\n"), nil
 }
 
-func dockerImageDigest(registryBaseURL, img, imgVersion, auth string) (string, int, error) {
-	httpClient := ecmHTTP.NewClient(time.Second * 15)
-	req, err := http.NewRequest("GET", registryBaseURL+"/v2/"+img+"/manifests/"+imgVersion, nil)
-	if err != nil {
-		return "", 0, err
-	}
-
-	req.Header.Add("Accept", "application/vnd.oci.image.index.v1+json")
-	req.Header.Add("Accept", "application/vnd.oci.image.manifest.v1+json")
-	req.Header.Add("Accept", "application/vnd.docker.distribution.manifest.v2+json")
-	req.Header.Add("Accept", "application/vnd.docker.distribution.manifest.v1+prettyjws")
-	req.Header.Add("Accept", "application/vnd.docker.distribution.manifest.v1+json")
-	req.Header.Add("Accept", "application/vnd.docker.distribution.manifest.list.v2+json")
-	req.Header.Add("Accept", "application/vnd.oci.image.index.v1+json")
-	req.Header.Add("Docker-Distribution-Api-Version", "registry/2.0")
-	req.Header.Add("Authorization", "Bearer "+auth)
-	res, err := httpClient.Do(req)
-	if err != nil {
-		return "", 0, err
-	}
-	defer res.Body.Close()
-
-	if res.StatusCode == http.StatusNotFound {
-		return "", res.StatusCode, nil
-	}
-	dockerDigest := res.Header.Get("Docker-Content-Digest")
-	if dockerDigest == "" {
-		return "", res.StatusCode, errors.New("empty digest header 'Docker-Content-Digest'")
-	}
-	return dockerDigest, res.StatusCode, nil
-}
-
-func checkIfImageExists(registryBaseURL, img, imgVersion, auth string) (bool, error) {
-	_, statusCode, err := dockerImageDigest(registryBaseURL, img, imgVersion, auth)
-	if err != nil {
-		return false, err
-	}
-	if statusCode == http.StatusNotFound {
-		return false, nil
-	}
-	if statusCode != http.StatusOK {
-		return false, errors.New("expected status code to be 200, got: " + strconv.Itoa(statusCode))
-	}
-
-	return true, nil
-}
-
-func registryAuth(authURL, service, image, username, password string) (string, error) {
-	httpClient := ecmHTTP.NewClient(time.Second * 15)
-	scope := "repository:" + image + ":pull"
-	url := authURL + "?scope=" + scope + "&service=" + service
-	req, err := http.NewRequest(http.MethodGet, url, nil)
-	if err != nil {
-		return "", err
-	}
-	if len(username) > 1 && len(password) > 1 {
-		req.SetBasicAuth(username, password)
-	}
-	res, err := httpClient.Do(req)
-	if err != nil {
-		return "", err
-	}
-	if res.StatusCode != http.StatusOK {
-		return "", errors.New("expected status code to be 200, got: " + strconv.Itoa(res.StatusCode))
-	}
-	defer res.Body.Close()
-
-	var auth registryAuthToken
-	if err := json.NewDecoder(res.Body).Decode(&auth); err != nil {
-		return "", err
-	}
-
-	return auth.Token, nil
-}
-
 func ImagesFromArtifact(url string) ([]string, error) {
 	httpClient := ecmHTTP.NewClient(time.Second * 15)
 	res, err := httpClient.Get(url)
@@ -852,31 +826,11 @@ func readStringChan(ch <-chan string) []string {
 	return data
 }
 
-const checkRancherRCDepsTemplate = `{{- define "componentsFile" -}}
-# Images with -rc
-{{range .RancherImages}}
-* {{ .Content }} ({{ .File }}, line {{ .Line }})
-{{- end}}
-
-# Components with -rc
-{{range .FilesWithRC}}
-* {{ .Content }} ({{ .File }}, line {{ .Line }})
-{{- end}}
-
-# Min version components with -rc
-{{range .MinFilesWithRC}}
-* {{ .Content }} ({{ .File }}, line {{ .Line }})
-{{- end}} 
-
-# KDM References with dev branch
-{{range .KDMWithDev}}
-* {{ .Content }} ({{ .File }}, line {{ .Line }})
-{{- end}}
-
-# Chart References with dev branch
-{{range .ChartsWithDev}}
+const checkRancherRCDepsTemplate = `{{- range . }}
+# {{ .Name }} ({{ .Severity }})
+{{ range .Findings }}
 * {{ .Content }} ({{ .File }}, line {{ .Line }})
-{{- end}}
+{{- end }}
 {{ end }}`
 
 const updateDashboardReferencesScript = `#!/bin/sh
@@ -1,6 +1,35 @@
 package rancher
 
-import "testing"
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-github/v81/github"
+	ecmConfig "github.com/rancher/ecm-distro-tools/cmd/release/config"
+	reg "github.com/rancher/ecm-distro-tools/registry"
+	"github.com/rancher/ecm-distro-tools/repository"
+	"github.com/rancher/ecm-distro-tools/repository/githubtest"
+	"sigs.k8s.io/yaml"
+)
 
 const (
 	rancherRepoImage = "rancher/rancher"
@@ -90,3 +119,567 @@ func TestGenerateRegsyncConfig(t *testing.T) {
 		t.Error("rancher agent image should be: '" + sourceRancherAgentImage + "' instead, got: '" + config.Sync[1].Source + "'")
 	}
 }
+
+// newTestRegistry starts an in-memory registry with the given images and
+// returns its host and the digests of the pushed images
+func newTestRegistry(t *testing.T, images ...string) (string, map[string]v1.Hash) {
+	t.Helper()
+
+	server := httptest.NewServer(registry.New())
+	t.Cleanup(server.Close)
+	host := strings.TrimPrefix(server.URL, "http://")
+
+	digests := make(map[string]v1.Hash)
+	for _, image := range images {
+		tag, err := name.NewTag(host + "/" + image)
+		if err != nil {
+			t.Fatal(err)
+		}
+		img, err := random.Image(64, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := remote.Write(tag, img); err != nil {
+			t.Fatal(err)
+		}
+		digests[image], err = img.Digest()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return host, digests
+}
+
+func TestMissingImagesFromRegistry(t *testing.T) {
+	host, _ := newTestRegistry(t, imagesWithVersion[0], imagesWithVersion[1])
+
+	missing, err := MissingImagesFromRegistry(context.Background(), reg.NewClient(host, false), 2, imagesWithVersion, nil, nil)
+	if err != nil {
+		t.Fatalf("MissingImagesFromRegistry() error = %v", err)
+	}
+	if strings.Join(missing, ",") != imagesWithVersion[2] {
+		t.Errorf("MissingImagesFromRegistry() = %v, want [%s]", missing, imagesWithVersion[2])
+	}
+
+	missing, err = MissingImagesFromRegistry(context.Background(), reg.NewClient(host, false), 2, imagesWithVersion, []string{"k3s-io/k3s"}, nil)
+	if err != nil {
+		t.Fatalf("MissingImagesFromRegistry() error = %v", err)
+	}
+	if len(missing) != 0 {
+		t.Errorf("MissingImagesFromRegistry() = %v, want ignored images to be skipped", missing)
+	}
+}
+
+// flakyRegistryClient fails the first failures checks of every image in it
+type flakyRegistryClient struct {
+	RegistryClient
+	mu       sync.Mutex
+	failures map[string]int
+	checks   map[string]int
+}
+
+func (c *flakyRegistryClient) Image(ctx context.Context, ref name.Reference) (reg.Image, error) {
+	c.mu.Lock()
+	c.checks[ref.String()]++
+	fail := c.checks[ref.String()] <= c.failures[ref.String()]
+	c.mu.Unlock()
+
+	if fail {
+		return reg.Image{}, errors.New("unexpected status code 502")
+	}
+	return c.RegistryClient.Image(ctx, ref)
+}
+
+func TestMissingImagesFromRegistryState(t *testing.T) {
+	imageCheckBackoff = time.Millisecond
+	defer func() { imageCheckBackoff = time.Second }()
+
+	host, _ := newTestRegistry(t, imagesWithVersion[0], imagesWithVersion[1])
+	stateFile := filepath.Join(t.TempDir(), "state.json")
+
+	// the second image fails every retry, the first one succeeds after a retry
+	client := &flakyRegistryClient{
+		RegistryClient: reg.NewClient(host, false),
+		failures:       map[string]int{imagesWithVersion[0]: 1, imagesWithVersion[1]: imageCheckRetries + 1},
+		checks:         make(map[string]int),
+	}
+	_, err := MissingImagesFromRegistry(context.Background(), client, 2, imagesWithVersion, nil, NewImageChecksState(stateFile, host))
+	if err == nil || !strings.Contains(err.Error(), imagesWithVersion[1]) {
+		t.Fatalf("MissingImagesFromRegistry() error = %v, want failed check of %s", err, imagesWithVersion[1])
+	}
+
+	state, err := LoadImageChecksState(stateFile, host)
+	if err != nil {
+		t.Fatalf("LoadImageChecksState() error = %v", err)
+	}
+	want := map[string]ImageCheckStatus{
+		imagesWithVersion[0]: ImageFound,
+		imagesWithVersion[1]: ImageCheckError,
+		imagesWithVersion[2]: ImageMissing,
+	}
+	for image, status := range want {
+		if check := state.Images[image]; check.Status != status || check.CheckedAt.IsZero() {
+			t.Errorf("state of %s = %+v, want status %s", image, check, status)
+		}
+	}
+
+	// resuming only checks the image that failed
+	client.failures = nil
+	client.checks = make(map[string]int)
+	missing, err := MissingImagesFromRegistry(context.Background(), client, 2, imagesWithVersion, nil, state)
+	if err != nil {
+		t.Fatalf("MissingImagesFromRegistry() resume error = %v", err)
+	}
+	if strings.Join(missing, ",") != imagesWithVersion[2] {
+		t.Errorf("MissingImagesFromRegistry() resume = %v, want [%s]", missing, imagesWithVersion[2])
+	}
+	if len(client.checks) != 1 || client.checks[imagesWithVersion[1]] != 1 {
+		t.Errorf("resume checked %v, want only %s", client.checks, imagesWithVersion[1])
+	}
+
+	if _, err := LoadImageChecksState(stateFile, "docker.io"); err == nil {
+		t.Error("LoadImageChecksState() expected error for a state file of another registry")
+	}
+}
+
+func TestImageChecksStateBatches(t *testing.T) {
+	stateFile := filepath.Join(t.TempDir(), "state.json")
+	state := NewImageChecksState(stateFile, "registry.rancher.com")
+
+	check := ImageCheck{Status: ImageFound, CheckedAt: time.Now().UTC()}
+	for i := 1; i < stateSaveBatch; i++ {
+		if err := state.set("rancher/rancher:v2.9."+strconv.Itoa(i), check); err != nil {
+			t.Fatalf("set() error = %v", err)
+		}
+	}
+	if _, err := os.Stat(stateFile); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("state saved before a full batch, stat error = %v", err)
+	}
+
+	if err := state.set("rancher/rancher:v2.10.0", check); err != nil {
+		t.Fatalf("set() error = %v", err)
+	}
+	saved, err := LoadImageChecksState(stateFile, "registry.rancher.com")
+	if err != nil {
+		t.Fatalf("LoadImageChecksState() error = %v", err)
+	}
+	if len(saved.Images) != stateSaveBatch {
+		t.Errorf("saved %d images, want %d", len(saved.Images), stateSaveBatch)
+	}
+
+	if err := state.set("rancher/rancher:v2.10.1", check); err != nil {
+		t.Fatalf("set() error = %v", err)
+	}
+	if err := state.Save(); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	saved, err = LoadImageChecksState(stateFile, "registry.rancher.com")
+	if err != nil {
+		t.Fatalf("LoadImageChecksState() error = %v", err)
+	}
+	if len(saved.Images) != stateSaveBatch+1 {
+		t.Errorf("saved %d images, want %d", len(saved.Images), stateSaveBatch+1)
+	}
+}
+
+func TestImagesLocations(t *testing.T) {
+	target, _ := newTestRegistry(t, imagesWithVersion[0])
+	source, _ := newTestRegistry(t, imagesWithVersion[1])
+
+	newClient := func(registry string) RegistryClient {
+		return reg.NewClient(registry, false)
+	}
+
+	locations, err := ImagesLocations(context.Background(), newClient, 2, imagesWithVersion, nil, target, []string{source})
+	if err != nil {
+		t.Fatalf("ImagesLocations() error = %v", err)
+	}
+
+	sort.Strings(locations[source])
+	if strings.Join(locations[source], ",") != imagesWithVersion[1] {
+		t.Errorf("images located in source = %v, want [%s]", locations[source], imagesWithVersion[1])
+	}
+	if strings.Join(locations["missing"], ",") != imagesWithVersion[2] {
+		t.Errorf("missing images = %v, want [%s]", locations["missing"], imagesWithVersion[2])
+	}
+}
+
+func TestDockerImagesDigests(t *testing.T) {
+	host, digests := newTestRegistry(t, imagesWithVersion[0], imagesWithVersion[1])
+
+	list := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(imagesWithVersion[0] + "\n" + imagesWithVersion[1] + "\n"))
+	}))
+	defer list.Close()
+
+	got, err := dockerImagesDigests(context.Background(), reg.NewClient(host, false), list.URL, "registry.rancher.com")
+	if err != nil {
+		t.Fatalf("dockerImagesDigests() error = %v", err)
+	}
+
+	if len(got) != 2 {
+		t.Fatalf("dockerImagesDigests() returned %d images, want 2", len(got))
+	}
+	for _, d := range got {
+		image := strings.TrimPrefix(d.Image, "registry.rancher.com/")
+		if d.Digest != digests[image].String() {
+			t.Errorf("digest of %s = %q, want %q", image, d.Digest, digests[image])
+		}
+	}
+}
+
+type fakeRegistryClient map[string]reg.Image
+
+func (c fakeRegistryClient) Image(_ context.Context, ref name.Reference) (reg.Image, error) {
+	return c[ref.String()], nil
+}
+
+func TestGenerateDockerImageDigestsFormats(t *testing.T) {
+	linuxAmd64 := reg.Platform{OS: "linux", Architecture: "amd64"}
+	client := fakeRegistryClient{
+		"rancher/rancher:v2.9.0": {
+			Exists: true,
+			Digest: "sha256:01",
+			PlatformDigests: map[reg.Platform]string{
+				linuxAmd64:                           "sha256:11",
+				{OS: "linux", Architecture: "arm64"}: "sha256:12",
+				{OS: "windows", Architecture: "amd64", OSVersion: "10.0.17763.5830"}: "sha256:13",
+				{OS: "windows", Architecture: "amd64", OSVersion: "10.0.20348.2461"}: "sha256:14",
+			},
+		},
+		"rancher/rancher-agent:v2.9.0": {
+			Exists:          true,
+			Digest:          "sha256:02",
+			PlatformDigests: map[reg.Platform]string{linuxAmd64: "sha256:02"},
+		},
+	}
+
+	list := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("rancher/rancher:v2.9.0\nrancher/rancher-agent:v2.9.0\n"))
+	}))
+	defer list.Close()
+
+	tests := []struct {
+		format    string
+		unmarshal func([]byte, interface{}) error
+	}{
+		{format: DigestsFormatJSON, unmarshal: json.Unmarshal},
+		{format: DigestsFormatYAML, unmarshal: func(b []byte, v interface{}) error { return yaml.Unmarshal(b, v) }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			outputFile := filepath.Join(t.TempDir(), "digests."+tt.format)
+			if err := GenerateDockerImageDigests(context.Background(), client, outputFile, list.URL, "docker.io", tt.format); err != nil {
+				t.Fatalf("GenerateDockerImageDigests() error = %v", err)
+			}
+
+			b, err := os.ReadFile(outputFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []ImageDigests
+			if err := tt.unmarshal(b, &got); err != nil {
+				t.Fatalf("unmarshal error = %v", err)
+			}
+
+			if len(got) != 2 || got[0].Image != "docker.io/rancher/rancher-agent:v2.9.0" || got[1].Image != "docker.io/rancher/rancher:v2.9.0" {
+				t.Fatalf("unexpected images: %+v", got)
+			}
+			if got[1].Digest != "sha256:01" {
+				t.Errorf("index digest = %q, want sha256:01", got[1].Digest)
+			}
+			if len(got[1].Platforms) != 4 {
+				t.Errorf("got %d platform digests, want 4", len(got[1].Platforms))
+			}
+			if d := got[1].Platforms[reg.Platform{OS: "windows", Architecture: "amd64", OSVersion: "10.0.20348.2461"}]; d != "sha256:14" {
+				t.Errorf("windows 10.0.20348.2461 digest = %q, want sha256:14", d)
+			}
+		})
+	}
+}
+
+func TestSyncImages(t *testing.T) {
+	sourceHost, digests := newTestRegistry(t, imagesWithVersion...)
+	targetHost, _ := newTestRegistry(t)
+
+	source := reg.NewClient(sourceHost, false)
+	target := reg.NewClient(targetHost, false)
+	ctx := context.Background()
+
+	refs := make(map[string]name.Reference)
+	for _, image := range imagesWithVersion {
+		ref, err := name.ParseReference(image)
+		if err != nil {
+			t.Fatal(err)
+		}
+		refs[image] = ref
+	}
+
+	// the first image is already in the target registry
+	if err := source.Copy(ctx, refs[imagesWithVersion[0]], target); err != nil {
+		t.Fatal(err)
+	}
+
+	plan, err := SyncImages(ctx, source, target, 2, imagesWithVersion, true)
+	if err != nil {
+		t.Fatalf("SyncImages() dry run error = %v", err)
+	}
+	for i, c := range plan {
+		if c.Image != imagesWithVersion[i] || c.Digest != digests[c.Image].String() {
+			t.Errorf("plan[%d] = %+v, want %s with digest %s", i, c, imagesWithVersion[i], digests[imagesWithVersion[i]])
+		}
+		if c.Skipped != (i == 0) {
+			t.Errorf("plan[%d].Skipped = %v, want %v", i, c.Skipped, i == 0)
+		}
+	}
+	if digest, _ := target.Digest(ctx, refs[imagesWithVersion[1]]); digest != "" {
+		t.Errorf("dry run copied %s", imagesWithVersion[1])
+	}
+
+	if _, err := SyncImages(ctx, source, target, 2, imagesWithVersion, false); err != nil {
+		t.Fatalf("SyncImages() error = %v", err)
+	}
+	for _, image := range imagesWithVersion {
+		digest, err := target.Digest(ctx, refs[image])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if digest != digests[image].String() {
+			t.Errorf("target digest of %s = %q, want %q", image, digest, digests[image])
+		}
+	}
+
+	if _, err := SyncImages(ctx, target, source, 2, []string{"rancher/missing:v1.0.0"}, false); err == nil {
+		t.Error("SyncImages() expected error for an image missing from the source registry")
+	}
+}
+
+func TestDiffImages(t *testing.T) {
+	oldImages := []string{
+		"rancher/rancher:v2.9.2",
+		"rancher/fleet:v0.10.1",
+		"rancher/mirrored-coredns-coredns:1.10.1",
+		"rancher/mirrored-coredns-coredns:1.11.1",
+		"rancher/kubectl:v1.29.2",
+	}
+	newImages := []string{
+		"rancher/rancher:v2.9.3",
+		"rancher/fleet:v0.10.2",
+		"rancher/mirrored-coredns-coredns:1.11.1",
+		"rancher/kubectl:v1.29.2",
+		"rancher/rancher-webhook:v0.5.3",
+	}
+
+	diff, err := DiffImages("v2.9.2", "v2.9.3", oldImages, newImages)
+	if err != nil {
+		t.Fatalf("DiffImages() error = %v", err)
+	}
+
+	var b strings.Builder
+	if err := diff.Markdown(&b); err != nil {
+		t.Fatalf("Markdown() error = %v", err)
+	}
+
+	want := `# Images changed between v2.9.2 and v2.9.3
+
+## Added
+
+* rancher/rancher-webhook: v0.5.3
+
+## Changed
+
+* rancher/fleet: v0.10.1 -> v0.10.2
+* rancher/mirrored-coredns-coredns: 1.10.1 -> -
+* rancher/rancher: v2.9.2 -> v2.9.3
+`
+	if b.String() != want {
+		t.Errorf("Markdown() = %q, want %q", b.String(), want)
+	}
+
+	diff, err = DiffImages("v2.9.3", "v2.9.2", newImages, oldImages[:4])
+	if err != nil {
+		t.Fatalf("DiffImages() error = %v", err)
+	}
+	if len(diff.Removed) != 2 || diff.Removed[0].Repository != "rancher/kubectl" || diff.Removed[1].Repository != "rancher/rancher-webhook" {
+		t.Errorf("DiffImages().Removed = %+v, want rancher/kubectl and rancher/rancher-webhook", diff.Removed)
+	}
+}
+
+// mapRCDepsSource serves rc-deps files from memory
+type mapRCDepsSource map[string]string
+
+func (s mapRCDepsSource) Glob(pattern string) ([]string, error) {
+	var matches []string
+	for file := range s {
+		if ok, _ := path.Match(pattern, file); ok {
+			matches = append(matches, file)
+		}
+	}
+	return matches, nil
+}
+
+func (s mapRCDepsSource) ReadFile(name string) (string, error) {
+	content, ok := s[name]
+	if !ok {
+		return "", errors.New("file not found: " + name)
+	}
+	return content, nil
+}
+
+func TestEvaluateRCDeps(t *testing.T) {
+	source := mapRCDepsSource{
+		"go.mod":                  "module github.com/rancher/rancher\n\nrequire (\n\tgithub.com/rancher/wrangler v1.2.0-rc1\n\tgithub.com/rancher/norman v0.1.0-rc2 // indirect\n)\n",
+		"package/Dockerfile":      "ENV CATTLE_FLEET_MIN_VERSION=104.0.0+up0.10.0-rc.3\nENV CATTLE_KDM_BRANCH=dev-v2.9\n",
+		"pkg/settings/setting.go": "ChartDefaultBranch = NewSetting(\"chart-default-branch\", \"dev-v2.9\")\n",
+		"Dockerfile.dapper":       "", "pkg/apis/go.mod": "", "scripts/package-env": "",
+	}
+
+	report, err := evaluateRCDeps(source, "release/v2.9", nil)
+	if err != nil {
+		t.Fatalf("evaluateRCDeps() error = %v", err)
+	}
+
+	want := []RCDepsFinding{
+		{Rule: "Components with -rc", Severity: SeverityBlocking, File: "go.mod", Line: 4, Content: "github.com/rancher/wrangler v1.2.0-rc1"},
+		{Rule: "Min version components with -rc", Severity: SeverityBlocking, File: "package/Dockerfile", Line: 1, Content: "ENV CATTLE_FLEET_MIN_VERSION=104.0.0+up0.10.0-rc.3"},
+		{Rule: "KDM References with dev branch", Severity: SeverityBlocking, File: "package/Dockerfile", Line: 2, Content: "ENV CATTLE_KDM_BRANCH=dev-v2.9"},
+		{Rule: "Chart References with dev branch", Severity: SeverityBlocking, File: "pkg/settings/setting.go", Line: 1, Content: `ChartDefaultBranch = NewSetting("chart-default-branch", "dev-v2.9")`},
+	}
+	if len(report.Findings) != len(want) {
+		t.Fatalf("evaluateRCDeps() = %+v, want %+v", report.Findings, want)
+	}
+	for i := range want {
+		if report.Findings[i] != want[i] {
+			t.Errorf("finding %d = %+v, want %+v", i, report.Findings[i], want[i])
+		}
+	}
+	if report.Blocking() != 4 {
+		t.Errorf("Blocking() = %d, want 4", report.Blocking())
+	}
+
+	// configured rules replace the defaults, allowed exceptions and warnings don't block
+	rules := []ecmConfig.RCDepsRule{
+		{Name: "rc modules", Files: []string{"*.mod", "pkg/*/go.mod"}, Pattern: `-rc[0-9]+`, Severity: SeverityWarning},
+		{Name: "dev branches", Files: []string{"package/*"}, Pattern: `dev-v`, Severity: SeverityBlocking, Exceptions: []string{`KDM`}},
+	}
+	report, err = evaluateRCDeps(source, "release/v2.9", rules)
+	if err != nil {
+		t.Fatalf("evaluateRCDeps() error = %v", err)
+	}
+	if len(report.Findings) != 2 || report.Blocking() != 0 {
+		t.Errorf("evaluateRCDeps() = %+v, want 2 warnings", report.Findings)
+	}
+
+	out, err := report.ToString()
+	if err != nil {
+		t.Fatalf("ToString() error = %v", err)
+	}
+	if !strings.Contains(out, "# rc modules (warning)") || !strings.Contains(out, "(go.mod, line 5)") {
+		t.Errorf("ToString() = %q, missing the rc modules findings", out)
+	}
+
+	if _, err := evaluateRCDeps(source, "release/v2.9", []ecmConfig.RCDepsRule{{Name: "bad", Files: []string{"go.mod"}, Pattern: `-rc`, Severity: "fatal"}}); err == nil {
+		t.Error("evaluateRCDeps() expected error for an invalid severity")
+	}
+}
+
+func TestCheckRancherRCDepsFS(t *testing.T) {
+	checkout := fstest.MapFS{
+		"go.mod":                  {Data: []byte("module github.com/rancher/rancher\n\nrequire (\n\tgithub.com/rancher/wrangler v1.2.0-rc1\n\tgithub.com/rancher/norman v0.1.0-rc2 // indirect\n)\n")},
+		"package/Dockerfile":      {Data: []byte("ENV CATTLE_FLEET_MIN_VERSION=104.0.0+up0.10.0-rc.3\nENV CATTLE_KDM_BRANCH=dev-v2.9\n")},
+		"pkg/settings/setting.go": {Data: []byte("ChartDefaultBranch = NewSetting(\"chart-default-branch\", \"dev-v2.9\")\n")},
+		"Dockerfile.dapper":       {},
+		"pkg/apis/go.mod":         {},
+		"scripts/package-env":     {},
+	}
+
+	report, err := CheckRancherRCDepsFS(checkout, "/src/rancher", nil)
+	if err != nil {
+		t.Fatalf("CheckRancherRCDepsFS() error = %v", err)
+	}
+	if report.GitRef != "/src/rancher" || len(report.Findings) != 4 {
+		t.Errorf("CheckRancherRCDepsFS() = %+v, want the 4 findings of /src/rancher", report)
+	}
+
+	// globs are matched against the checkout
+	rules := []ecmConfig.RCDepsRule{{Name: "rc modules", Files: []string{"*.mod", "pkg/*/go.mod"}, Pattern: `-rc[0-9]+`, Severity: SeverityWarning, Exceptions: []string{`indirect`}}}
+	report, err = CheckRancherRCDepsFS(checkout, "/src/rancher", rules)
+	if err != nil {
+		t.Fatalf("CheckRancherRCDepsFS() error = %v", err)
+	}
+	if len(report.Findings) != 1 || report.Findings[0].File != "go.mod" {
+		t.Errorf("CheckRancherRCDepsFS() = %+v, want the go.mod finding", report.Findings)
+	}
+
+	// a missing literal path fails instead of being skipped
+	delete(checkout, "scripts/package-env")
+	if _, err := CheckRancherRCDepsFS(checkout, "/src/rancher", nil); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("CheckRancherRCDepsFS() error = %v, want fs.ErrNotExist", err)
+	}
+}
+
+func TestGithubRCDepsSourceTruncatedTree(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"sha":"release/v2.9","truncated":true,"tree":[{"path":"go.mod","type":"blob"}]}`))
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	client, err := repository.NewGithubWithURL(ctx, "token", server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	source := &githubRCDepsSource{ctx: ctx, client: client, org: "rancher", gitRef: "release/v2.9"}
+	if _, err := source.Glob("*.mod"); err == nil || !strings.Contains(err.Error(), "too large") {
+		t.Errorf("Glob() error = %v, want truncated tree error", err)
+	}
+	if files, err := source.Glob("go.mod"); err != nil || len(files) != 1 {
+		t.Errorf("Glob(go.mod) = %v, %v, want the literal path", files, err)
+	}
+}
+
+func TestCreateRelease(t *testing.T) {
+	fake := githubtest.NewServer()
+	defer fake.Close()
+
+	fake.AddRelease("rancher", "rancher", &github.RepositoryRelease{TagName: github.Ptr("v2.9.0-alpha1")})
+	fake.AddRelease("rancher", "rancher", &github.RepositoryRelease{TagName: github.Ptr("v2.9.0-rc1")})
+
+	ctx := context.Background()
+	client, err := repository.NewGithubWithURL(ctx, "token", fake.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opts := repository.CreateReleaseOpts{Owner: "rancher", Repo: "rancher", Branch: "release/v2.9", Tag: "v2.9.0"}
+	url, err := CreateRelease(ctx, client, &ecmConfig.RancherRelease{}, &opts, true, "rc")
+	if err != nil {
+		t.Fatalf("CreateRelease() error = %v", err)
+	}
+	if url != "https://github.com/rancher/rancher/releases/tag/v2.9.0-rc2" {
+		t.Errorf("CreateRelease() url = %s", url)
+	}
+	releases := fake.Releases("rancher", "rancher")
+	if created := releases[len(releases)-1]; created.GetTagName() != "v2.9.0-rc2" || created.GetName() != "Pre-release v2.9.0-rc2" || !created.GetPrerelease() {
+		t.Errorf("CreateRelease() created %+v, want pre-release v2.9.0-rc2", created)
+	}
+
+	// the first pre-release of a type starts at 1
+	opts = repository.CreateReleaseOpts{Owner: "rancher", Repo: "rancher", Branch: "main", Tag: "v2.10.0"}
+	if _, err := CreateRelease(ctx, client, &ecmConfig.RancherRelease{}, &opts, true, "alpha"); err != nil {
+		t.Fatalf("CreateRelease() error = %v", err)
+	}
+	if opts.Tag != "v2.10.0-alpha1" {
+		t.Errorf("CreateRelease() tag = %s, want v2.10.0-alpha1", opts.Tag)
+	}
+
+	// the same release can't be created twice
+	opts = repository.CreateReleaseOpts{Owner: "rancher", Repo: "rancher", Branch: "release/v2.9", Tag: "v2.9.0-rc1"}
+	if _, err := CreateRelease(ctx, client, &ecmConfig.RancherRelease{}, &opts, false, "rc"); err == nil {
+		t.Error("CreateRelease() expected error for an existing release")
+	}
+}
@@ -0,0 +1,322 @@
+package rancher
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/google/go-github/v81/github"
+	ecmConfig "github.com/rancher/ecm-distro-tools/cmd/release/config"
+)
+
+// Severities of the rc-deps rules
+const (
+	SeverityBlocking = "blocking"
+	SeverityWarning  = "warning"
+)
+
+var rancherRCDepsFiles = []string{"Dockerfile.dapper", "go.mod", "package/Dockerfile", "pkg/apis/go.mod", "pkg/settings/setting.go", "scripts/package-env"}
+
+// DefaultRCDepsRules are the rules evaluated when none are configured. Indirect
+// go.mod dependencies are always allowed.
+var DefaultRCDepsRules = []ecmConfig.RCDepsRule{
+	{
+		Name:       "Components with -rc",
+		Files:      rancherRCDepsFiles,
+		Pattern:    `-rc[0-9]+`,
+		Severity:   SeverityBlocking,
+		Exceptions: []string{`indirect`},
+	},
+	{
+		Name:       "Min version components with -rc",
+		Files:      []string{"package/Dockerfile"},
+		Pattern:    `CATTLE_\S+_MIN_VERSION.*-rc`,
+		Severity:   SeverityBlocking,
+		Exceptions: []string{`indirect`},
+	},
+	{
+		Name:       "KDM References with dev branch",
+		Files:      rancherRCDepsFiles,
+		Pattern:    `(?i)kdm.*dev-v[0-9]+\.[0-9]+|dev-v[0-9]+\.[0-9]+.*kdm`,
+		Severity:   SeverityBlocking,
+		Exceptions: []string{`indirect`},
+	},
+	{
+		Name:       "Chart References with dev branch",
+		Files:      rancherRCDepsFiles,
+		Pattern:    `(?i)chart.*dev-v[0-9]+\.[0-9]+|dev-v[0-9]+\.[0-9]+.*chart`,
+		Severity:   SeverityBlocking,
+		Exceptions: []string{`indirect`},
+	},
+}
+
+// RCDepsFinding is a line which matched a rule
+type RCDepsFinding struct {
+	Rule     string `json:"rule"`
+	Severity string `json:"severity"`
+	File     string `json:"file"`
+	Line     int    `json:"line"`
+	Content  string `json:"content"`
+}
+
+// RCDepsReport are the findings of evaluating the rc-deps rules against a git ref
+type RCDepsReport struct {
+	GitRef   string          `json:"git_ref"`
+	Findings []RCDepsFinding `json:"findings"`
+	rules    []ecmConfig.RCDepsRule
+}
+
+// Blocking returns how many findings are blocking
+func (r *RCDepsReport) Blocking() int {
+	var blocking int
+	for _, f := range r.Findings {
+		if f.Severity == SeverityBlocking {
+			blocking++
+		}
+	}
+	return blocking
+}
+
+// rcDepsSource reads the files the rules are evaluated against
+type rcDepsSource interface {
+	// Glob returns the files matching the pattern
+	Glob(pattern string) ([]string, error)
+	ReadFile(name string) (string, error)
+}
+
+// rcDepsRule is a rule with its patterns compiled
+type rcDepsRule struct {
+	ecmConfig.RCDepsRule
+	pattern    *regexp.Regexp
+	exceptions []*regexp.Regexp
+}
+
+func compileRCDepsRules(rules []ecmConfig.RCDepsRule) ([]rcDepsRule, error) {
+	compiled := make([]rcDepsRule, len(rules))
+	for i, rule := range rules {
+		if rule.Name == "" {
+			return nil, errors.New("rc-deps rule " + rule.Pattern + " has no name")
+		}
+		if rule.Severity != SeverityBlocking && rule.Severity != SeverityWarning {
+			return nil, errors.New("rc-deps rule " + rule.Name + " has an invalid severity: " + rule.Severity)
+		}
+		if len(rule.Files) == 0 {
+			return nil, errors.New("rc-deps rule " + rule.Name + " has no files")
+		}
+
+		pattern, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			return nil, errors.New("rc-deps rule " + rule.Name + " has an invalid pattern: " + err.Error())
+		}
+		compiled[i] = rcDepsRule{RCDepsRule: rule, pattern: pattern}
+
+		for _, exception := range rule.Exceptions {
+			re, err := regexp.Compile(exception)
+			if err != nil {
+				return nil, errors.New("rc-deps rule " + rule.Name + " has an invalid exception: " + err.Error())
+			}
+			compiled[i].exceptions = append(compiled[i].exceptions, re)
+		}
+	}
+
+	return compiled, nil
+}
+
+// matches reports if the line is a finding of the rule
+func (r *rcDepsRule) matches(line string) bool {
+	if !r.pattern.MatchString(line) {
+		return false
+	}
+	for _, exception := range r.exceptions {
+		if exception.MatchString(line) {
+			return false
+		}
+	}
+	return true
+}
+
+// CheckRancherRCDeps evaluates the rules against the files of the rancher repository at
+// gitRef. If no rules are given, DefaultRCDepsRules are used.
+func CheckRancherRCDeps(ctx context.Context, ghClient *github.Client, org, gitRef string, rules []ecmConfig.RCDepsRule) (*RCDepsReport, error) {
+	source := &githubRCDepsSource{ctx: ctx, client: ghClient, org: org, gitRef: gitRef}
+	return evaluateRCDeps(source, gitRef, rules)
+}
+
+// CheckRancherRCDepsFS evaluates the rules against a local checkout of the rancher repository,
+// or any other filesystem with the same layout. name identifies the checkout in the report.
+func CheckRancherRCDepsFS(fsys fs.FS, name string, rules []ecmConfig.RCDepsRule) (*RCDepsReport, error) {
+	return evaluateRCDeps(fsRCDepsSource{fsys}, name, rules)
+}
+
+func evaluateRCDeps(source rcDepsSource, gitRef string, rules []ecmConfig.RCDepsRule) (*RCDepsReport, error) {
+	if len(rules) == 0 {
+		rules = DefaultRCDepsRules
+	}
+	compiled, err := compileRCDepsRules(rules)
+	if err != nil {
+		return nil, err
+	}
+
+	// every file is read once, even if several rules match it
+	fileRules := make(map[string][]int)
+	for i, rule := range compiled {
+		for _, glob := range rule.Files {
+			files, err := source.Glob(glob)
+			if err != nil {
+				return nil, err
+			}
+			for _, file := range files {
+				fileRules[file] = append(fileRules[file], i)
+			}
+		}
+	}
+
+	files := make([]string, 0, len(fileRules))
+	for file := range fileRules {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+
+	report := RCDepsReport{
+		GitRef:   gitRef,
+		Findings: make([]RCDepsFinding, 0),
+		rules:    rules,
+	}
+
+	for _, file := range files {
+		content, err := source.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+
+		scanner := bufio.NewScanner(strings.NewReader(content))
+		lineNum := 1
+		for scanner.Scan() {
+			line := scanner.Text()
+			matched := make(map[int]bool)
+			for _, i := range fileRules[file] {
+				if matched[i] || !compiled[i].matches(line) {
+					continue
+				}
+				matched[i] = true
+				report.Findings = append(report.Findings, RCDepsFinding{
+					Rule:     compiled[i].Name,
+					Severity: compiled[i].Severity,
+					File:     file,
+					Line:     lineNum,
+					Content:  formatContentLine(line),
+				})
+			}
+			lineNum++
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	return &report, nil
+}
+
+// ToString renders the findings grouped by rule
+func (r *RCDepsReport) ToString() (string, error) {
+	type group struct {
+		ecmConfig.RCDepsRule
+		Findings []RCDepsFinding
+	}
+
+	groups := make([]group, len(r.rules))
+	for i, rule := range r.rules {
+		groups[i].RCDepsRule = rule
+		for _, f := range r.Findings {
+			if f.Rule == rule.Name {
+				groups[i].Findings = append(groups[i].Findings, f)
+			}
+		}
+	}
+
+	tmpl := template.Must(template.New("rancher-release-rc-dev-deps").Parse(checkRancherRCDepsTemplate))
+	buff := bytes.NewBuffer(nil)
+	err := tmpl.Execute(buff, groups)
+
+	return buff.String(), err
+}
+
+// githubRCDepsSource reads the files of the rancher repository from GitHub
+type githubRCDepsSource struct {
+	ctx    context.Context
+	client *github.Client
+	org    string
+	gitRef string
+	tree   []string
+}
+
+// Glob returns literal paths as they are, and matches patterns against the
+// tree of the git ref, which is only listed the first time it's needed
+func (s *githubRCDepsSource) Glob(pattern string) ([]string, error) {
+	if !strings.ContainsAny(pattern, `*?[\`) {
+		return []string{pattern}, nil
+	}
+
+	if s.tree == nil {
+		tree, _, err := s.client.Git.GetTree(s.ctx, s.org, rancherRepo, s.gitRef, true)
+		if err != nil {
+			return nil, err
+		}
+		// a truncated tree would silently skip the files past the limit
+		if tree.GetTruncated() {
+			return nil, errors.New("tree of " + s.gitRef + " is too large to match " + pattern + ", use literal paths or a local checkout")
+		}
+		s.tree = make([]string, 0, len(tree.Entries))
+		for _, entry := range tree.Entries {
+			if entry.GetType() == "blob" {
+				s.tree = append(s.tree, entry.GetPath())
+			}
+		}
+	}
+
+	var matches []string
+	for _, file := range s.tree {
+		ok, err := path.Match(pattern, file)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			matches = append(matches, file)
+		}
+	}
+
+	return matches, nil
+}
+
+func (s *githubRCDepsSource) ReadFile(name string) (string, error) {
+	return remoteGitContent(s.ctx, s.client, s.org, rancherRepo, s.gitRef, name)
+}
+
+// fsRCDepsSource reads the files of the rancher repository from a filesystem
+type fsRCDepsSource struct {
+	fsys fs.FS
+}
+
+// Glob matches patterns against the filesystem. Literal paths must exist, as
+// fs.Glob would silently skip them otherwise.
+func (s fsRCDepsSource) Glob(pattern string) ([]string, error) {
+	if !strings.ContainsAny(pattern, `*?[\`) {
+		if _, err := fs.Stat(s.fsys, pattern); err != nil {
+			return nil, err
+		}
+		return []string{pattern}, nil
+	}
+	return fs.Glob(s.fsys, pattern)
+}
+
+func (s fsRCDepsSource) ReadFile(name string) (string, error) {
+	b, err := fs.ReadFile(s.fsys, name)
+	return string(b), err
+}
@@ -5,14 +5,11 @@ import (
 	"bytes"
 	"context"
 	"errors"
-	"fmt"
 	"io"
 	"net/http"
-	"path/filepath"
 	"regexp"
 	"sort"
 	"strings"
-	"text/template"
 	"time"
 	"unicode"
 
@@ -20,48 +17,45 @@ import (
 	httpecm "github.com/rancher/ecm-distro-tools/http"
 	"github.com/rancher/ecm-distro-tools/repository"
 	"github.com/sirupsen/logrus"
-	"golang.org/x/mod/modfile"
 	"golang.org/x/mod/semver"
-	"sigs.k8s.io/yaml"
 )
 
 const (
-	k3sRepo                = "k3s"
-	rke2Repo               = "rke2"
-	uiRepo                 = "ui"
-	dashboardRepo          = "dashboard"
-	cliRepo                = "cli"
-	alternateVersion       = "1.23"
-	rke2ChartsVersionsFile = "chart_versions.yaml"
-	defaultTimeout         = 30 * time.Second
+	k3sRepo          = "k3s"
+	rke2Repo         = "rke2"
+	uiRepo           = "ui"
+	dashboardRepo    = "dashboard"
+	cliRepo          = "cli"
+	alternateVersion = "1.23"
+	defaultTimeout   = 30 * time.Second
 )
 
-type charts struct {
-	Charts []chart `yaml:"charts"`
-}
-
-type chart struct {
-	Version   string `yaml:"version"`
-	Filename  string `yaml:"filename"`
-	Bootstrap bool   `yaml:"bootstrap"`
-}
-
 type changeLogData struct {
+	// PrevMilestone is the release the changes are listed since
 	PrevMilestone string
-	Content       []repository.ChangeLog
+	// Content are the pull requests merged since PrevMilestone, each one
+	// with its Title, Note, Number and URL
+	Content []repository.ChangeLog
 }
 
+// releaseNoteData is the data every release notes template is executed with
 type releaseNoteData struct {
-	Milestone        string
-	MajorMinor       string
+	// Owner and Repo are the github repository of the release
+	Owner string
+	Repo  string
+	// Milestone is the version released, without the -rc suffix
+	Milestone string
+	// MajorMinor is the major.minor of the version, without the leading v
+	MajorMinor string
+	// ChangeLogVersion is the version without periods, as used in changelog anchors
 	ChangeLogVersion string
 	ChangeLogData    changeLogData
 }
 
+// releaseNote is the data of the release notes of a repository which are
+// filled with the versions of its components, by component name
 type releaseNote interface {
-	Fill(milestone string) error
-	Template() string
-	Repo() string
+	Fill(components map[string]string)
 }
 
 type rke2ReleaseNoteData struct {
@@ -100,61 +94,40 @@ type rke2ReleaseNoteData struct {
 	releaseNoteData
 }
 
-func (rd *rke2ReleaseNoteData) Fill(milestone string) error {
-	var containerdVersion string
-
-	if rd.MajorMinor == alternateVersion {
-		containerdVersion = goModLibVersion(containerdV2ModLib, rke2Repo, milestone)
-		if containerdVersion == "" {
-			containerdVersion = goModLibVersion(containerdModLib, rke2Repo, milestone)
-		}
-	} else {
-		containerdVersion = dockerfileVersion("hardened-containerd", rke2Repo, milestone)
-	}
-
-	rd.EtcdVersion = buildScriptVersion("ETCD_VERSION", rke2Repo, milestone)
-	rd.RuncVersion = dockerfileVersion("hardened-runc", rke2Repo, milestone)
-	rd.CanalCalicoVersion = imageTagVersion("hardened-calico", rke2Repo, milestone)
+func (rd *rke2ReleaseNoteData) Fill(components map[string]string) {
+	rd.ContainerdVersion = components["containerd"]
+	rd.EtcdVersion = components["etcd"]
+	rd.RuncVersion = components["runc"]
+	rd.HelmControllerVersion = components["helm-controller"]
+	rd.CoreDNSVersion = components["coredns"]
+	rd.CanalCalicoVersion = components["canal-calico"]
 	rd.CanalCalicoURL = createCalicoURL(rd.CanalCalicoVersion)
-	rd.CiliumVersion = imageTagVersion("cilium-cilium", rke2Repo, milestone)
-	rd.ContainerdVersion = containerdVersion
-	rd.MetricsServerVersion = imageTagVersion("metrics-server", rke2Repo, milestone)
-	rd.IngressNginxVersion = imageTagVersion("nginx-ingress-controller", rke2Repo, milestone)
-	rd.FlannelVersion = imageTagVersion("flannel", rke2Repo, milestone)
-	rd.MultusVersion = imageTagVersion("multus-cni", rke2Repo, milestone)
-	rd.CalicoVersion = imageTagVersion("calico-node", rke2Repo, milestone)
+	rd.CiliumVersion = components["cilium"]
+	rd.MetricsServerVersion = components["metrics-server"]
+	rd.IngressNginxVersion = components["ingress-nginx"]
+	rd.FlannelVersion = components["flannel"]
+	rd.MultusVersion = components["multus"]
+	rd.CalicoVersion = components["calico"]
 	rd.CalicoURL = createCalicoURL(rd.CalicoVersion)
-
-	traefikImageVersion := imageTagVersion("hardened-traefik", rke2Repo, milestone)
-	rd.TraefikImageVersion = strings.Split(traefikImageVersion, "-")[0] // removing the metadata to link to upstream traefik/traefik
-
-	// get charts versions
-	chartsData, err := rke2ChartsVersion(milestone)
-	if err != nil {
-		return err
-	}
-
-	rd.CiliumChartVersion = chartsData["rke2-cilium.yaml"].Version
-	rd.CanalChartVersion = chartsData["rke2-canal.yaml"].Version
-	rd.CalicoChartVersion = chartsData["rke2-calico.yaml"].Version
-	rd.CalicoCRDChartVersion = chartsData["rke2-calico-crd.yaml"].Version
-	rd.CoreDNSChartVersion = chartsData["rke2-coredns.yaml"].Version
-	rd.IngressNginxChartVersion = chartsData["rke2-ingress-nginx.yaml"].Version
-	rd.MetricsServerChartVersion = chartsData["rke2-metrics-server.yaml"].Version
-	rd.VsphereCSIChartVersion = chartsData["rancher-vsphere-csi.yaml"].Version
-	rd.VsphereCPIChartVersion = chartsData["rancher-vsphere-cpi.yaml"].Version
-	rd.HarvesterCloudProviderChartVersion = chartsData["harvester-cloud-provider.yaml"].Version
-	rd.HarvesterCSIDriverChartVersion = chartsData["harvester-csi-driver.yaml"].Version
-	rd.SnapshotControllerChartVersion = chartsData["rke2-snapshot-controller.yaml"].Version
-	rd.SnapshotControllerCRDChartVersion = chartsData["rke2-snapshot-controller-crd.yaml"].Version
-	rd.SnapshotValidationWebhookChartVersion = chartsData["rke2-snapshot-validation-webhook.yaml"].Version
-	rd.TraefikVersion = chartsData["rke2-traefik.yaml"].Version
-	rd.TraefikCRDVersion = chartsData["rke2-traefik-crd.yaml"].Version
-
-	return nil
+	rd.TraefikImageVersion = strings.Split(components["traefik"], "-")[0] // removing the metadata to link to upstream traefik/traefik
+
+	rd.CiliumChartVersion = components["rke2-cilium"]
+	rd.CanalChartVersion = components["rke2-canal"]
+	rd.CalicoChartVersion = components["rke2-calico"]
+	rd.CalicoCRDChartVersion = components["rke2-calico-crd"]
+	rd.CoreDNSChartVersion = components["rke2-coredns"]
+	rd.IngressNginxChartVersion = components["rke2-ingress-nginx"]
+	rd.MetricsServerChartVersion = components["rke2-metrics-server"]
+	rd.VsphereCSIChartVersion = components["rancher-vsphere-csi"]
+	rd.VsphereCPIChartVersion = components["rancher-vsphere-cpi"]
+	rd.HarvesterCloudProviderChartVersion = components["harvester-cloud-provider"]
+	rd.HarvesterCSIDriverChartVersion = components["harvester-csi-driver"]
+	rd.SnapshotControllerChartVersion = components["rke2-snapshot-controller"]
+	rd.SnapshotControllerCRDChartVersion = components["rke2-snapshot-controller-crd"]
+	rd.SnapshotValidationWebhookChartVersion = components["rke2-snapshot-validation-webhook"]
+	rd.TraefikVersion = components["rke2-traefik"]
+	rd.TraefikCRDVersion = components["rke2-traefik-crd"]
 }
-func (_ *rke2ReleaseNoteData) Template() string { return rke2ReleaseNoteTemplate }
-func (_ *rke2ReleaseNoteData) Repo() string     { return rke2Repo }
 
 type k3sReleaseNoteData struct {
 	K8sVersion                  string
@@ -174,67 +147,28 @@ type k3sReleaseNoteData struct {
 	releaseNoteData
 }
 
-func (rd *k3sReleaseNoteData) Fill(milestone string) error {
-	var runcVersion string
-	var containerdVersion string
-
-	if semver.Compare(rd.K8sVersion, "v1.24.0") == 1 && semver.Compare(rd.K8sVersion, "v1.26.5") == -1 {
-		containerdVersion = buildScriptVersion("VERSION_CONTAINERD", k3sRepo, milestone)
-	} else {
-		containerdVersion = goModLibVersion(containerdV2ModLib, k3sRepo, milestone)
-		if containerdVersion == "" {
-			containerdVersion = goModLibVersion(containerdModLib, k3sRepo, milestone)
-		}
-	}
-
-	if rd.MajorMinor == alternateVersion {
-		runcVersion = buildScriptVersion("VERSION_RUNC", k3sRepo, milestone)
-	} else {
-		runcVersion = goModLibVersion("runc", k3sRepo, milestone)
-	}
-
-	rd.KineVersion = goModLibVersion("kine", k3sRepo, milestone)
-	rd.EtcdVersion = goModLibVersion("etcd/api/v3", k3sRepo, milestone)
-	rd.ContainerdVersion = containerdVersion
-	rd.RuncVersion = runcVersion
-	rd.FlannelVersion = goModLibVersion("flannel", k3sRepo, milestone)
-	rd.MetricsServerVersion = imageTagVersion("metrics-server", k3sRepo, milestone)
-	rd.TraefikVersion = imageTagVersion("traefik", k3sRepo, milestone)
-	rd.LocalPathProvisionerVersion = imageTagVersion("local-path-provisioner", k3sRepo, milestone)
-
-	return nil
-}
-
-func (_ *k3sReleaseNoteData) Template() string { return k3sReleaseNoteTemplate }
-func (_ *k3sReleaseNoteData) Repo() string     { return k3sRepo }
-
-type uiReleaseNoteData struct {
-	releaseNoteData
-}
-
-func (_ *uiReleaseNoteData) Fill(_ string) error { return nil }
-func (_ *uiReleaseNoteData) Template() string    { return fmt.Sprintf(defaultReleaseNoteTemplate, uiRepo) }
-func (_ *uiReleaseNoteData) Repo() string        { return uiRepo }
-
-type dashboardReleaseNoteData struct {
-	releaseNoteData
-}
-
-func (_ *dashboardReleaseNoteData) Fill(_ string) error { return nil }
-func (_ *dashboardReleaseNoteData) Template() string {
-	return fmt.Sprintf(defaultReleaseNoteTemplate, dashboardRepo)
-}
-func (_ *dashboardReleaseNoteData) Repo() string { return dashboardRepo }
-
-type cliReleaseNoteData struct {
+func (rd *k3sReleaseNoteData) Fill(components map[string]string) {
+	rd.KineVersion = components["kine"]
+	rd.SQLiteVersion = components["sqlite"]
+	rd.SQLiteVersionReplaced = strings.ReplaceAll(components["sqlite"], ".", "_")
+	rd.EtcdVersion = components["etcd"]
+	rd.ContainerdVersion = components["containerd"]
+	rd.RuncVersion = components["runc"]
+	rd.FlannelVersion = components["flannel"]
+	rd.MetricsServerVersion = components["metrics-server"]
+	rd.TraefikVersion = components["traefik"]
+	rd.CoreDNSVersion = components["coredns"]
+	rd.HelmControllerVersion = components["helm-controller"]
+	rd.LocalPathProvisionerVersion = components["local-path-provisioner"]
+}
+
+// defaultReleaseNoteData is the data of repositories whose release notes only
+// have the changelog
+type defaultReleaseNoteData struct {
 	releaseNoteData
 }
 
-func (_ *cliReleaseNoteData) Fill(_ string) error { return nil }
-func (_ *cliReleaseNoteData) Template() string {
-	return fmt.Sprintf(defaultReleaseNoteTemplate, cliRepo)
-}
-func (_ *cliReleaseNoteData) Repo() string { return cliRepo }
+func (_ *defaultReleaseNoteData) Fill(_ map[string]string) {}
 
 func majMin(v string) (string, error) {
 	majMin := semver.MajorMinor(v)
@@ -265,17 +199,17 @@ func capitalize(s string) string {
 }
 
 // GenReleaseNotes genereates release notes based on the given milestone,
-// previous milestone, and repository.
+// previous milestone, and repository. The repository must have a template,
+// either compiled-in or registered with RegisterReleaseNoteTemplate.
 func GenReleaseNotes(ctx context.Context, owner, repo, milestone, prevMilestone string, client *github.Client) (*bytes.Buffer, error) {
-	funcMap := template.FuncMap{
-		"majMin":      majMin,
-		"trimPeriods": trimPeriods,
-		"split":       strings.Split,
-		"capitalize":  capitalize,
+	text, ok := releaseNoteTemplates[repo]
+	if !ok {
+		return nil, errors.New("no release notes template for repo " + repo + ", it must be k3s, rke2, ui, dashboard, cli or configured in release_notes")
+	}
+	tmpl, err := newReleaseNoteTemplate(repo, text)
+	if err != nil {
+		return nil, err
 	}
-	const templateName = "release-notes"
-	tmpl := template.New(templateName).Funcs(funcMap)
-	tmpl = template.Must(tmpl.Parse(changelogTemplate))
 
 	content, err := repository.RetrieveChangeLogContents(ctx, client, owner, repo, prevMilestone, milestone)
 	if err != nil {
@@ -291,9 +225,9 @@ func GenReleaseNotes(ctx context.Context, owner, repo, milestone, prevMilestone
 		milestoneNoRC = string(tmpMilestone)
 	}
 
-	k8sVersion := strings.Split(milestoneNoRC, "+")[0]
-	markdownVersion := strings.ReplaceAll(k8sVersion, ".", "")
-	tmp := strings.Split(strings.ReplaceAll(k8sVersion, "v", ""), ".")
+	kubernetesVersion := k8sVersion(milestone)
+	markdownVersion := strings.ReplaceAll(kubernetesVersion, ".", "")
+	tmp := strings.Split(strings.ReplaceAll(kubernetesVersion, "v", ""), ".")
 	var majorMinor string
 	if len(tmp) > 1 {
 		majorMinor = tmp[0] + "." + tmp[1]
@@ -302,11 +236,6 @@ func GenReleaseNotes(ctx context.Context, owner, repo, milestone, prevMilestone
 		majorMinor = tmp[0]
 	}
 
-	changeLogSince := strings.ReplaceAll(strings.Split(prevMilestone, "+")[0], ".", "")
-	sqliteVersionK3S := goModLibVersion("go-sqlite3", repo, milestone)
-	sqliteVersionBinding := sqliteVersionBinding(sqliteVersionK3S)
-	helmControllerVersion := goModLibVersion("helm-controller", repo, milestone)
-	coreDNSVersion := imageTagVersion("coredns", repo, milestone)
 	cgData := changeLogData{
 		PrevMilestone: prevMilestone,
 		Content:       content,
@@ -314,69 +243,62 @@ func GenReleaseNotes(ctx context.Context, owner, repo, milestone, prevMilestone
 
 	var rd releaseNote
 	commonRD := releaseNoteData{
+		Owner:            owner,
+		Repo:             repo,
 		Milestone:        milestoneNoRC,
 		MajorMinor:       majorMinor,
 		ChangeLogVersion: markdownVersion,
 		ChangeLogData:    cgData,
 	}
 
+	var rules []componentRule
 	switch repo {
 	case k3sRepo:
 		rd = &k3sReleaseNoteData{
-			releaseNoteData:       commonRD,
-			K8sVersion:            k8sVersion,
-			ChangeLogSince:        changeLogSince,
-			SQLiteVersion:         sqliteVersionBinding,
-			SQLiteVersionReplaced: strings.ReplaceAll(sqliteVersionBinding, ".", "_"),
-			HelmControllerVersion: helmControllerVersion,
-			CoreDNSVersion:        coreDNSVersion,
+			releaseNoteData: commonRD,
+			K8sVersion:      kubernetesVersion,
+			ChangeLogSince:  strings.ReplaceAll(strings.Split(prevMilestone, "+")[0], ".", ""),
 		}
+		rules = k3sComponentRules(kubernetesVersion)
 
 	case rke2Repo:
 		rd = &rke2ReleaseNoteData{
-			releaseNoteData:       commonRD,
-			K8sVersion:            k8sVersion,
-			HelmControllerVersion: helmControllerVersion,
-			CoreDNSVersion:        coreDNSVersion,
-		}
-
-	case uiRepo:
-		rd = &uiReleaseNoteData{
 			releaseNoteData: commonRD,
+			K8sVersion:      kubernetesVersion,
 		}
+		rules = rke2ComponentRules(kubernetesVersion)
 
-	case dashboardRepo:
-		rd = &dashboardReleaseNoteData{
-			releaseNoteData: commonRD,
-		}
-
-	case cliRepo:
-		rd = &cliReleaseNoteData{
+	default:
+		rd = &defaultReleaseNoteData{
 			releaseNoteData: commonRD,
 		}
-	default:
-		return nil, errors.New("invalid repo: it must be k3s, rke2, ui, dashboard or cli, received " + repo)
 	}
 
-	if err := rd.Fill(milestone); err != nil {
+	components, err := resolveComponents(NewGithubComponentSource(ctx, client, owner, repo, milestone), rules)
+	if err != nil {
 		return nil, err
 	}
+	versions := componentVersions(components)
 
-	tmpl = template.Must(tmpl.Parse(rd.Template()))
+	// the SQLite version is the one go-sqlite3 is built with
+	if repo == k3sRepo {
+		sqlite, err := resolveComponents(NewGithubComponentSource(ctx, client, "mattn", "go-sqlite3", versions["go-sqlite3"]), sqliteComponentRules)
+		if err != nil {
+			return nil, err
+		}
+		versions["sqlite"] = sqlite[0].Version
+	}
+
+	rd.Fill(versions)
 
 	b := bytes.NewBuffer(nil)
-	if err := tmpl.ExecuteTemplate(b, rd.Repo(), rd); err != nil {
+	if err := tmpl.Execute(b, rd); err != nil {
 		return nil, err
 	}
 
 	return b, nil
 }
 
-const (
-	containerdModLib   = "containerd/containerd"
-	containerdV2ModLib = containerdModLib + "/v2"
-)
-
 // CheckUpstreamRelease takes the given org, repo, and tags and checks
 // for the tags' existence.
 func CheckUpstreamRelease(ctx context.Context, client *github.Client, org, repo string, tags []string) (map[string]bool, error) {
@@ -538,131 +460,6 @@ func DeleteAssetByID(ctx context.Context, client *github.Client, owner, repo, ta
 	return nil
 }
 
-func goModLibVersion(libraryName, repo, branchVersion string) string {
-	repoName := "k3s-io/k3s"
-	if repo == rke2Repo {
-		repoName = "rancher/rke2"
-	}
-
-	goModURL := "https://raw.githubusercontent.com/" + repoName + "/" + branchVersion + "/go.mod"
-
-	resp, err := http.Get(goModURL)
-	if err != nil {
-		logrus.Debugf("failed to fetch url %s: %v", goModURL, err)
-		return ""
-	}
-	if resp.StatusCode != http.StatusOK {
-		logrus.Debugf("status error: %v when fetching %s", resp.StatusCode, goModURL)
-		return ""
-	}
-
-	b, err := io.ReadAll(resp.Body)
-	if err != nil {
-		logrus.Debugf("read body error: %v", err)
-		return ""
-	}
-
-	modFile, err := modfile.Parse("go.mod", b, nil)
-	if err != nil {
-		logrus.Debugf("failed to parse go.mod file: %v", err)
-		return ""
-	}
-
-	// use replace section if found
-	for _, replace := range modFile.Replace {
-		if strings.Contains(replace.Old.Path, libraryName) {
-			return replace.New.Version
-		}
-	}
-
-	// if replace not found search in require
-	for _, require := range modFile.Require {
-		if strings.Contains(require.Mod.Path, libraryName) {
-			return require.Mod.Version
-		}
-	}
-	logrus.Debugf("library %s not found", libraryName)
-
-	return ""
-}
-
-func buildScriptVersion(varName, repo, branchVersion string) string {
-	repoName := "k3s-io/k3s"
-
-	if repo == rke2Repo {
-		repoName = "rancher/rke2"
-	}
-
-	buildScriptURL := "https://raw.githubusercontent.com/" + repoName + "/" + branchVersion + "/scripts/version.sh"
-
-	const regex = `(?P<version>v[\d\.]+(-k3s.\w*)?)`
-	submatch := findInURL(buildScriptURL, regex, varName, true)
-
-	if len(submatch) > 1 {
-		return submatch[1]
-	}
-
-	return ""
-}
-
-func dockerfileVersion(chartName, repo, branchVersion string) string {
-	if strings.Contains(repo, "k3s") {
-		return ""
-	}
-
-	const (
-		repoName = "rancher/rke2"
-		regex    = `FROM\s+[\w-]+/[\w-]+:(.*?)(-build.*)?\s`
-	)
-
-	dockerfileURL := "https://raw.githubusercontent.com/" + repoName + "/" + branchVersion + "/Dockerfile"
-
-	submatch := findInURL(dockerfileURL, regex, chartName, true)
-	if len(submatch) > 1 {
-		return submatch[1]
-	}
-
-	return ""
-}
-
-func imageTagVersion(ImageName, repo, branchVersion string) string {
-	repoName := "k3s-io/k3s"
-
-	imageListURL := "https://raw.githubusercontent.com/" + repoName + "/" + branchVersion + "/scripts/airgap/image-list.txt"
-	if repo == rke2Repo {
-		repoName = "rancher/rke2"
-		imageListURL = "https://raw.githubusercontent.com/" + repoName + "/" + branchVersion + "/scripts/build-images"
-	}
-
-	const regex = `:(.*)(-build.*)?`
-	submatch := findInURL(imageListURL, regex, ImageName, true)
-
-	if len(submatch) > 1 {
-		if strings.Contains(submatch[1], "-build") {
-			versionSplit := strings.Split(submatch[1], "-")
-			return versionSplit[0]
-		}
-		return submatch[1]
-	}
-
-	return ""
-}
-
-func sqliteVersionBinding(sqliteVersion string) string {
-	sqliteBindingURL := "https://raw.githubusercontent.com/mattn/go-sqlite3/" + sqliteVersion + "/sqlite3-binding.h"
-	const (
-		regex = `\"(.*)\"`
-		word  = "SQLITE_VERSION"
-	)
-
-	submatch := findInURL(sqliteBindingURL, regex, word, true)
-	if len(submatch) > 1 {
-		return submatch[1]
-	}
-
-	return ""
-}
-
 func createCalicoURL(calicoVersion string) string {
 	const (
 		regex    = `\"(.*)\"`
@@ -914,42 +711,6 @@ func latestRelease(versions []*github.RepositoryRelease) *string {
 	return versions[len(versions)-1].TagName
 }
 
-// rke2ChartVersion will return the version of the rke2 chart from the chart versions file
-func rke2ChartsVersion(branchVersion string) (map[string]chart, error) {
-	chartVersionsURL := "https://raw.githubusercontent.com/rancher/rke2/" + branchVersion + "/charts/" + rke2ChartsVersionsFile
-
-	client := httpecm.NewClient(defaultTimeout)
-	resp, err := client.Get(chartVersionsURL)
-	if err != nil {
-		logrus.Debugf("failed to fetch url %s: %v", chartVersionsURL, err)
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		logrus.Debugf("status error: %v when fetching %s", resp.StatusCode, err)
-		return nil, err
-	}
-
-	b, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
-	}
-
-	var c charts
-
-	if err := yaml.Unmarshal(b, &c); err != nil {
-		return nil, err
-	}
-
-	chartsData := make(map[string]chart, len(c.Charts))
-	for _, chart := range c.Charts {
-		chartsData[filepath.Base(chart.Filename)] = chart
-	}
-
-	return chartsData, nil
-}
-
 var changelogTemplate = `
 {{- define "changelog" -}}
 ## Changes since {{.ChangeLogData.PrevMilestone}}:
@@ -1069,9 +830,7 @@ As always, we welcome and appreciate feedback from our community of users. Pleas
 // This is the default template for release notes, for
 // releases that don't have a "specific" structure for
 // their releases(e.g default generated release notes).
-const defaultReleaseNoteTemplate = `
-{{- define "%s" -}}
-<!-- {{.Milestone}} -->
+const defaultReleaseNoteTemplate = `<!-- {{.Milestone}} -->
 
 {{ template "changelog" . }}
-{{ end }}`
+`
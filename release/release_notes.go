@@ -0,0 +1,83 @@
+package release
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"text/template"
+
+	ecmConfig "github.com/rancher/ecm-distro-tools/cmd/release/config"
+)
+
+// releaseNoteTemplates are the templates of the release notes by repository.
+// k3s and rke2 are executed with the versions of their components, every other
+// repository only with the common data, see releaseNoteData.
+var releaseNoteTemplates = map[string]string{
+	k3sRepo:       k3sReleaseNoteTemplate,
+	rke2Repo:      rke2ReleaseNoteTemplate,
+	uiRepo:        defaultReleaseNoteTemplate,
+	dashboardRepo: defaultReleaseNoteTemplate,
+	cliRepo:       defaultReleaseNoteTemplate,
+}
+
+// newReleaseNoteTemplate parses the template of the release notes of the repo,
+// along with the changelog template and the functions every template can use
+func newReleaseNoteTemplate(repo, text string) (*template.Template, error) {
+	funcMap := template.FuncMap{
+		"majMin":      majMin,
+		"trimPeriods": trimPeriods,
+		"split":       strings.Split,
+		"capitalize":  capitalize,
+	}
+
+	tmpl, err := template.New(repo).Funcs(funcMap).Parse(changelogTemplate)
+	if err != nil {
+		return nil, err
+	}
+
+	// the compiled-in templates define a template named after the repo,
+	// which replaces the empty body of the template being parsed
+	return tmpl.Parse(text)
+}
+
+// RegisterReleaseNoteTemplate sets the template of the release notes of the
+// repository, replacing the compiled-in one if there's one. The template can
+// use the "changelog" template and the majMin, trimPeriods, split and
+// capitalize functions.
+func RegisterReleaseNoteTemplate(repo, text string) error {
+	if _, err := newReleaseNoteTemplate(repo, text); err != nil {
+		return errors.New("invalid release notes template for " + repo + ": " + err.Error())
+	}
+	releaseNoteTemplates[repo] = text
+
+	return nil
+}
+
+// LoadReleaseNoteTemplates registers the templates of the release_notes config.
+// Repositories configured without a template use the default one, which only
+// has the changelog, unless they already have a compiled-in template.
+func LoadReleaseNoteTemplates(templates map[string]ecmConfig.ReleaseNotes) error {
+	for repo, rn := range templates {
+		text := rn.Template
+		if rn.TemplatePath != "" {
+			b, err := os.ReadFile(rn.TemplatePath)
+			if err != nil {
+				return errors.New("failed to read release notes template for " + repo + ": " + err.Error())
+			}
+			text = string(b)
+		}
+
+		if text == "" {
+			if _, ok := releaseNoteTemplates[repo]; ok {
+				continue
+			}
+			text = defaultReleaseNoteTemplate
+		}
+
+		if err := RegisterReleaseNoteTemplate(repo, text); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
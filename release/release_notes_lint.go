@@ -0,0 +1,222 @@
+package release
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v81/github"
+	"golang.org/x/sync/errgroup"
+)
+
+// Checks of the release notes lint
+const (
+	LintEmptyField         = "empty-field"
+	LintMissingReleaseNote = "missing-release-note"
+	LintDuplicateEntry     = "duplicate-entry"
+	LintBrokenLink         = "broken-link"
+)
+
+const (
+	// linkCheckLimit is how many links are requested at once
+	linkCheckLimit = 8
+	// linkCheckRetries is how often a rate limited link is requested again
+	linkCheckRetries = 3
+)
+
+// linkRetryBackoff is how long to wait before requesting a rate limited link
+// again, doubled on every retry
+var linkRetryBackoff = 2 * time.Second
+
+// errRateLimited is returned for links which are still rate limited after
+// every retry, which doesn't mean they're broken
+var errRateLimited = errors.New("rate limited")
+
+var (
+	// markdownLinkRegex matches the links of the notes, [text](url)
+	markdownLinkRegex = regexp.MustCompile(`\[([^\]]*)\]\(([^)]*)\)`)
+	// changelogEntryRegex matches the entries of the changelog template, * Title [(#123)](url)
+	changelogEntryRegex = regexp.MustCompile(`^\* .*\[\(#(\d+)\)\]\([^)]*\)\s*$`)
+	// emptyVersionURLRegex matches links which end where a version should be,
+	// e.g. /releases/tag/, /releases/tag/v, rke2-cilium-.tgz or releaselog/.html
+	emptyVersionURLRegex = regexp.MustCompile(`(/tag/v?|-v?\.tgz|/\.html|#)$`)
+)
+
+// ReleaseNotesFinding is a problem found in the rendered release notes
+type ReleaseNotesFinding struct {
+	Line    int    `json:"line"`
+	Check   string `json:"check"`
+	Message string `json:"message"`
+}
+
+func (f ReleaseNotesFinding) String() string {
+	return "line " + strconv.Itoa(f.Line) + ": " + f.Check + ": " + f.Message
+}
+
+// LintReleaseNotes validates the rendered release notes. It reports template
+// fields which rendered empty, changelog entries without release note text,
+// duplicated entries and malformed links. If client isn't nil, every link is
+// also requested once and reported if it doesn't respond successfully. Links
+// which stay rate limited are skipped.
+func LintReleaseNotes(ctx context.Context, notes string, client *http.Client) []ReleaseNotesFinding {
+	findings := make([]ReleaseNotesFinding, 0)
+	add := func(line int, check, message string) {
+		findings = append(findings, ReleaseNotesFinding{Line: line, Check: check, Message: message})
+	}
+
+	lines := strings.Split(strings.ReplaceAll(notes, "\r\n", "\n"), "\n")
+	entries := make(map[string]int)
+	links := make(map[string]int)
+	var linkOrder []string
+
+	for i, line := range lines {
+		lineNum := i + 1
+
+		if strings.Contains(line, "<no value>") {
+			add(lineNum, LintEmptyField, "template field has no value")
+		}
+		if isTableRow(line) {
+			for _, cell := range strings.Split(strings.Trim(strings.TrimSpace(line), "|"), "|") {
+				if strings.TrimSpace(cell) == "" {
+					add(lineNum, LintEmptyField, "table row has an empty cell")
+					break
+				}
+			}
+		}
+
+		for _, match := range markdownLinkRegex.FindAllStringSubmatch(line, -1) {
+			text, target := strings.TrimSpace(match[1]), strings.TrimSpace(match[2])
+			if text == "" || text == "v" {
+				add(lineNum, LintEmptyField, "link to "+target+" has no text")
+			}
+			if target == "" {
+				add(lineNum, LintBrokenLink, "link ["+text+"] has no url")
+				continue
+			}
+			if emptyVersionURLRegex.MatchString(target) {
+				add(lineNum, LintEmptyField, "link "+target+" has no version")
+				continue
+			}
+			u, err := url.Parse(target)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				add(lineNum, LintBrokenLink, "invalid url "+target)
+				continue
+			}
+			if _, ok := links[target]; !ok {
+				links[target] = lineNum
+				linkOrder = append(linkOrder, target)
+			}
+		}
+		if strings.Count(line, "[") != strings.Count(line, "]") || strings.Count(line, "](") > strings.Count(line, ")") {
+			add(lineNum, LintBrokenLink, "unbalanced link brackets")
+		}
+
+		if submatch := changelogEntryRegex.FindStringSubmatch(line); submatch != nil {
+			pr := "#" + submatch[1]
+			if first, ok := entries[pr]; ok {
+				add(lineNum, LintDuplicateEntry, pr+" is already listed in line "+strconv.Itoa(first))
+			} else {
+				entries[pr] = lineNum
+			}
+			// the release note text is indented below the entry
+			if i+1 >= len(lines) || !strings.HasPrefix(lines[i+1], "  * ") {
+				add(lineNum, LintMissingReleaseNote, pr+" has no release note")
+			}
+		}
+	}
+
+	if client != nil {
+		errs := make([]error, len(linkOrder))
+		g := new(errgroup.Group)
+		g.SetLimit(linkCheckLimit)
+		for i, target := range linkOrder {
+			g.Go(func() error {
+				errs[i] = checkLink(ctx, client, target)
+				return nil
+			})
+		}
+		g.Wait()
+
+		for i, target := range linkOrder {
+			if errs[i] != nil && !errors.Is(errs[i], errRateLimited) {
+				add(links[target], LintBrokenLink, target+": "+errs[i].Error())
+			}
+		}
+	}
+
+	return findings
+}
+
+func isTableRow(line string) bool {
+	line = strings.TrimSpace(line)
+	return len(line) > 1 && strings.HasPrefix(line, "|") && strings.HasSuffix(line, "|")
+}
+
+// checkLink requests the url and reports error statuses. Rate limited
+// requests, which GitHub answers with 429 or 403, are retried with backoff.
+func checkLink(ctx context.Context, client *http.Client, target string) error {
+	backoff := linkRetryBackoff
+	for attempt := 0; ; attempt++ {
+		status, err := requestLink(ctx, client, target)
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case status == http.StatusTooManyRequests || status == http.StatusForbidden:
+			if attempt >= linkCheckRetries {
+				return errRateLimited
+			}
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(backoff):
+			}
+			backoff *= 2
+		case status >= 400:
+			return errors.New("status " + strconv.Itoa(status))
+		default:
+			return nil
+		}
+	}
+}
+
+// requestLink returns the status of the url, with GET if the server doesn't
+// allow HEAD
+func requestLink(ctx context.Context, client *http.Client, target string) (int, error) {
+	var status int
+	for _, method := range []string{http.MethodHead, http.MethodGet} {
+		req, err := http.NewRequestWithContext(ctx, method, target, nil)
+		if err != nil {
+			return 0, err
+		}
+		res, err := client.Do(req)
+		if err != nil {
+			return 0, err
+		}
+		res.Body.Close()
+
+		status = res.StatusCode
+		if status != http.StatusMethodNotAllowed {
+			break
+		}
+	}
+
+	return status, nil
+}
+
+// CompareReleaseNotes diffs the notes against the body of the published
+// release of the tag. It returns an empty string if they are the same.
+func CompareReleaseNotes(ctx context.Context, client *github.Client, owner, repo, tag, notes string) (string, error) {
+	published, _, err := client.Repositories.GetReleaseByTag(ctx, owner, repo, tag)
+	if err != nil {
+		return "", errors.New("failed to get release " + tag + ": " + err.Error())
+	}
+
+	return UnifiedDiff(tag+" (published)", "generated", published.GetBody(), notes), nil
+}
@@ -1,6 +1,22 @@
 package release
 
-import "testing"
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/google/go-github/v81/github"
+	ecmConfig "github.com/rancher/ecm-distro-tools/cmd/release/config"
+	"github.com/rancher/ecm-distro-tools/repository"
+	"github.com/rancher/ecm-distro-tools/repository/githubtest"
+)
 
 func TestMajMin(t *testing.T) {
 	tests := []struct {
@@ -82,3 +98,450 @@ func TestCapitalize(t *testing.T) {
 		})
 	}
 }
+
+func TestGenReleaseNotes(t *testing.T) {
+	fake := githubtest.NewServer()
+	defer fake.Close()
+
+	const (
+		milestone     = "v1.30.2+k3s1"
+		prevMilestone = "v1.30.1+k3s1"
+	)
+	fake.AddCommits("k3s-io", "k3s", "a1", "b2", "c3")
+	fake.AddTag("k3s-io", "k3s", prevMilestone, "a1")
+	fake.AddTag("k3s-io", "k3s", milestone, "c3")
+	fake.AddPullRequest("k3s-io", "k3s", &github.PullRequest{
+		Number: github.Ptr(10),
+		Title:  github.Ptr("[release-1.30] bump kine"),
+		Body:   github.Ptr("```release-note\r\nBumped kine to v0.11.9\r\n```"),
+		Merged: github.Ptr(true),
+	}, "b2", "c3")
+	fake.AddFile("k3s-io", "k3s", milestone, "go.mod", `module github.com/k3s-io/k3s
+
+go 1.22
+
+require (
+	github.com/containerd/containerd v1.7.17
+	github.com/flannel-io/flannel v0.25.2
+	github.com/k3s-io/helm-controller v0.16.1
+	github.com/k3s-io/kine v0.11.9
+	github.com/mattn/go-sqlite3 v1.14.19
+	github.com/opencontainers/runc v1.1.12
+	go.etcd.io/etcd/api/v3 v3.5.13
+)
+
+replace github.com/containerd/containerd => github.com/k3s-io/containerd v1.7.17-k3s1
+`)
+	fake.AddFile("k3s-io", "k3s", milestone, "scripts/airgap/image-list.txt", `docker.io/rancher/mirrored-coredns-coredns:1.10.1
+docker.io/rancher/local-path-provisioner:v0.0.27
+docker.io/rancher/mirrored-metrics-server:v0.7.0
+docker.io/rancher/mirrored-library-traefik:2.10.7
+`)
+	fake.AddFile("mattn", "go-sqlite3", "v1.14.19", "sqlite3-binding.h", `#define SQLITE_VERSION        "3.44.0"`)
+
+	ctx := context.Background()
+	client, err := repository.NewGithubWithURL(ctx, "", fake.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	notes, err := GenReleaseNotes(ctx, "k3s-io", "k3s", milestone, prevMilestone, client)
+	if err != nil {
+		t.Fatalf("GenReleaseNotes() error = %v", err)
+	}
+
+	for _, want := range []string{
+		"<!-- v1.30.2+k3s1 -->",
+		"## Changes since v1.30.1+k3s1:",
+		"* Bump kine [(#10)](https://github.com/k3s-io/k3s/pull/10)",
+		"Bumped kine to v0.11.9",
+		"| Kine | [v0.11.9](https://github.com/k3s-io/kine/releases/tag/v0.11.9) |",
+		"| SQLite | [3.44.0](https://sqlite.org/releaselog/3_44_0.html) |",
+		"| Etcd | [v3.5.13]",
+		"| Containerd | [v1.7.17-k3s1]",
+		"| Runc | [v1.1.12]",
+		"| Traefik | [v2.10.7]",
+		"| CoreDNS | [v1.10.1]",
+		"| Helm-controller | [v0.16.1]",
+		"| Local-path-provisioner | [v0.0.27]",
+	} {
+		if !strings.Contains(notes.String(), want) {
+			t.Errorf("GenReleaseNotes() missing %q in:\n%s", want, notes.String())
+		}
+	}
+
+	if _, err := GenReleaseNotes(ctx, "k3s-io", "k3s", "v1.30.3+k3s1", milestone, client); err == nil {
+		t.Error("GenReleaseNotes() expected error for a missing milestone tag")
+	}
+}
+
+func TestReleaseNoteTemplates(t *testing.T) {
+	for repo, text := range releaseNoteTemplates {
+		if _, err := newReleaseNoteTemplate(repo, text); err != nil {
+			t.Errorf("compiled-in template of %s: %v", repo, err)
+		}
+	}
+
+	fake := githubtest.NewServer()
+	defer fake.Close()
+
+	fake.AddCommits("rancher", "rke2-packaging", "a1", "b2")
+	fake.AddTag("rancher", "rke2-packaging", "v1.30.1+rke2r1", "a1")
+	fake.AddTag("rancher", "rke2-packaging", "v1.30.2+rke2r1", "b2")
+	fake.AddPullRequest("rancher", "rke2-packaging", &github.PullRequest{
+		Number: github.Ptr(7),
+		Title:  github.Ptr("Build rpms for el9"),
+		Merged: github.Ptr(true),
+	}, "b2")
+
+	ctx := context.Background()
+	client, err := repository.NewGithubWithURL(ctx, "", fake.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := GenReleaseNotes(ctx, "rancher", "rke2-packaging", "v1.30.2+rke2r1", "v1.30.1+rke2r1", client); err == nil {
+		t.Fatal("GenReleaseNotes() expected error for a repo without template")
+	}
+
+	defer delete(releaseNoteTemplates, "rke2-packaging")
+	templatePath := filepath.Join(t.TempDir(), "rke2-packaging.tmpl")
+	if err := os.WriteFile(templatePath, []byte(`# {{ .Owner }}/{{ .Repo }} {{ .Milestone }} ({{ .MajorMinor }})
+{{ template "changelog" . }}
+`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// configured without a template, only the changelog is generated
+	if err := LoadReleaseNoteTemplates(map[string]ecmConfig.ReleaseNotes{"rke2-packaging": {Owner: "rancher"}}); err != nil {
+		t.Fatalf("LoadReleaseNoteTemplates() error = %v", err)
+	}
+	notes, err := GenReleaseNotes(ctx, "rancher", "rke2-packaging", "v1.30.2+rke2r1", "v1.30.1+rke2r1", client)
+	if err != nil {
+		t.Fatalf("GenReleaseNotes() error = %v", err)
+	}
+	want := "<!-- v1.30.2+rke2r1 -->\n\n## Changes since v1.30.1+rke2r1:\n\n* Build rpms for el9 [(#7)](https://github.com/rancher/rke2-packaging/pull/7)\n"
+	if notes.String() != want {
+		t.Errorf("GenReleaseNotes() = %q, want %q", notes.String(), want)
+	}
+
+	if err := LoadReleaseNoteTemplates(map[string]ecmConfig.ReleaseNotes{"rke2-packaging": {Owner: "rancher", TemplatePath: templatePath}}); err != nil {
+		t.Fatalf("LoadReleaseNoteTemplates() error = %v", err)
+	}
+	notes, err = GenReleaseNotes(ctx, "rancher", "rke2-packaging", "v1.30.2+rke2r1", "v1.30.1+rke2r1", client)
+	if err != nil {
+		t.Fatalf("GenReleaseNotes() error = %v", err)
+	}
+	want = "# rancher/rke2-packaging v1.30.2+rke2r1 (1.30)\n## Changes since v1.30.1+rke2r1:\n\n* Build rpms for el9 [(#7)](https://github.com/rancher/rke2-packaging/pull/7)\n"
+	if notes.String() != want {
+		t.Errorf("GenReleaseNotes() = %q, want %q", notes.String(), want)
+	}
+
+	if err := RegisterReleaseNoteTemplate("rke2-packaging", "{{ .Milestone "); err == nil {
+		t.Error("RegisterReleaseNoteTemplate() expected error for an invalid template")
+	}
+	if err := LoadReleaseNoteTemplates(map[string]ecmConfig.ReleaseNotes{"rke2-packaging": {TemplatePath: templatePath + ".missing"}}); err == nil {
+		t.Error("LoadReleaseNoteTemplates() expected error for a missing template file")
+	}
+}
+
+func TestResolveRKE2Components(t *testing.T) {
+	checkout := fstest.MapFS{
+		"go.mod": {Data: []byte(`module github.com/rancher/rke2
+
+go 1.22
+
+require (
+	github.com/k3s-io/helm-controller v0.16.1
+	github.com/k3s-io/k3s v1.30.2
+)
+`)},
+		"Dockerfile": {Data: []byte(`ARG KUBERNETES_VERSION=dev
+FROM --platform=$BUILDPLATFORM rancher/hardened-containerd:v1.7.17-k3s1-build20240515 AS containerd
+FROM rancher/hardened-runc:v1.1.12-build20240418 AS runc
+`)},
+		"scripts/version.sh": {Data: []byte(`ETCD_VERSION=${ETCD_VERSION:-v3.5.13-k3s1}
+echo "ETCD_VERSION=${ETCD_VERSION}"
+`)},
+		"scripts/build-images": {Data: []byte(`xargs -n1 -t docker image pull --quiet << EOF > build/images-core.txt
+    ${REGISTRY}/rancher/hardened-kubernetes:${KUBERNETES_IMAGE_TAG}
+    ${REGISTRY}/rancher/hardened-coredns:v1.11.1-build20240305
+    ${REGISTRY}/rancher/hardened-k8s-metrics-server:v0.7.1-build20240401
+    ${REGISTRY}/rancher/nginx-ingress-controller:v1.10.1-hardened1
+    ${REGISTRY}/rancher/hardened-flannel:v0.25.1-build20240423
+    ${REGISTRY}/rancher/hardened-calico:v3.27.3-build20240423
+    ${REGISTRY}/rancher/mirrored-calico-node:v3.27.3
+    ${REGISTRY}/rancher/mirrored-cilium-cilium:v1.15.5
+    ${REGISTRY}/rancher/hardened-multus-cni:v4.0.2-build20240208
+EOF
+`)},
+		"charts/chart_versions.yaml": {Data: []byte(`charts:
+  - version: 1.15.500
+    filename: /charts/rke2-cilium.yaml
+  - version: v3.27.3-build2024042301
+    filename: /charts/rke2-canal.yaml
+  - version: v3.27.300
+    filename: /charts/rke2-calico.yaml
+  - version: v3.27.300
+    filename: /charts/rke2-calico-crd.yaml
+  - version: 1.29.002
+    filename: /charts/rke2-coredns.yaml
+  - version: 4.10.101
+    filename: /charts/rke2-ingress-nginx.yaml
+  - version: 3.12.002
+    filename: /charts/rke2-metrics-server.yaml
+  - version: 3.1.2-rancher400
+    filename: /charts/rancher-vsphere-csi.yaml
+  - version: 1.7.001
+    filename: /charts/rancher-vsphere-cpi.yaml
+  - version: 0.2.300
+    filename: /charts/harvester-cloud-provider.yaml
+  - version: 0.1.1700
+    filename: /charts/harvester-csi-driver.yaml
+  - version: 1.7.202
+    filename: /charts/rke2-snapshot-controller.yaml
+  - version: 1.7.202
+    filename: /charts/rke2-snapshot-controller-crd.yaml
+  - version: 1.7.302
+    filename: /charts/rke2-snapshot-validation-webhook.yaml
+`)},
+	}
+
+	components, err := ResolveRKE2Components(NewFSComponentSource(checkout), "v1.30.2-rc1+rke2r1")
+	if err != nil {
+		t.Fatalf("ResolveRKE2Components() error = %v", err)
+	}
+	versions := componentVersions(components)
+	for name, want := range map[string]string{
+		"containerd":          "v1.7.17-k3s1",
+		"etcd":                "v3.5.13-k3s1",
+		"runc":                "v1.1.12",
+		"helm-controller":     "v0.16.1",
+		"coredns":             "v1.11.1",
+		"metrics-server":      "v0.7.1",
+		"ingress-nginx":       "v1.10.1-hardened1",
+		"flannel":             "v0.25.1",
+		"canal-calico":        "v3.27.3",
+		"calico":              "v3.27.3",
+		"cilium":              "v1.15.5",
+		"multus":              "v4.0.2",
+		"rke2-cilium":         "1.15.500",
+		"rke2-metrics-server": "3.12.002",
+	} {
+		if versions[name] != want {
+			t.Errorf("component %s = %q, want %q", name, versions[name], want)
+		}
+	}
+	// traefik is optional, this release doesn't have it
+	if _, ok := versions["traefik"]; ok {
+		t.Error("ResolveRKE2Components() resolved traefik, which isn't in the images")
+	}
+
+	// missing and ambiguous components are errors
+	checkout["Dockerfile"] = &fstest.MapFile{Data: []byte("FROM rancher/hardened-runc:v1.1.12-build20240418 AS runc\n")}
+	checkout["scripts/version.sh"] = &fstest.MapFile{Data: []byte("ETCD_VERSION=v3.5.13-k3s1\nETCD_VERSION=v3.5.12-k3s1\n")}
+	_, err = ResolveRKE2Components(NewFSComponentSource(checkout), "v1.30.2+rke2r1")
+	if err == nil {
+		t.Fatal("ResolveRKE2Components() expected error")
+	}
+	for _, want := range []string{
+		"containerd: not found in Dockerfile",
+		"etcd: ambiguous in scripts/version.sh, found v3.5.13-k3s1, v3.5.12-k3s1",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("ResolveRKE2Components() error = %v, missing %q", err, want)
+		}
+	}
+}
+
+func TestResolveRKE2ComponentsOlderBranch(t *testing.T) {
+	// a release-1.23 checkout, which builds containerd from go.mod and ships
+	// neither the cloud provider nor the snapshot charts
+	checkout := fstest.MapFS{
+		"go.mod": {Data: []byte(`module github.com/rancher/rke2
+
+go 1.20
+
+require (
+	github.com/containerd/containerd v1.6.19
+	github.com/k3s-io/helm-controller v0.13.3
+)
+
+replace github.com/containerd/containerd => github.com/k3s-io/containerd v1.6.19-k3s1
+`)},
+		"Dockerfile": {Data: []byte(`FROM rancher/hardened-runc:v1.1.4-build20221005 AS runc
+`)},
+		"scripts/version.sh": {Data: []byte(`ETCD_VERSION=${ETCD_VERSION:-v3.5.4-k3s1}
+`)},
+		"scripts/build-images": {Data: []byte(`xargs -n1 -t docker image pull --quiet << EOF > build/images-core.txt
+    ${REGISTRY}/rancher/hardened-coredns:v1.9.3-build20220613
+    ${REGISTRY}/rancher/hardened-k8s-metrics-server:v0.6.1-build20220509
+    ${REGISTRY}/rancher/nginx-ingress-controller:nginx-1.5.1-hardened2
+    ${REGISTRY}/rancher/hardened-flannel:v0.20.2-build20221219
+    ${REGISTRY}/rancher/hardened-calico:v3.24.5-build20221219
+    ${REGISTRY}/rancher/mirrored-calico-node:v3.24.5
+    ${REGISTRY}/rancher/mirrored-cilium-cilium:v1.12.4
+    ${REGISTRY}/rancher/hardened-multus-cni:v3.9.2-build20221219
+EOF
+`)},
+		"charts/chart_versions.yaml": {Data: []byte(`charts:
+  - version: 1.12.401
+    filename: /charts/rke2-cilium.yaml
+  - version: v3.24.5-build2022121901
+    filename: /charts/rke2-canal.yaml
+  - version: v3.24.500
+    filename: /charts/rke2-calico.yaml
+  - version: v3.24.500
+    filename: /charts/rke2-calico-crd.yaml
+  - version: 1.19.401
+    filename: /charts/rke2-coredns.yaml
+  - version: 4.4.000
+    filename: /charts/rke2-ingress-nginx.yaml
+  - version: 2.11.100-build2021111904
+    filename: /charts/rke2-metrics-server.yaml
+`)},
+	}
+
+	components, err := ResolveRKE2Components(NewFSComponentSource(checkout), "v1.23.16+rke2r1")
+	if err != nil {
+		t.Fatalf("ResolveRKE2Components() error = %v", err)
+	}
+	versions := componentVersions(components)
+	for name, want := range map[string]string{
+		"containerd":      "v1.6.19-k3s1",
+		"etcd":            "v3.5.4-k3s1",
+		"helm-controller": "v0.13.3",
+		"rke2-coredns":    "1.19.401",
+	} {
+		if versions[name] != want {
+			t.Errorf("component %s = %q, want %q", name, versions[name], want)
+		}
+	}
+	for _, name := range []string{"rancher-vsphere-cpi", "harvester-csi-driver", "rke2-snapshot-controller", "rke2-traefik"} {
+		if _, ok := versions[name]; ok {
+			t.Errorf("ResolveRKE2Components() resolved %s, which isn't in the charts", name)
+		}
+	}
+}
+
+func TestLintReleaseNotes(t *testing.T) {
+	defer func(backoff time.Duration) { linkRetryBackoff = backoff }(linkRetryBackoff)
+	linkRetryBackoff = time.Millisecond
+
+	var mu sync.Mutex
+	limited := 0
+	links := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch {
+		case strings.HasSuffix(req.URL.Path, "/missing"):
+			w.WriteHeader(http.StatusNotFound)
+		case strings.HasSuffix(req.URL.Path, "/limited"):
+			mu.Lock()
+			limited++
+			mu.Unlock()
+			w.WriteHeader(http.StatusTooManyRequests)
+		}
+	}))
+	defer links.Close()
+
+	notes := `<!-- v1.30.2+k3s1 -->
+
+## Changes since v1.30.1+k3s1:
+
+* Bump containerd [(#100)](` + links.URL + `/pull/100)
+  * Bumped containerd to v1.7.17
+* Fix flakey test [(#101)](` + links.URL + `/pull/101)
+* Bump containerd [(#100)](` + links.URL + `/pull/100)
+  * Bumped containerd to v1.7.17
+
+## Embedded Component Versions
+| Component | Version |
+|---|---|
+| Kine | [v0.11.9](` + links.URL + `/kine) |
+| Etcd | [](https://github.com/k3s-io/etcd/releases/tag/) |
+| Traefik | [v](https://github.com/traefik/traefik/releases/tag/v) |
+| Runc | <no value> |
+| Flannel | |
+- [Check out our documentation](` + links.URL + `/missing)
+- [Open issues here](github.com/k3s-io/k3s/issues
+- [Rate limited](` + links.URL + `/limited)
+`
+
+	var got []string
+	for _, finding := range LintReleaseNotes(context.Background(), notes, links.Client()) {
+		got = append(got, finding.String())
+	}
+
+	want := []string{
+		"line 7: missing-release-note: #101 has no release note",
+		"line 8: duplicate-entry: #100 is already listed in line 5",
+		"line 15: empty-field: link to https://github.com/k3s-io/etcd/releases/tag/ has no text",
+		"line 15: empty-field: link https://github.com/k3s-io/etcd/releases/tag/ has no version",
+		"line 16: empty-field: link to https://github.com/traefik/traefik/releases/tag/v has no text",
+		"line 16: empty-field: link https://github.com/traefik/traefik/releases/tag/v has no version",
+		"line 17: empty-field: template field has no value",
+		"line 18: empty-field: table row has an empty cell",
+		"line 20: broken-link: unbalanced link brackets",
+		"line 19: broken-link: " + links.URL + "/missing: status 404",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("LintReleaseNotes() =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	// rate limited links are retried, then skipped
+	if limited != linkCheckRetries+1 {
+		t.Errorf("rate limited link requested %d times, want %d", limited, linkCheckRetries+1)
+	}
+
+	// without a client the links aren't requested
+	for _, finding := range LintReleaseNotes(context.Background(), notes, nil) {
+		if strings.HasSuffix(finding.Message, "status 404") {
+			t.Errorf("LintReleaseNotes() requested %s without a client", finding.Message)
+		}
+	}
+}
+
+func TestCompareReleaseNotes(t *testing.T) {
+	ctx := context.Background()
+	fake := githubtest.NewServer()
+	defer fake.Close()
+
+	published := "<!-- v1.30.2+k3s1 -->\r\n\r\n## Changes since v1.30.1+k3s1:\r\n\r\n* Bump containerd [(#100)](https://github.com/k3s-io/k3s/pull/100)\r\n"
+	fake.AddRelease("k3s-io", "k3s", &github.RepositoryRelease{TagName: github.Ptr("v1.30.2+k3s1"), Body: github.Ptr(published)})
+
+	client, err := repository.NewGithubWithURL(ctx, "", fake.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// line endings and trailing whitespace don't count
+	generated := strings.ReplaceAll(published, "\r\n", "\n") + "  \n"
+	diff, err := CompareReleaseNotes(ctx, client, "k3s-io", "k3s", "v1.30.2+k3s1", generated)
+	if err != nil {
+		t.Fatalf("CompareReleaseNotes() error = %v", err)
+	}
+	if diff != "" {
+		t.Errorf("CompareReleaseNotes() = %q, want no diff", diff)
+	}
+
+	generated = strings.Replace(published, "Bump containerd", "Bump containerd to v1.7.17", 1) + "* Bump runc [(#101)](https://github.com/k3s-io/k3s/pull/101)\n"
+	diff, err = CompareReleaseNotes(ctx, client, "k3s-io", "k3s", "v1.30.2+k3s1", generated)
+	if err != nil {
+		t.Fatalf("CompareReleaseNotes() error = %v", err)
+	}
+	want := `--- v1.30.2+k3s1 (published)
++++ generated
+@@ -2,4 +2,5 @@
+ 
+ ## Changes since v1.30.1+k3s1:
+ 
+-* Bump containerd [(#100)](https://github.com/k3s-io/k3s/pull/100)
++* Bump containerd to v1.7.17 [(#100)](https://github.com/k3s-io/k3s/pull/100)
++* Bump runc [(#101)](https://github.com/k3s-io/k3s/pull/101)
+`
+	if diff != want {
+		t.Errorf("CompareReleaseNotes() =\n%s\nwant\n%s", diff, want)
+	}
+
+	if _, err := CompareReleaseNotes(ctx, client, "k3s-io", "k3s", "v1.30.3+k3s1", generated); err == nil {
+		t.Error("CompareReleaseNotes() expected error for an unpublished tag")
+	}
+}
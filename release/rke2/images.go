@@ -5,17 +5,23 @@ import (
 	"errors"
 	"io"
 	"io/fs"
+	"sort"
 	"strings"
 	"sync"
 
 	"github.com/google/go-containerregistry/pkg/name"
 	reg "github.com/rancher/ecm-distro-tools/registry"
+	"github.com/sirupsen/logrus"
 	"golang.org/x/sync/errgroup"
 )
 
 // RegistryClient defines the interface for interacting with container registries
-type RegistryClient interface {
-	Image(ctx context.Context, ref name.Reference) (reg.Image, error)
+type RegistryClient = reg.ImageClient
+
+// SignatureClient is implemented by registry clients that can verify the
+// cosign signatures and attestations of an image
+type SignatureClient interface {
+	Verify(ctx context.Context, ref name.Reference, v *reg.Verifier) (reg.Verification, error)
 }
 
 type Architecture string
@@ -28,28 +34,86 @@ const (
 	ListLinuxAmd64   = "rke2-images-all.linux-amd64.txt"
 	ListLinuxArm64   = "rke2-images-all.linux-arm64.txt"
 	ListWindowsAmd64 = "rke2-images.windows-amd64.txt"
+
+	ListK3s                 = "k3s-images.txt"
+	ListK3sAirgapAmd64      = "k3s-airgap-images-amd64.txt"
+	ListK3sAirgapArm64      = "k3s-airgap-images-arm64.txt"
+	ListRancher             = "rancher-images.txt"
+	ListRancherWindowsAmd64 = "rancher-windows-images.txt"
+)
+
+// imageList is an image list asset and the platforms its images are expected on
+type imageList struct {
+	name      string
+	platforms []Architecture
+	// optional lists are skipped if the release doesn't have them
+	optional bool
+}
+
+var (
+	rke2ImageLists = []imageList{
+		{name: ListLinuxAmd64, platforms: []Architecture{LinuxAmd64}},
+		{name: ListLinuxArm64, platforms: []Architecture{LinuxArm64}},
+		{name: ListWindowsAmd64, platforms: []Architecture{WindowsAmd64}},
+	}
+
+	// k3s publishes a single list of multi-arch images, the airgap lists
+	// are only present in releases that ship per-arch airgap images
+	k3sImageLists = []imageList{
+		{name: ListK3s, platforms: []Architecture{LinuxAmd64, LinuxArm64}},
+		{name: ListK3sAirgapAmd64, platforms: []Architecture{LinuxAmd64}, optional: true},
+		{name: ListK3sAirgapArm64, platforms: []Architecture{LinuxArm64}, optional: true},
+	}
+
+	rancherImageLists = []imageList{
+		{name: ListRancher, platforms: []Architecture{LinuxAmd64, LinuxArm64}},
+		{name: ListRancherWindowsAmd64, platforms: []Architecture{WindowsAmd64}},
+	}
 )
 
-// ReleaseImage is an image listed in the images file for one or more platforms of a given RKE2 release
+// ReleaseImage is an image listed in the images file for one or more platforms of a given K3s, RKE2 or Rancher release
 type ReleaseImage struct {
-	Reference         name.Reference
-	ExpectsLinuxAmd64 bool
-	ExpectsLinuxArm64 bool
-	ExpectsWindows    bool
+	Reference         name.Reference `json:"reference"`
+	ExpectsLinuxAmd64 bool           `json:"expects_linux_amd64"`
+	ExpectsLinuxArm64 bool           `json:"expects_linux_arm64"`
+	ExpectsWindows    bool           `json:"expects_windows"`
 }
 
 // Image contains the manifest info of an image in the oss and prime registries
 type Image struct {
 	ReleaseImage
-	OSSImage   reg.Image
-	PrimeImage reg.Image
+	OSSImage          reg.Image        `json:"oss_image"`
+	PrimeImage        reg.Image        `json:"prime_image"`
+	OSSVerification   reg.Verification `json:"oss_verification"`
+	PrimeVerification reg.Verification `json:"prime_verification"`
+	// DigestMismatch is set when the image exists in both registries but
+	// the prime copy isn't the same as the oss one
+	DigestMismatch bool `json:"digest_mismatch"`
+}
+
+// MismatchedPlatforms returns the platforms whose manifests differ between
+// the oss and prime registries
+func (i Image) MismatchedPlatforms() []reg.Platform {
+	var platforms []reg.Platform
+	for platform, digest := range i.OSSImage.PlatformDigests {
+		if primeDigest, ok := i.PrimeImage.PlatformDigests[platform]; ok && primeDigest != digest {
+			platforms = append(platforms, platform)
+		}
+	}
+
+	sort.Slice(platforms, func(a, b int) bool {
+		return platforms[a].String() < platforms[b].String()
+	})
+
+	return platforms
 }
 
 type ReleaseInspector struct {
-	assets fs.FS
-	oss    RegistryClient
-	prime  RegistryClient
-	debug  bool
+	assets   fs.FS
+	oss      RegistryClient
+	prime    RegistryClient
+	verifier *reg.Verifier
+	debug    bool
 }
 
 func NewReleaseInspector(fs fs.FS, oss, prime RegistryClient, debug bool) *ReleaseInspector {
@@ -61,12 +125,20 @@ func NewReleaseInspector(fs fs.FS, oss, prime RegistryClient, debug bool) *Relea
 	}
 }
 
+// WithVerifier enables the verification of image signatures in the registries
+// whose clients implement SignatureClient
+func (r *ReleaseInspector) WithVerifier(v *reg.Verifier) *ReleaseInspector {
+	r.verifier = v
+	return r
+}
+
 func (r *ReleaseInspector) InspectRelease(ctx context.Context, version string) ([]Image, error) {
-	if !strings.Contains(version, "+rke2") {
-		return nil, errors.New("only RKE2 releases are currently supported")
+	lists, err := releaseImageLists(version)
+	if err != nil {
+		return nil, err
 	}
 
-	requiredImages, err := r.imageMap()
+	requiredImages, err := r.imageMap(lists)
 	if err != nil {
 		return nil, err
 	}
@@ -74,30 +146,38 @@ func (r *ReleaseInspector) InspectRelease(ctx context.Context, version string) (
 	return r.checkImages(ctx, requiredImages)
 }
 
+// releaseImageLists returns the image lists of the product the version belongs to
+func releaseImageLists(version string) ([]imageList, error) {
+	switch {
+	case strings.Contains(version, "+rke2"):
+		return rke2ImageLists, nil
+	case strings.Contains(version, "+k3s"):
+		return k3sImageLists, nil
+	case strings.HasPrefix(version, "v2."):
+		return rancherImageLists, nil
+	default:
+		return nil, errors.New("only K3s, RKE2 and Rancher releases are supported: " + version)
+	}
+}
+
 // imageMap reads per-platform image list files and coalesces them
 // into one map to collect images for all platforms.
-func (r *ReleaseInspector) imageMap() (map[string]ReleaseImage, error) {
+func (r *ReleaseInspector) imageMap(lists []imageList) (map[string]ReleaseImage, error) {
 	// download image lists for release
-	var (
-		amd64Images []string
-		arm64Images []string
-		winImages   []string
-	)
+	images := make([][]string, len(lists))
 
 	g := new(errgroup.Group)
 
-	g.Go(func() (err error) {
-		amd64Images, err = r.readImageList(ListLinuxAmd64)
-		return err
-	})
-	g.Go(func() (err error) {
-		arm64Images, err = r.readImageList(ListLinuxArm64)
-		return err
-	})
-	g.Go(func() (err error) {
-		winImages, err = r.readImageList(ListWindowsAmd64)
-		return
-	})
+	for i, list := range lists {
+		g.Go(func() error {
+			content, err := r.readImageList(list.name)
+			if list.optional && errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			images[i] = content
+			return err
+		})
+	}
 
 	if err := g.Wait(); err != nil {
 		return nil, err
@@ -105,13 +185,8 @@ func (r *ReleaseInspector) imageMap() (map[string]ReleaseImage, error) {
 
 	// merge all images into a map
 	imageMap := make(map[string]ReleaseImage)
-	for _, imagePair := range [][2]interface{}{
-		{amd64Images, LinuxAmd64},
-		{arm64Images, LinuxArm64},
-		{winImages, WindowsAmd64},
-	} {
-		images, arch := imagePair[0].([]string), imagePair[1].(Architecture)
-		for _, image := range images {
+	for i, list := range lists {
+		for _, image := range images[i] {
 			if image == "" {
 				continue
 			}
@@ -125,13 +200,15 @@ func (r *ReleaseInspector) imageMap() (map[string]ReleaseImage, error) {
 			info := imageMap[key]
 			info.Reference = ref
 
-			switch arch {
-			case LinuxAmd64:
-				info.ExpectsLinuxAmd64 = true
-			case LinuxArm64:
-				info.ExpectsLinuxArm64 = true
-			case WindowsAmd64:
-				info.ExpectsWindows = true
+			for _, arch := range list.platforms {
+				switch arch {
+				case LinuxAmd64:
+					info.ExpectsLinuxAmd64 = true
+				case LinuxArm64:
+					info.ExpectsLinuxArm64 = true
+				case WindowsAmd64:
+					info.ExpectsWindows = true
+				}
 			}
 
 			imageMap[key] = info
@@ -181,9 +258,12 @@ func (r *ReleaseInspector) checkImages(ctx context.Context, requiredImages map[s
 			}
 
 			resultChan <- Image{
-				ReleaseImage: img,
-				OSSImage:     ossImage,
-				PrimeImage:   primeImage,
+				ReleaseImage:      img,
+				OSSImage:          ossImage,
+				PrimeImage:        primeImage,
+				OSSVerification:   r.verify(ctx, r.oss, ossImage, img.Reference),
+				PrimeVerification: r.verify(ctx, r.prime, primeImage, img.Reference),
+				DigestMismatch:    ossImage.Exists && primeImage.Exists && ossImage.Digest != primeImage.Digest,
 			}
 		}(required)
 	}
@@ -200,3 +280,24 @@ func (r *ReleaseInspector) checkImages(ctx context.Context, requiredImages map[s
 
 	return results, nil
 }
+
+// verify checks the signatures of an image found in the registry. Failing to
+// reach the registry is reported as a failed verification.
+func (r *ReleaseInspector) verify(ctx context.Context, client RegistryClient, image reg.Image, ref name.Reference) reg.Verification {
+	var result reg.Verification
+
+	sigClient, ok := client.(SignatureClient)
+	if r.verifier == nil || !ok || !image.Exists {
+		return result
+	}
+
+	result, err := sigClient.Verify(ctx, ref, r.verifier)
+	if err != nil {
+		if r.debug {
+			logrus.Info("failed to verify " + ref.String() + ": " + err.Error())
+		}
+		result.Signature = reg.VerificationFailed
+	}
+
+	return result
+}
@@ -24,7 +24,7 @@ func newMockFS() fs.FS {
 func TestImageMap(t *testing.T) {
 	inspector := NewReleaseInspector(newMockFS(), nil, nil, false)
 
-	imageMap, err := inspector.imageMap()
+	imageMap, err := inspector.imageMap(rke2ImageLists)
 	if err != nil {
 		t.Fatalf("imageMap() error = %v", err)
 	}
@@ -70,6 +70,96 @@ func TestImageMap(t *testing.T) {
 	}
 }
 
+func TestImageMapProducts(t *testing.T) {
+	type expects struct {
+		amd64 bool
+		arm64 bool
+		win   bool
+	}
+
+	tests := []struct {
+		name    string
+		version string
+		assets  fstest.MapFS
+		want    map[string]expects
+		wantErr bool
+	}{
+		{
+			name:    "k3s without airgap lists",
+			version: "v1.30.2+k3s1",
+			assets: fstest.MapFS{
+				ListK3s: &fstest.MapFile{Data: []byte("docker.io/rancher/klipper-helm:v0.8.4-build20240523\ndocker.io/rancher/mirrored-pause:3.6")},
+			},
+			want: map[string]expects{
+				"rancher/klipper-helm:v0.8.4-build20240523": {amd64: true, arm64: true},
+				"rancher/mirrored-pause:3.6":                {amd64: true, arm64: true},
+			},
+		},
+		{
+			name:    "k3s with airgap lists",
+			version: "v1.30.2+k3s1",
+			assets: fstest.MapFS{
+				ListK3s:            &fstest.MapFile{Data: []byte("docker.io/rancher/mirrored-pause:3.6")},
+				ListK3sAirgapAmd64: &fstest.MapFile{Data: []byte("docker.io/rancher/mirrored-pause:3.6\ndocker.io/rancher/klipper-lb:v0.4.7")},
+			},
+			want: map[string]expects{
+				"rancher/mirrored-pause:3.6": {amd64: true, arm64: true},
+				"rancher/klipper-lb:v0.4.7":  {amd64: true},
+			},
+		},
+		{
+			name:    "rancher",
+			version: "v2.9.3",
+			assets: fstest.MapFS{
+				ListRancher:             &fstest.MapFile{Data: []byte("rancher/rancher:v2.9.3\nrancher/rancher-agent:v2.9.3")},
+				ListRancherWindowsAmd64: &fstest.MapFile{Data: []byte("rancher/rancher-agent:v2.9.3\nrancher/wins:v0.4.18")},
+			},
+			want: map[string]expects{
+				"rancher/rancher:v2.9.3":       {amd64: true, arm64: true},
+				"rancher/rancher-agent:v2.9.3": {amd64: true, arm64: true, win: true},
+				"rancher/wins:v0.4.18":         {win: true},
+			},
+		},
+		{
+			name:    "rancher without windows list",
+			version: "v2.9.3",
+			assets: fstest.MapFS{
+				ListRancher: &fstest.MapFile{Data: []byte("rancher/rancher:v2.9.3")},
+			},
+			wantErr: true,
+		},
+		{
+			name:    "unsupported product",
+			version: "v1.30.2",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lists, err := releaseImageLists(tt.version)
+			if err == nil {
+				inspector := NewReleaseInspector(tt.assets, nil, nil, false)
+				var imageMap map[string]ReleaseImage
+				imageMap, err = inspector.imageMap(lists)
+				if err == nil && len(imageMap) != len(tt.want) {
+					t.Errorf("imageMap() returned %d images, want %d", len(imageMap), len(tt.want))
+				}
+				for imageName, expected := range tt.want {
+					image := imageMap[imageName]
+					got := expects{amd64: image.ExpectsLinuxAmd64, arm64: image.ExpectsLinuxArm64, win: image.ExpectsWindows}
+					if got != expected {
+						t.Errorf("image %s: got %+v, want %+v", imageName, got, expected)
+					}
+				}
+			}
+			if (err != nil) != tt.wantErr {
+				t.Errorf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
 func TestReadImageList(t *testing.T) {
 	tests := []struct {
 		name     string
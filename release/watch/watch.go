@@ -0,0 +1,288 @@
+package watch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v81/github"
+	reg "github.com/rancher/ecm-distro-tools/registry"
+	"github.com/rancher/ecm-distro-tools/release"
+	"github.com/rancher/ecm-distro-tools/release/rke2"
+	"github.com/rancher/ecm-distro-tools/repository"
+)
+
+// Check verifies a single aspect of a release, returning whether it is
+// complete and a short human readable detail describing the current state.
+type Check struct {
+	Name string
+	Run  func(ctx context.Context) (bool, string, error)
+}
+
+// Status is the last observed result of a check.
+type Status struct {
+	OK     bool
+	Detail string
+	Err    error
+}
+
+func (s Status) String() string {
+	switch {
+	case s.Err != nil:
+		return "error (" + s.Err.Error() + ")"
+	case s.OK:
+		return "ok" + detail(s.Detail)
+	default:
+		return "pending" + detail(s.Detail)
+	}
+}
+
+func detail(d string) string {
+	if d == "" {
+		return ""
+	}
+	return " (" + d + ")"
+}
+
+// ErrDeadlineExceeded is returned by Run when the context is done before
+// every check passed.
+type ErrDeadlineExceeded struct {
+	Failing []string
+}
+
+func (e *ErrDeadlineExceeded) Error() string {
+	return "deadline exceeded with failing checks: " + strings.Join(e.Failing, ", ")
+}
+
+// Watcher polls a set of checks and writes every state transition to out.
+type Watcher struct {
+	checks   []Check
+	interval time.Duration
+	out      io.Writer
+	states   map[string]Status
+	now      func() time.Time
+}
+
+// NewWatcher creates a watcher that runs the given checks every interval.
+func NewWatcher(out io.Writer, interval time.Duration, checks ...Check) *Watcher {
+	return &Watcher{
+		checks:   checks,
+		interval: interval,
+		out:      out,
+		states:   make(map[string]Status, len(checks)),
+		now:      time.Now,
+	}
+}
+
+// Run polls the checks until all of them pass or the context is done. When
+// the context expires first, an *ErrDeadlineExceeded is returned listing the
+// checks that were still failing.
+func (w *Watcher) Run(ctx context.Context) error {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		if w.poll(ctx) {
+			fmt.Fprintln(w.out, w.timestamp(), "all checks passed")
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return &ErrDeadlineExceeded{Failing: w.failing()}
+		case <-ticker.C:
+		}
+	}
+}
+
+// poll runs every check once, reporting transitions, and returns whether
+// all checks passed.
+func (w *Watcher) poll(ctx context.Context) bool {
+	allOK := true
+
+	for _, check := range w.checks {
+		// completed checks are not run again, a published release won't
+		// go back to pending and this saves API calls on every tick
+		if prev, ok := w.states[check.Name]; ok && prev.OK {
+			continue
+		}
+
+		var status Status
+		status.OK, status.Detail, status.Err = check.Run(ctx)
+		if status.Err != nil {
+			status.OK = false
+		}
+
+		prev, seen := w.states[check.Name]
+		if !seen || prev.String() != status.String() {
+			from := "unknown"
+			if seen {
+				from = prev.String()
+			}
+			fmt.Fprintf(w.out, "%s %s: %s -> %s\n", w.timestamp(), check.Name, from, status)
+		}
+		w.states[check.Name] = status
+
+		if !status.OK {
+			allOK = false
+		}
+	}
+
+	return allOK
+}
+
+func (w *Watcher) failing() []string {
+	var names []string
+	for _, check := range w.checks {
+		if !w.states[check.Name].OK {
+			names = append(names, check.Name)
+		}
+	}
+	return names
+}
+
+func (w *Watcher) timestamp() string {
+	return w.now().UTC().Format(time.RFC3339)
+}
+
+// TagCheck verifies that the given tag exists in the repository.
+func TagCheck(client *github.Client, owner, repo, tag string) Check {
+	return Check{
+		Name: "tag",
+		Run: func(ctx context.Context) (bool, string, error) {
+			ref, _, err := client.Git.GetRef(ctx, owner, repo, "tags/"+tag)
+			if err != nil {
+				var ghErr *github.ErrorResponse
+				if errors.As(err, &ghErr) && ghErr.Response.StatusCode == http.StatusNotFound {
+					return false, "not found", nil
+				}
+				return false, "", err
+			}
+			sha := ref.GetObject().GetSHA()
+			if len(sha) > 7 {
+				sha = sha[:7]
+			}
+			return true, sha, nil
+		},
+	}
+}
+
+// ReleaseCheck verifies that a GitHub release exists for the given tag and
+// reports whether it is still a draft or a pre-release.
+func ReleaseCheck(client *github.Client, owner, repo, tag string) Check {
+	return Check{
+		Name: "release",
+		Run: func(ctx context.Context) (bool, string, error) {
+			releases, err := repository.ListReleases(ctx, client, owner, repo)
+			if err != nil {
+				return false, "", err
+			}
+			for _, r := range releases {
+				if r.GetTagName() != tag {
+					continue
+				}
+				if r.GetDraft() {
+					return false, "draft", nil
+				}
+				if r.GetPrerelease() {
+					return true, "pre-release", nil
+				}
+				return true, "published", nil
+			}
+			return false, "not found", nil
+		},
+	}
+}
+
+// AssetsCheck verifies that the release for the given tag has the expected
+// number of assets.
+func AssetsCheck(client *github.Client, owner, repo, tag string) Check {
+	return Check{
+		Name: "assets",
+		Run: func(ctx context.Context) (bool, string, error) {
+			verified, err := release.VerifyAssets(ctx, client, owner, repo, []string{tag})
+			if err != nil {
+				return false, "", err
+			}
+			if verified[tag] {
+				return true, "", nil
+			}
+			assets, err := release.ListAssets(ctx, client, owner, repo, tag)
+			if err != nil {
+				return false, "", err
+			}
+			return false, strconv.Itoa(len(assets)) + " assets", nil
+		},
+	}
+}
+
+// ImagesCheck verifies that every image listed in the release assets exists
+// in the oss and prime registries for all of its expected platforms.
+func ImagesCheck(client *github.Client, owner, repo, tag string, oss, prime rke2.RegistryClient, debug bool) Check {
+	return Check{
+		Name: "images",
+		Run: func(ctx context.Context) (bool, string, error) {
+			filesystem, err := release.NewFS(ctx, client, owner, repo, tag)
+			if err != nil {
+				var ghErr *github.ErrorResponse
+				if errors.As(err, &ghErr) && ghErr.Response.StatusCode == http.StatusNotFound {
+					return false, "release not found", nil
+				}
+				return false, "", err
+			}
+
+			inspector := rke2.NewReleaseInspector(filesystem, oss, prime, debug)
+			images, err := inspector.InspectRelease(ctx, tag)
+			if err != nil {
+				if errors.Is(err, fs.ErrNotExist) {
+					return false, "image lists not uploaded", nil
+				}
+				return false, "", err
+			}
+
+			var incomplete int
+			for _, image := range images {
+				if !imageComplete(image, prime != nil) {
+					incomplete++
+				}
+			}
+			if incomplete > 0 {
+				return false, strconv.Itoa(incomplete) + "/" + strconv.Itoa(len(images)) + " images incomplete", nil
+			}
+			return true, strconv.Itoa(len(images)) + " images", nil
+		},
+	}
+}
+
+// imageComplete reports whether the image exists with all of its expected
+// platforms in the oss registry, and in the prime registry if checked. Windows
+// images are only checked for existence, the same as in release inspect.
+func imageComplete(image rke2.Image, checkPrime bool) bool {
+	if image.DigestMismatch {
+		return false
+	}
+
+	images := []reg.Image{image.OSSImage}
+	if checkPrime {
+		images = append(images, image.PrimeImage)
+	}
+	for _, img := range images {
+		if !img.Exists {
+			return false
+		}
+		if image.ExpectsLinuxAmd64 && !img.Platforms[reg.Platform{OS: "linux", Architecture: "amd64"}] {
+			return false
+		}
+		if image.ExpectsLinuxArm64 && !img.Platforms[reg.Platform{OS: "linux", Architecture: "arm64"}] {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,109 @@
+package watch
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	reg "github.com/rancher/ecm-distro-tools/registry"
+	"github.com/rancher/ecm-distro-tools/release/rke2"
+)
+
+func TestWatcherRun(t *testing.T) {
+	var calls int
+	checks := []Check{
+		{
+			Name: "tag",
+			Run: func(ctx context.Context) (bool, string, error) {
+				return true, "abc1234", nil
+			},
+		},
+		{
+			Name: "release",
+			Run: func(ctx context.Context) (bool, string, error) {
+				calls++
+				if calls < 3 {
+					return false, "not found", nil
+				}
+				return true, "published", nil
+			},
+		},
+	}
+
+	var buf bytes.Buffer
+	w := NewWatcher(&buf, time.Millisecond, checks...)
+	w.now = func() time.Time { return time.Time{} }
+
+	if err := w.Run(context.Background()); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	want := []string{
+		"0001-01-01T00:00:00Z tag: unknown -> ok (abc1234)",
+		"0001-01-01T00:00:00Z release: unknown -> pending (not found)",
+		"0001-01-01T00:00:00Z release: pending (not found) -> ok (published)",
+		"0001-01-01T00:00:00Z all checks passed",
+	}
+	if got := strings.Split(strings.TrimSpace(buf.String()), "\n"); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Run() output = %q, want %q", got, want)
+	}
+}
+
+func TestWatcherRunDeadline(t *testing.T) {
+	checks := []Check{
+		{
+			Name: "assets",
+			Run: func(ctx context.Context) (bool, string, error) {
+				return false, "12 assets", nil
+			},
+		},
+		{
+			Name: "images",
+			Run: func(ctx context.Context) (bool, string, error) {
+				return false, "", errors.New("registry unavailable")
+			},
+		},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	var buf bytes.Buffer
+	err := NewWatcher(&buf, time.Millisecond, checks...).Run(ctx)
+
+	var deadlineErr *ErrDeadlineExceeded
+	if !errors.As(err, &deadlineErr) {
+		t.Fatalf("Run() error = %v, want *ErrDeadlineExceeded", err)
+	}
+	if got := strings.Join(deadlineErr.Failing, ","); got != "assets,images" {
+		t.Errorf("failing checks = %s, want assets,images", got)
+	}
+	if n := strings.Count(buf.String(), "\n"); n != 2 {
+		t.Errorf("expected 2 transitions to be reported, got %d: %q", n, buf.String())
+	}
+}
+
+func TestImageComplete(t *testing.T) {
+	amd64 := reg.Platform{OS: "linux", Architecture: "amd64"}
+	arm64 := reg.Platform{OS: "linux", Architecture: "arm64"}
+	image := rke2.Image{
+		ReleaseImage: rke2.ReleaseImage{ExpectsLinuxAmd64: true, ExpectsLinuxArm64: true},
+		OSSImage:     reg.Image{Exists: true, Platforms: map[reg.Platform]bool{amd64: true, arm64: true}},
+		PrimeImage:   reg.Image{Exists: true, Platforms: map[reg.Platform]bool{amd64: true}},
+	}
+
+	if !imageComplete(image, false) {
+		t.Error("expected the image to be complete in the oss registry")
+	}
+	// the prime image is missing linux/arm64
+	if imageComplete(image, true) {
+		t.Error("expected the image to be incomplete in the prime registry")
+	}
+	image.PrimeImage.Platforms[arm64] = true
+	if !imageComplete(image, true) {
+		t.Error("expected the image to be complete in both registries")
+	}
+}
@@ -0,0 +1,332 @@
+package repository
+
+import (
+	"context"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/google/go-github/v81/github"
+	"golang.org/x/mod/semver"
+)
+
+var rcSuffixRegex = regexp.MustCompile(`-rc\d+`)
+
+// Reasons a pull request is picked for a commit associated with several
+const (
+	PickedMergeCommit = "merged the commit"
+	PickedMilestone   = "in the release milestone"
+	PickedBranch      = "based on the release branch"
+	PickedNewest      = "newest pull request"
+)
+
+// OrphanCommit is a commit without a pull request, e.g. a direct push or a
+// commit of a bot
+type OrphanCommit struct {
+	SHA     string `json:"sha"`
+	Message string `json:"message"`
+}
+
+// MultiPRCommit is a commit associated with several pull requests, e.g. a
+// squash merged backport, and the pull request the changelog lists for it
+type MultiPRCommit struct {
+	SHA          string `json:"sha"`
+	PullRequests []int  `json:"pull_requests"`
+	Picked       int    `json:"picked"`
+	Reason       string `json:"reason"`
+}
+
+// ChangeLogReport reconciles the commits between two releases with their
+// pull requests and with the pull requests of the release milestone
+type ChangeLogReport struct {
+	PrevMilestone string `json:"prev_milestone"`
+	Milestone     string `json:"milestone"`
+	// ReleaseMilestone is the title of the GitHub milestone of the release,
+	// empty if the repository has no such milestone
+	ReleaseMilestone string          `json:"release_milestone"`
+	ChangeLog        []ChangeLog     `json:"changelog"`
+	OrphanCommits    []OrphanCommit  `json:"orphan_commits"`
+	MultiPRCommits   []MultiPRCommit `json:"multi_pr_commits"`
+	// NotInRange are the pull requests merged in the release milestone which
+	// aren't associated with any commit between the releases
+	NotInRange []ChangeLog `json:"not_in_range"`
+	// NotInMilestone are the pull requests of the changelog which aren't in
+	// the release milestone
+	NotInMilestone []ChangeLog `json:"not_in_milestone"`
+}
+
+// releaseMilestone returns the title of the milestone of a release, which
+// doesn't have the -rc suffix of release candidates
+func releaseMilestone(milestone string) string {
+	return rcSuffixRegex.ReplaceAllString(milestone, "")
+}
+
+// releaseNoteText returns the text of the release-note block of a pull
+// request body, which is empty if the block is empty or NONE
+func releaseNoteText(body string) string {
+	if !strings.Contains(body, releaseNoteSection) || strings.Contains(body, emptyReleaseNote) || strings.Contains(body, noneReleaseNote) {
+		return ""
+	}
+
+	var releaseNote string
+	var inNote bool
+	for _, line := range strings.Split(body, "\n") {
+		if strings.Contains(line, releaseNoteSection) {
+			inNote = true
+			continue
+		}
+		if strings.Contains(line, "```") {
+			inNote = false
+		}
+		if inNote && line != "" {
+			line = strings.TrimPrefix(line, "* ")
+			releaseNote += line
+		}
+	}
+	releaseNote = strings.TrimSpace(releaseNote)
+
+	return strings.ReplaceAll(releaseNote, "\r", "\n")
+}
+
+func newChangeLog(pr *github.PullRequest) ChangeLog {
+	return ChangeLog{
+		Title:  stripBackportTag(strings.TrimSpace(pr.GetTitle())),
+		Note:   releaseNoteText(pr.GetBody()),
+		Number: pr.GetNumber(),
+		URL:    pr.GetHTMLURL(),
+	}
+}
+
+// mergedPullRequests returns the pull requests which were merged. GitHub also
+// associates commits with the open and the closed pull requests which
+// contain them.
+func mergedPullRequests(prs []*github.PullRequest) []*github.PullRequest {
+	merged := make([]*github.PullRequest, 0, len(prs))
+	for _, pr := range prs {
+		if pr.GetMerged() || pr.MergedAt != nil {
+			merged = append(merged, pr)
+		}
+	}
+	return merged
+}
+
+// onReleaseBranch reports if the branch is the release branch of the minor of
+// the milestone, e.g. release-1.30 or release/v1.30 for v1.30.2+k3s1
+func onReleaseBranch(branch, milestone string) bool {
+	majorMinor := strings.TrimPrefix(semver.MajorMinor(milestone), "v")
+	if majorMinor == "" || !strings.HasSuffix(branch, majorMinor) {
+		return false
+	}
+	prefix := strings.TrimSuffix(strings.TrimSuffix(branch, majorMinor), "v")
+	return strings.HasSuffix(prefix, "-") || strings.HasSuffix(prefix, "/")
+}
+
+// pickPullRequest returns the pull request to list for a commit associated
+// with several: the one which merged the commit, else the only one in the
+// release milestone, else the only one based on the release branch, else the
+// newest, since backports are opened after the pull requests they backport
+func pickPullRequest(sha, milestone string, prs []*github.PullRequest) (*github.PullRequest, string) {
+	for _, pr := range prs {
+		if pr.GetMergeCommitSHA() == sha {
+			return pr, PickedMergeCommit
+		}
+	}
+
+	var inMilestone []*github.PullRequest
+	for _, pr := range prs {
+		if pr.GetMilestone().GetTitle() == milestone {
+			inMilestone = append(inMilestone, pr)
+		}
+	}
+	if len(inMilestone) == 1 {
+		return inMilestone[0], PickedMilestone
+	}
+
+	var onBranch []*github.PullRequest
+	for _, pr := range prs {
+		if onReleaseBranch(pr.GetBase().GetRef(), milestone) {
+			onBranch = append(onBranch, pr)
+		}
+	}
+	if len(onBranch) == 1 {
+		return onBranch[0], PickedBranch
+	}
+
+	newest := prs[0]
+	for _, pr := range prs[1:] {
+		if pr.GetNumber() > newest.GetNumber() {
+			newest = pr
+		}
+	}
+	return newest, PickedNewest
+}
+
+// rangeCommits returns the commits after prevMilestone up to milestone
+func rangeCommits(ctx context.Context, client *github.Client, owner, repo, prevMilestone, milestone string) ([]*github.RepositoryCommit, error) {
+	var commits []*github.RepositoryCommit
+	opts := &github.ListOptions{PerPage: 100}
+	for {
+		comp, resp, err := client.Repositories.CompareCommits(ctx, owner, repo, prevMilestone, milestone, opts)
+		if err != nil {
+			return nil, err
+		}
+		commits = append(commits, comp.Commits...)
+		if resp.NextPage == 0 {
+			return commits, nil
+		}
+		opts.Page = resp.NextPage
+	}
+}
+
+// reconcileCommits lists the pull requests of the commits between the
+// releases in the report, and returns them. Each pull request is listed once.
+func reconcileCommits(ctx context.Context, client *github.Client, owner, repo string, report *ChangeLogReport) ([]*github.PullRequest, error) {
+	commits, err := rangeCommits(ctx, client, owner, repo, report.PrevMilestone, report.Milestone)
+	if err != nil {
+		return nil, err
+	}
+
+	shas := make([]string, 0, len(commits))
+	for _, commit := range commits {
+		if sha := commit.GetSHA(); sha != "" {
+			shas = append(shas, sha)
+		}
+	}
+	prs, err := commitsPullRequests(ctx, client, owner, repo, shas)
+	if err != nil {
+		return nil, err
+	}
+
+	milestone := releaseMilestone(report.Milestone)
+	added := make(map[int]bool)
+	var listed []*github.PullRequest
+	for _, commit := range commits {
+		sha := commit.GetSHA()
+		if sha == "" {
+			continue
+		}
+
+		var pr *github.PullRequest
+		switch commitPRs := mergedPullRequests(prs[sha]); len(commitPRs) {
+		case 0:
+			message, _, _ := strings.Cut(commit.GetCommit().GetMessage(), "\n")
+			report.OrphanCommits = append(report.OrphanCommits, OrphanCommit{SHA: sha, Message: message})
+			continue
+		case 1:
+			pr = commitPRs[0]
+		default:
+			var reason string
+			pr, reason = pickPullRequest(sha, milestone, commitPRs)
+			multi := MultiPRCommit{SHA: sha, Picked: pr.GetNumber(), Reason: reason}
+			for _, commitPR := range commitPRs {
+				multi.PullRequests = append(multi.PullRequests, commitPR.GetNumber())
+			}
+			report.MultiPRCommits = append(report.MultiPRCommits, multi)
+		}
+
+		if added[pr.GetNumber()] {
+			continue
+		}
+		added[pr.GetNumber()] = true
+		listed = append(listed, pr)
+		report.ChangeLog = append(report.ChangeLog, newChangeLog(pr))
+	}
+
+	return listed, nil
+}
+
+// RetrieveChangeLogContents gets the relevant changes
+// for the given release, formats, and returns them.
+func RetrieveChangeLogContents(ctx context.Context, client *github.Client, owner, repo, prevMilestone, milestone string) ([]ChangeLog, error) {
+	report := ChangeLogReport{PrevMilestone: prevMilestone, Milestone: milestone}
+	if _, err := reconcileCommits(ctx, client, owner, repo, &report); err != nil {
+		return nil, err
+	}
+
+	return report.ChangeLog, nil
+}
+
+// ReconcileChangeLog lists the changes between the releases along with the
+// commits which have no pull request or several, and cross-checks them with
+// the pull requests merged in the milestone of the release. The cross-check
+// is skipped if the repository has no milestone titled after the release.
+func ReconcileChangeLog(ctx context.Context, client *github.Client, owner, repo, prevMilestone, milestone string) (*ChangeLogReport, error) {
+	report := ChangeLogReport{
+		PrevMilestone:  prevMilestone,
+		Milestone:      milestone,
+		ChangeLog:      make([]ChangeLog, 0),
+		OrphanCommits:  make([]OrphanCommit, 0),
+		MultiPRCommits: make([]MultiPRCommit, 0),
+		NotInRange:     make([]ChangeLog, 0),
+		NotInMilestone: make([]ChangeLog, 0),
+	}
+	listed, err := reconcileCommits(ctx, client, owner, repo, &report)
+	if err != nil {
+		return nil, err
+	}
+
+	title := releaseMilestone(milestone)
+	prs, found, err := milestonePullRequests(ctx, client, owner, repo, title)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return &report, nil
+	}
+	report.ReleaseMilestone = title
+
+	inRange := make(map[int]bool, len(listed))
+	for _, pr := range listed {
+		inRange[pr.GetNumber()] = true
+		if pr.GetMilestone().GetTitle() != title {
+			report.NotInMilestone = append(report.NotInMilestone, newChangeLog(pr))
+		}
+	}
+	for _, pr := range prs {
+		if !inRange[pr.GetNumber()] {
+			report.NotInRange = append(report.NotInRange, newChangeLog(pr))
+		}
+	}
+	sort.Slice(report.NotInRange, func(i, j int) bool {
+		return report.NotInRange[i].Number < report.NotInRange[j].Number
+	})
+
+	return &report, nil
+}
+
+// String renders the report as text, the changelog itself is left out
+func (r *ChangeLogReport) String() string {
+	var sb strings.Builder
+	sb.WriteString("Changes from " + r.PrevMilestone + " to " + r.Milestone + ": " + strconv.Itoa(len(r.ChangeLog)) + " pull requests\n")
+
+	sb.WriteString("\nCommits without a pull request: " + strconv.Itoa(len(r.OrphanCommits)) + "\n")
+	for _, c := range r.OrphanCommits {
+		sb.WriteString("  " + c.SHA + " " + c.Message + "\n")
+	}
+
+	sb.WriteString("\nCommits with several pull requests: " + strconv.Itoa(len(r.MultiPRCommits)) + "\n")
+	for _, c := range r.MultiPRCommits {
+		numbers := make([]string, len(c.PullRequests))
+		for i, number := range c.PullRequests {
+			numbers[i] = "#" + strconv.Itoa(number)
+		}
+		sb.WriteString("  " + c.SHA + " " + strings.Join(numbers, ", ") + ", picked #" + strconv.Itoa(c.Picked) + " (" + c.Reason + ")\n")
+	}
+
+	if r.ReleaseMilestone == "" {
+		sb.WriteString("\nNo milestone " + releaseMilestone(r.Milestone) + ", skipped the milestone cross-check\n")
+		return sb.String()
+	}
+
+	sb.WriteString("\nIn milestone " + r.ReleaseMilestone + " but not in the commits: " + strconv.Itoa(len(r.NotInRange)) + "\n")
+	for _, cl := range r.NotInRange {
+		sb.WriteString("  #" + strconv.Itoa(cl.Number) + " " + cl.Title + "\n")
+	}
+	sb.WriteString("\nIn the commits but not in milestone " + r.ReleaseMilestone + ": " + strconv.Itoa(len(r.NotInMilestone)) + "\n")
+	for _, cl := range r.NotInMilestone {
+		sb.WriteString("  #" + strconv.Itoa(cl.Number) + " " + cl.Title + "\n")
+	}
+
+	return sb.String()
+}
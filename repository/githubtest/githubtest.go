@@ -0,0 +1,889 @@
+// Package githubtest provides an in-process fake of the GitHub API for tests.
+// It only implements the endpoints used by the release tooling, and is seeded
+// with the repositories, branches, tags, releases, milestones, pull requests,
+// issues and files a test needs. Files are also served the way
+// raw.githubusercontent.com serves them, under RawURL. The GraphQL API only
+// answers the queries of the pull requests associated with commits and of the
+// pull requests of milestones, and requires a token like GitHub does.
+package githubtest
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/v81/github"
+)
+
+// Server is a fake GitHub API. The zero value is not usable, use NewServer.
+type Server struct {
+	// URL is the base URL of the API, to be used as the github client BaseURL
+	URL string
+	// RawURL is the base URL of the raw files, in the form RawURL + owner/repo/ref/path
+	RawURL string
+
+	server *httptest.Server
+	mu     sync.Mutex
+	repos  map[string]*repo
+	nextID int64
+	clock  time.Time
+	user   *github.User
+	token  string
+}
+
+type repo struct {
+	owner        string
+	name         string
+	commits      []string
+	branches     map[string]string
+	tags         []*github.RepositoryTag
+	releases     []*github.RepositoryRelease
+	milestones   []*github.Milestone
+	pullRequests []*github.PullRequest
+	pullCommits  map[int][]string
+	issues       []*github.Issue
+	files        map[string]map[string]string
+}
+
+// NewServer starts a fake GitHub API with no repositories. It must be
+// closed when the test finishes.
+func NewServer() *Server {
+	s := &Server{
+		repos: make(map[string]*repo),
+		clock: time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /repos/{owner}/{repo}/releases", s.listReleases)
+	mux.HandleFunc("POST /repos/{owner}/{repo}/releases", s.createRelease)
+	mux.HandleFunc("GET /repos/{owner}/{repo}/releases/tags/{tag}", s.getReleaseByTag)
+	mux.HandleFunc("GET /repos/{owner}/{repo}/tags", s.listTags)
+	mux.HandleFunc("GET /repos/{owner}/{repo}/git/ref/{ref...}", s.getRef)
+	mux.HandleFunc("GET /repos/{owner}/{repo}/git/matching-refs/{ref...}", s.listMatchingRefs)
+	mux.HandleFunc("GET /repos/{owner}/{repo}/compare/{basehead}", s.compareCommits)
+	mux.HandleFunc("GET /repos/{owner}/{repo}/commits/{sha}/pulls", s.listPullRequestsWithCommit)
+	mux.HandleFunc("GET /repos/{owner}/{repo}/pulls", s.listPullRequests)
+	mux.HandleFunc("GET /repos/{owner}/{repo}/pulls/{number}", s.getPullRequest)
+	mux.HandleFunc("GET /repos/{owner}/{repo}/issues", s.listIssues)
+	mux.HandleFunc("POST /repos/{owner}/{repo}/issues", s.createIssue)
+	mux.HandleFunc("GET /repos/{owner}/{repo}/issues/{number}", s.getIssue)
+	mux.HandleFunc("GET /repos/{owner}/{repo}/milestones", s.listMilestones)
+	mux.HandleFunc("GET /repos/{owner}/{repo}/contents/{path...}", s.getContents)
+	mux.HandleFunc("GET /repos/{owner}/{repo}/git/trees/{ref...}", s.getTree)
+	mux.HandleFunc("GET /raw/{owner}/{repo}/{ref}/{path...}", s.getRaw)
+	mux.HandleFunc("POST /graphql", s.graphQL)
+	mux.HandleFunc("GET /user", s.getAuthenticatedUser)
+
+	s.server = httptest.NewServer(mux)
+	s.URL = s.server.URL + "/"
+	s.RawURL = s.server.URL + "/raw/"
+
+	return s
+}
+
+// Close shuts down the server
+func (s *Server) Close() {
+	s.server.Close()
+}
+
+// repo returns the repository, creating it if create is true. The lock must be held.
+func (s *Server) repo(owner, name string, create bool) *repo {
+	key := owner + "/" + name
+	r, ok := s.repos[key]
+	if !ok && create {
+		r = &repo{
+			owner:       owner,
+			name:        name,
+			branches:    make(map[string]string),
+			pullCommits: make(map[int][]string),
+			files:       make(map[string]map[string]string),
+		}
+		s.repos[key] = r
+	}
+	return r
+}
+
+// tick returns a time after every time returned before, so releases are
+// published in the order they're created
+func (s *Server) tick() github.Timestamp {
+	s.clock = s.clock.Add(time.Hour)
+	return github.Timestamp{Time: s.clock}
+}
+
+func (s *Server) htmlURL(r *repo, path string) string {
+	return "https://github.com/" + r.owner + "/" + r.name + "/" + path
+}
+
+// AddCommits appends the commits to the history of the repository, oldest first
+func (s *Server) AddCommits(owner, name string, shas ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r := s.repo(owner, name, true)
+	r.commits = append(r.commits, shas...)
+}
+
+// AddBranch creates a branch pointing to the commit
+func (s *Server) AddBranch(owner, name, branch, sha string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r := s.repo(owner, name, true)
+	r.branches[branch] = sha
+}
+
+// SetUser sets the user authenticated by the token. Only the authenticated
+// user endpoint checks the token of the requests.
+func (s *Server) SetUser(login, token string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.user = &github.User{Login: github.Ptr(login)}
+	s.token = token
+}
+
+// AddTag creates a tag pointing to the commit
+func (s *Server) AddTag(owner, name, tag, sha string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r := s.repo(owner, name, true)
+	r.tags = append(r.tags, &github.RepositoryTag{
+		Name:   github.Ptr(tag),
+		Commit: &github.Commit{SHA: github.Ptr(sha)},
+	})
+}
+
+// AddRelease adds a release, published after every release added before it
+// unless it's a draft. The ID and HTML URL are set if they're empty.
+func (s *Server) AddRelease(owner, name string, release *github.RepositoryRelease) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.addRelease(s.repo(owner, name, true), release)
+}
+
+func (s *Server) addRelease(r *repo, release *github.RepositoryRelease) {
+	if release.ID == nil {
+		s.nextID++
+		release.ID = github.Ptr(s.nextID)
+	}
+	if release.HTMLURL == nil {
+		release.HTMLURL = github.Ptr(s.htmlURL(r, "releases/tag/"+release.GetTagName()))
+	}
+	now := s.tick()
+	release.CreatedAt = &now
+	if !release.GetDraft() && release.PublishedAt == nil {
+		release.PublishedAt = &now
+	}
+	r.releases = append(r.releases, release)
+}
+
+// AddMilestone adds a milestone. The number is set if it's empty.
+func (s *Server) AddMilestone(owner, name string, milestone *github.Milestone) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r := s.repo(owner, name, true)
+	if milestone.Number == nil {
+		milestone.Number = github.Ptr(len(r.milestones) + 1)
+	}
+	if milestone.State == nil {
+		milestone.State = github.Ptr("open")
+	}
+	r.milestones = append(r.milestones, milestone)
+}
+
+// AddPullRequest adds a pull request which merged the commits. The HTML URL
+// is set if it's empty.
+func (s *Server) AddPullRequest(owner, name string, pr *github.PullRequest, commits ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r := s.repo(owner, name, true)
+	if pr.HTMLURL == nil {
+		pr.HTMLURL = github.Ptr(s.htmlURL(r, "pull/"+strconv.Itoa(pr.GetNumber())))
+	}
+	r.pullRequests = append(r.pullRequests, pr)
+	r.pullCommits[pr.GetNumber()] = commits
+}
+
+// AddIssue adds an issue. The HTML URL is set if it's empty.
+func (s *Server) AddIssue(owner, name string, issue *github.Issue) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.addIssue(s.repo(owner, name, true), issue)
+}
+
+func (s *Server) addIssue(r *repo, issue *github.Issue) {
+	if issue.Number == nil {
+		issue.Number = github.Ptr(r.nextNumber())
+	}
+	if issue.HTMLURL == nil {
+		issue.HTMLURL = github.Ptr(s.htmlURL(r, "issues/"+strconv.Itoa(issue.GetNumber())))
+	}
+	r.issues = append(r.issues, issue)
+}
+
+// nextNumber returns a number after every issue and pull request, which share
+// the same sequence
+func (r *repo) nextNumber() int {
+	var last int
+	for _, issue := range r.issues {
+		last = max(last, issue.GetNumber())
+	}
+	for _, pr := range r.pullRequests {
+		last = max(last, pr.GetNumber())
+	}
+	return last + 1
+}
+
+// milestoneNumber returns the number of the milestone with the title, or 0
+// if there's no such milestone
+func (r *repo) milestoneNumber(title string) int {
+	for _, milestone := range r.milestones {
+		if milestone.GetTitle() == title {
+			return milestone.GetNumber()
+		}
+	}
+	return 0
+}
+
+// AddFile adds a file with the content at the git ref, which can be a tag, a
+// branch or a commit
+func (s *Server) AddFile(owner, name, ref, path, content string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r := s.repo(owner, name, true)
+	if _, ok := r.files[ref]; !ok {
+		r.files[ref] = make(map[string]string)
+	}
+	r.files[ref][path] = content
+}
+
+// Releases returns the releases of the repository, including the ones created
+// through the API, in the order they were created
+func (s *Server) Releases(owner, name string) []*github.RepositoryRelease {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if r := s.repo(owner, name, false); r != nil {
+		return slices.Clone(r.releases)
+	}
+	return nil
+}
+
+// Issues returns the issues of the repository, including the ones created
+// through the API, in the order they were created
+func (s *Server) Issues(owner, name string) []*github.Issue {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if r := s.repo(owner, name, false); r != nil {
+		return slices.Clone(r.issues)
+	}
+	return nil
+}
+
+// lookup returns the repository of the request, or writes a not found error
+func (s *Server) lookup(w http.ResponseWriter, req *http.Request) *repo {
+	r := s.repo(req.PathValue("owner"), req.PathValue("repo"), false)
+	if r == nil {
+		writeError(w, http.StatusNotFound, "Not Found")
+	}
+	return r
+}
+
+// resolve returns the commit of a tag or commit sha, or an empty string
+func (r *repo) resolve(ref string) string {
+	for _, tag := range r.tags {
+		if tag.GetName() == ref {
+			return tag.GetCommit().GetSHA()
+		}
+	}
+	if slices.Contains(r.commits, ref) {
+		return ref
+	}
+	return ""
+}
+
+func (s *Server) listReleases(w http.ResponseWriter, req *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r := s.lookup(w, req)
+	if r == nil {
+		return
+	}
+
+	// the newest releases are listed first
+	releases := slices.Clone(r.releases)
+	slices.Reverse(releases)
+	writeJSON(w, http.StatusOK, releases)
+}
+
+func (s *Server) createRelease(w http.ResponseWriter, req *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r := s.lookup(w, req)
+	if r == nil {
+		return
+	}
+
+	var release github.RepositoryRelease
+	if err := json.NewDecoder(req.Body).Decode(&release); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if release.GetTagName() == "" {
+		writeError(w, http.StatusUnprocessableEntity, "tag_name is required")
+		return
+	}
+	for _, existing := range r.releases {
+		if existing.GetTagName() == release.GetTagName() {
+			writeError(w, http.StatusUnprocessableEntity, "Validation Failed: tag_name already_exists")
+			return
+		}
+	}
+
+	// publishing a release creates its tag at the head of the history
+	if !release.GetDraft() && r.resolve(release.GetTagName()) == "" && len(r.commits) > 0 {
+		r.tags = append(r.tags, &github.RepositoryTag{
+			Name:   release.TagName,
+			Commit: &github.Commit{SHA: github.Ptr(r.commits[len(r.commits)-1])},
+		})
+	}
+
+	s.addRelease(r, &release)
+	writeJSON(w, http.StatusCreated, release)
+}
+
+func (s *Server) getReleaseByTag(w http.ResponseWriter, req *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r := s.lookup(w, req)
+	if r == nil {
+		return
+	}
+
+	for _, release := range r.releases {
+		if release.GetTagName() == req.PathValue("tag") {
+			writeJSON(w, http.StatusOK, release)
+			return
+		}
+	}
+	writeError(w, http.StatusNotFound, "Not Found")
+}
+
+func (s *Server) listTags(w http.ResponseWriter, req *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r := s.lookup(w, req)
+	if r == nil {
+		return
+	}
+
+	tags := slices.Clone(r.tags)
+	slices.Reverse(tags)
+	writeJSON(w, http.StatusOK, tags)
+}
+
+// getRef returns the reference of a tag, tags/<name>, or of a branch, heads/<name>
+func (s *Server) getRef(w http.ResponseWriter, req *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r := s.lookup(w, req)
+	if r == nil {
+		return
+	}
+
+	ref := req.PathValue("ref")
+	var sha string
+	if tag, ok := strings.CutPrefix(ref, "tags/"); ok {
+		for _, t := range r.tags {
+			if t.GetName() == tag {
+				sha = t.GetCommit().GetSHA()
+			}
+		}
+	} else if branch, ok := strings.CutPrefix(ref, "heads/"); ok {
+		sha = r.branches[branch]
+	}
+	if sha == "" {
+		writeError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, github.Reference{
+		Ref:    github.Ptr("refs/" + ref),
+		Object: &github.GitObject{Type: github.Ptr("commit"), SHA: github.Ptr(sha)},
+	})
+}
+
+// listMatchingRefs returns the references of the tags and branches starting
+// with the ref, e.g. tags/v1.30., tags first
+func (s *Server) listMatchingRefs(w http.ResponseWriter, req *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r := s.lookup(w, req)
+	if r == nil {
+		return
+	}
+
+	prefix := "refs/" + req.PathValue("ref")
+	refs := make([]*github.Reference, 0)
+	add := func(ref, sha string) {
+		if strings.HasPrefix(ref, prefix) {
+			refs = append(refs, &github.Reference{
+				Ref:    github.Ptr(ref),
+				Object: &github.GitObject{Type: github.Ptr("commit"), SHA: github.Ptr(sha)},
+			})
+		}
+	}
+	for _, tag := range r.tags {
+		add("refs/tags/"+tag.GetName(), tag.GetCommit().GetSHA())
+	}
+	branches := slices.Sorted(maps.Keys(r.branches))
+	for _, branch := range branches {
+		add("refs/heads/"+branch, r.branches[branch])
+	}
+	writeJSON(w, http.StatusOK, refs)
+}
+
+// compareCommits returns the commits after base up to head in the history
+func (s *Server) compareCommits(w http.ResponseWriter, req *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r := s.lookup(w, req)
+	if r == nil {
+		return
+	}
+
+	base, head, ok := strings.Cut(req.PathValue("basehead"), "...")
+	if !ok {
+		writeError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+	baseIdx := slices.Index(r.commits, r.resolve(base))
+	headIdx := slices.Index(r.commits, r.resolve(head))
+	if baseIdx == -1 || headIdx == -1 {
+		writeError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+
+	comparison := github.CommitsComparison{
+		Status:       github.Ptr("ahead"),
+		AheadBy:      github.Ptr(max(headIdx-baseIdx, 0)),
+		TotalCommits: github.Ptr(max(headIdx-baseIdx, 0)),
+		Commits:      make([]*github.RepositoryCommit, 0),
+	}
+	for _, sha := range r.commits[min(baseIdx+1, headIdx+1) : headIdx+1] {
+		comparison.Commits = append(comparison.Commits, &github.RepositoryCommit{SHA: github.Ptr(sha)})
+	}
+	writeJSON(w, http.StatusOK, comparison)
+}
+
+func (s *Server) listPullRequestsWithCommit(w http.ResponseWriter, req *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r := s.lookup(w, req)
+	if r == nil {
+		return
+	}
+
+	prs := make([]*github.PullRequest, 0)
+	for _, pr := range r.pullRequests {
+		if slices.Contains(r.pullCommits[pr.GetNumber()], req.PathValue("sha")) {
+			prs = append(prs, pr)
+		}
+	}
+	writeJSON(w, http.StatusOK, prs)
+}
+
+func (s *Server) listPullRequests(w http.ResponseWriter, req *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r := s.lookup(w, req)
+	if r == nil {
+		return
+	}
+
+	state := req.URL.Query().Get("state")
+	prs := make([]*github.PullRequest, 0)
+	for _, pr := range r.pullRequests {
+		if state == "" || state == "all" || state == pr.GetState() {
+			prs = append(prs, pr)
+		}
+	}
+	writeJSON(w, http.StatusOK, prs)
+}
+
+func (s *Server) getPullRequest(w http.ResponseWriter, req *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r := s.lookup(w, req)
+	if r == nil {
+		return
+	}
+
+	for _, pr := range r.pullRequests {
+		if strconv.Itoa(pr.GetNumber()) == req.PathValue("number") {
+			writeJSON(w, http.StatusOK, pr)
+			return
+		}
+	}
+	writeError(w, http.StatusNotFound, "Not Found")
+}
+
+func (s *Server) listIssues(w http.ResponseWriter, req *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r := s.lookup(w, req)
+	if r == nil {
+		return
+	}
+
+	// pull requests are listed as issues too
+	all := slices.Clone(r.issues)
+	for _, pr := range r.pullRequests {
+		all = append(all, pullRequestIssue(pr))
+	}
+
+	state := req.URL.Query().Get("state")
+	milestone := req.URL.Query().Get("milestone")
+	issues := make([]*github.Issue, 0)
+	for _, issue := range all {
+		if milestone != "" && milestone != "*" && strconv.Itoa(r.milestoneNumber(issue.GetMilestone().GetTitle())) != milestone {
+			continue
+		}
+		if state == "all" || state == issue.GetState() || (state == "" && issue.GetState() != "closed") {
+			issues = append(issues, issue)
+		}
+	}
+	writeJSON(w, http.StatusOK, issues)
+}
+
+// pullRequestIssue returns the pull request as the issues API lists it. Merged
+// pull requests are closed unless their state is set.
+func pullRequestIssue(pr *github.PullRequest) *github.Issue {
+	merged := pr.GetMerged() || pr.MergedAt != nil
+	issue := github.Issue{
+		Number:           pr.Number,
+		Title:            pr.Title,
+		Body:             pr.Body,
+		State:            pr.State,
+		HTMLURL:          pr.HTMLURL,
+		Milestone:        pr.Milestone,
+		PullRequestLinks: &github.PullRequestLinks{HTMLURL: pr.HTMLURL, MergedAt: pr.MergedAt},
+	}
+	if issue.State == nil {
+		issue.State = github.Ptr("open")
+		if merged {
+			issue.State = github.Ptr("closed")
+		}
+	}
+	if merged && pr.MergedAt == nil {
+		issue.PullRequestLinks.MergedAt = &github.Timestamp{}
+	}
+	return &issue
+}
+
+func (s *Server) createIssue(w http.ResponseWriter, req *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r := s.lookup(w, req)
+	if r == nil {
+		return
+	}
+
+	var ir github.IssueRequest
+	if err := json.NewDecoder(req.Body).Decode(&ir); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if ir.GetTitle() == "" {
+		writeError(w, http.StatusUnprocessableEntity, "title is required")
+		return
+	}
+
+	issue := github.Issue{
+		Title: ir.Title,
+		Body:  ir.Body,
+		State: github.Ptr("open"),
+	}
+	if ir.GetState() != "" {
+		issue.State = ir.State
+	}
+	if ir.GetAssignee() != "" {
+		issue.Assignee = &github.User{Login: ir.Assignee}
+	}
+	for _, label := range ir.GetLabels() {
+		issue.Labels = append(issue.Labels, &github.Label{Name: github.Ptr(label)})
+	}
+	if ir.Milestone != nil {
+		for _, milestone := range r.milestones {
+			if milestone.GetNumber() == ir.GetMilestone() {
+				issue.Milestone = milestone
+			}
+		}
+	}
+
+	s.addIssue(r, &issue)
+	writeJSON(w, http.StatusCreated, issue)
+}
+
+func (s *Server) getIssue(w http.ResponseWriter, req *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r := s.lookup(w, req)
+	if r == nil {
+		return
+	}
+
+	for _, issue := range r.issues {
+		if strconv.Itoa(issue.GetNumber()) == req.PathValue("number") {
+			writeJSON(w, http.StatusOK, issue)
+			return
+		}
+	}
+	writeError(w, http.StatusNotFound, "Not Found")
+}
+
+func (s *Server) listMilestones(w http.ResponseWriter, req *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r := s.lookup(w, req)
+	if r == nil {
+		return
+	}
+
+	state := req.URL.Query().Get("state")
+	milestones := make([]*github.Milestone, 0)
+	for _, milestone := range r.milestones {
+		if state == "all" || state == milestone.GetState() || (state == "" && milestone.GetState() == "open") {
+			milestones = append(milestones, milestone)
+		}
+	}
+	writeJSON(w, http.StatusOK, milestones)
+}
+
+func (s *Server) getContents(w http.ResponseWriter, req *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r := s.lookup(w, req)
+	if r == nil {
+		return
+	}
+
+	path := req.PathValue("path")
+	content, ok := r.files[req.URL.Query().Get("ref")][path]
+	if !ok {
+		writeError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, github.RepositoryContent{
+		Type:     github.Ptr("file"),
+		Name:     github.Ptr(path[strings.LastIndex(path, "/")+1:]),
+		Path:     github.Ptr(path),
+		Encoding: github.Ptr("base64"),
+		Content:  github.Ptr(base64.StdEncoding.EncodeToString([]byte(content))),
+		Size:     github.Ptr(len(content)),
+	})
+}
+
+// getTree lists every file at the git ref, as a recursive tree would
+func (s *Server) getTree(w http.ResponseWriter, req *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r := s.lookup(w, req)
+	if r == nil {
+		return
+	}
+
+	ref := req.PathValue("ref")
+	files, ok := r.files[ref]
+	if !ok {
+		writeError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+
+	tree := github.Tree{SHA: github.Ptr(ref), Truncated: github.Ptr(false)}
+	for path := range files {
+		tree.Entries = append(tree.Entries, &github.TreeEntry{
+			Path: github.Ptr(path),
+			Type: github.Ptr("blob"),
+			Mode: github.Ptr("100644"),
+		})
+	}
+	slices.SortFunc(tree.Entries, func(a, b *github.TreeEntry) int {
+		return strings.Compare(a.GetPath(), b.GetPath())
+	})
+	writeJSON(w, http.StatusOK, tree)
+}
+
+func (s *Server) getRaw(w http.ResponseWriter, req *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r := s.repo(req.PathValue("owner"), req.PathValue("repo"), false)
+	if r == nil {
+		http.NotFound(w, req)
+		return
+	}
+
+	content, ok := r.files[req.PathValue("ref")][req.PathValue("path")]
+	if !ok {
+		http.NotFound(w, req)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte(content))
+}
+
+// getAuthenticatedUser returns the user set with SetUser if the request has
+// its token
+func (s *Server) getAuthenticatedUser(w http.ResponseWriter, req *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.user == nil || req.Header.Get("Authorization") != "Bearer "+s.token {
+		writeError(w, http.StatusUnauthorized, "Bad credentials")
+		return
+	}
+	writeJSON(w, http.StatusOK, s.user)
+}
+
+// graphQLCommitRegex matches the commits of a query, each one under an alias
+var graphQLCommitRegex = regexp.MustCompile(`(\w+): object\(oid: "(\w+)"\)`)
+
+// graphQL answers the queries of the pull requests associated with commits,
+// and of the merged pull requests of the milestones matching a title
+func (s *Server) graphQL(w http.ResponseWriter, req *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var query struct {
+		Query     string         `json:"query"`
+		Variables map[string]any `json:"variables"`
+	}
+	if err := json.NewDecoder(req.Body).Decode(&query); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// unlike the REST API, GraphQL always requires credentials
+	if req.Header.Get("Authorization") == "" {
+		writeError(w, http.StatusUnauthorized, "This endpoint requires you to be authenticated.")
+		return
+	}
+
+	owner, _ := query.Variables["owner"].(string)
+	name, _ := query.Variables["name"].(string)
+	r := s.repo(owner, name, false)
+	if r == nil {
+		writeJSON(w, http.StatusOK, map[string]any{
+			"data":   map[string]any{"repository": nil},
+			"errors": []map[string]string{{"message": "Could not resolve to a Repository with the name '" + owner + "/" + name + "'."}},
+		})
+		return
+	}
+
+	repository := make(map[string]any)
+	if strings.Contains(query.Query, "milestones(") {
+		title, _ := query.Variables["milestone"].(string)
+		milestones := make([]any, 0)
+		for _, milestone := range r.milestones {
+			if !strings.Contains(milestone.GetTitle(), title) {
+				continue
+			}
+			prs := make([]any, 0)
+			for _, pr := range r.pullRequests {
+				merged := pr.GetMerged() || pr.MergedAt != nil
+				if merged && pr.GetMilestone().GetTitle() == milestone.GetTitle() {
+					prs = append(prs, graphQLPullRequest(pr))
+				}
+			}
+			milestones = append(milestones, map[string]any{
+				"title": milestone.GetTitle(),
+				"pullRequests": map[string]any{
+					"pageInfo": map[string]any{"hasNextPage": false, "endCursor": ""},
+					"nodes":    prs,
+				},
+			})
+		}
+		repository["milestones"] = map[string]any{"nodes": milestones}
+	}
+	for _, match := range graphQLCommitRegex.FindAllStringSubmatch(query.Query, -1) {
+		alias, sha := match[1], match[2]
+		if !slices.Contains(r.commits, sha) {
+			repository[alias] = nil
+			continue
+		}
+		prs := make([]any, 0)
+		for _, pr := range r.pullRequests {
+			if slices.Contains(r.pullCommits[pr.GetNumber()], sha) {
+				prs = append(prs, graphQLPullRequest(pr))
+			}
+		}
+		repository[alias] = map[string]any{"associatedPullRequests": map[string]any{"nodes": prs}}
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{"data": map[string]any{"repository": repository}})
+}
+
+// graphQLPullRequest returns the pull request as the GraphQL API does
+func graphQLPullRequest(pr *github.PullRequest) map[string]any {
+	node := map[string]any{
+		"number":      pr.GetNumber(),
+		"title":       pr.GetTitle(),
+		"body":        pr.GetBody(),
+		"url":         pr.GetHTMLURL(),
+		"baseRefName": pr.GetBase().GetRef(),
+		"merged":      pr.GetMerged() || pr.MergedAt != nil,
+		"mergeCommit": nil,
+		"milestone":   nil,
+	}
+	if sha := pr.GetMergeCommitSHA(); sha != "" {
+		node["mergeCommit"] = map[string]string{"oid": sha}
+	}
+	if pr.Milestone != nil {
+		node["milestone"] = map[string]string{"title": pr.GetMilestone().GetTitle()}
+	}
+	return node
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"message": message})
+}
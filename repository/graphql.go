@@ -0,0 +1,283 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/google/go-github/v81/github"
+)
+
+// graphQLBatchSize is how many commits are looked up in each GraphQL query
+const graphQLBatchSize = 50
+
+type graphQLRequest struct {
+	Query     string         `json:"query"`
+	Variables map[string]any `json:"variables,omitempty"`
+}
+
+type graphQLResponse struct {
+	Data   json.RawMessage `json:"data"`
+	Errors []struct {
+		Message string `json:"message"`
+	} `json:"errors"`
+}
+
+// graphQLPullRequest are the fields of the pull requests queried through GraphQL
+type graphQLPullRequest struct {
+	Number      int    `json:"number"`
+	Title       string `json:"title"`
+	Body        string `json:"body"`
+	URL         string `json:"url"`
+	BaseRefName string `json:"baseRefName"`
+	Merged      bool   `json:"merged"`
+	MergeCommit *struct {
+		OID string `json:"oid"`
+	} `json:"mergeCommit"`
+	Milestone *struct {
+		Title string `json:"title"`
+	} `json:"milestone"`
+}
+
+const graphQLPullRequestFields = `number title body url baseRefName merged mergeCommit { oid } milestone { title }`
+
+func (pr *graphQLPullRequest) toGithub() *github.PullRequest {
+	ghPR := github.PullRequest{
+		Number:  github.Ptr(pr.Number),
+		Title:   github.Ptr(pr.Title),
+		Body:    github.Ptr(pr.Body),
+		HTMLURL: github.Ptr(pr.URL),
+		Base:    &github.PullRequestBranch{Ref: github.Ptr(pr.BaseRefName)},
+		Merged:  github.Ptr(pr.Merged),
+	}
+	if pr.MergeCommit != nil {
+		ghPR.MergeCommitSHA = github.Ptr(pr.MergeCommit.OID)
+	}
+	if pr.Milestone != nil {
+		ghPR.Milestone = &github.Milestone{Title: github.Ptr(pr.Milestone.Title)}
+	}
+	return &ghPR
+}
+
+// graphQLURL returns the GraphQL endpoint of the API the client uses. GitHub
+// Enterprise serves the REST API under /api/v3/ and GraphQL under /api/graphql.
+func graphQLURL(base *url.URL) string {
+	if strings.HasSuffix(base.Path, "/api/v3/") {
+		return base.JoinPath("..", "graphql").String()
+	}
+	return base.JoinPath("graphql").String()
+}
+
+// graphQL runs the query with the client and decodes its data into v
+func graphQL(ctx context.Context, client *github.Client, query string, variables map[string]any, v any) error {
+	req, err := client.NewRequest(http.MethodPost, graphQLURL(client.BaseURL), graphQLRequest{Query: query, Variables: variables})
+	if err != nil {
+		return err
+	}
+
+	var res graphQLResponse
+	if _, err := client.Do(ctx, req, &res); err != nil {
+		return err
+	}
+	if len(res.Errors) > 0 {
+		return errors.New("graphql query failed: " + res.Errors[0].Message)
+	}
+
+	return json.Unmarshal(res.Data, v)
+}
+
+// isUnauthorized reports if the request failed for lack of credentials, which
+// GraphQL always requires
+func isUnauthorized(err error) bool {
+	var errRes *github.ErrorResponse
+	return errors.As(err, &errRes) && errRes.Response != nil && errRes.Response.StatusCode == http.StatusUnauthorized
+}
+
+// commitsPullRequests returns the pull requests associated with each commit.
+// The commits are looked up in batches through GraphQL, or one by one through
+// the REST API if the client has no credentials.
+func commitsPullRequests(ctx context.Context, client *github.Client, owner, repo string, shas []string) (map[string][]*github.PullRequest, error) {
+	prs, err := graphQLCommitsPullRequests(ctx, client, owner, repo, shas)
+	if err == nil || !isUnauthorized(err) {
+		return prs, err
+	}
+
+	prs = make(map[string][]*github.PullRequest, len(shas))
+	for _, sha := range shas {
+		commitPRs, _, err := client.PullRequests.ListPullRequestsWithCommit(ctx, owner, repo, sha, &github.ListOptions{})
+		if err != nil {
+			return nil, err
+		}
+		prs[sha] = commitPRs
+	}
+
+	return prs, nil
+}
+
+func graphQLCommitsPullRequests(ctx context.Context, client *github.Client, owner, repo string, shas []string) (map[string][]*github.PullRequest, error) {
+	prs := make(map[string][]*github.PullRequest, len(shas))
+
+	for start := 0; start < len(shas); start += graphQLBatchSize {
+		batch := shas[start:min(start+graphQLBatchSize, len(shas))]
+
+		// every commit is queried under an alias, c0 to cN
+		var query strings.Builder
+		query.WriteString("query($owner: String!, $name: String!) {\n  repository(owner: $owner, name: $name) {\n")
+		for i, sha := range batch {
+			query.WriteString("    c" + strconv.Itoa(i) + ": object(oid: " + strconv.Quote(sha) + ") { ...commitPullRequests }\n")
+		}
+		query.WriteString("  }\n}\n")
+		query.WriteString("fragment commitPullRequests on Commit {\n  associatedPullRequests(first: 10) { nodes { " + graphQLPullRequestFields + " } }\n}\n")
+
+		var data struct {
+			Repository map[string]*struct {
+				AssociatedPullRequests struct {
+					Nodes []graphQLPullRequest `json:"nodes"`
+				} `json:"associatedPullRequests"`
+			} `json:"repository"`
+		}
+		if err := graphQL(ctx, client, query.String(), map[string]any{"owner": owner, "name": repo}, &data); err != nil {
+			return nil, err
+		}
+
+		for i, sha := range batch {
+			commit := data.Repository["c"+strconv.Itoa(i)]
+			if commit == nil {
+				return nil, errors.New("commit " + sha + " not found in " + owner + "/" + repo)
+			}
+			prs[sha] = make([]*github.PullRequest, 0, len(commit.AssociatedPullRequests.Nodes))
+			for _, pr := range commit.AssociatedPullRequests.Nodes {
+				prs[sha] = append(prs[sha], pr.toGithub())
+			}
+		}
+	}
+
+	return prs, nil
+}
+
+const milestonePullRequestsQuery = `query($owner: String!, $name: String!, $milestone: String!, $cursor: String) {
+  repository(owner: $owner, name: $name) {
+    milestones(first: 10, query: $milestone) {
+      nodes {
+        title
+        pullRequests(first: 100, after: $cursor, states: MERGED) {
+          pageInfo { hasNextPage endCursor }
+          nodes { ` + graphQLPullRequestFields + ` }
+        }
+      }
+    }
+  }
+}`
+
+// milestonePullRequests returns the merged pull requests of the milestone
+// with the title. found is false if there's no such milestone. The pull
+// requests are queried through GraphQL, or listed as the issues of the
+// milestone through the REST API if the client has no credentials.
+func milestonePullRequests(ctx context.Context, client *github.Client, owner, repo, title string) ([]*github.PullRequest, bool, error) {
+	prs, found, err := graphQLMilestonePullRequests(ctx, client, owner, repo, title)
+	if err == nil || !isUnauthorized(err) {
+		return prs, found, err
+	}
+
+	number, err := milestoneNumber(ctx, client, owner, repo, title)
+	if err != nil || number == 0 {
+		return nil, false, err
+	}
+
+	prs = nil
+	opts := &github.IssueListByRepoOptions{Milestone: strconv.Itoa(number), State: "closed", ListOptions: github.ListOptions{PerPage: 100}}
+	for {
+		issues, resp, err := client.Issues.ListByRepo(ctx, owner, repo, opts)
+		if err != nil {
+			return nil, false, err
+		}
+		for _, issue := range issues {
+			if !issue.IsPullRequest() || issue.GetPullRequestLinks().MergedAt == nil {
+				continue
+			}
+			prs = append(prs, &github.PullRequest{
+				Number:    issue.Number,
+				Title:     issue.Title,
+				Body:      issue.Body,
+				HTMLURL:   issue.HTMLURL,
+				Milestone: issue.Milestone,
+				Merged:    github.Ptr(true),
+				MergedAt:  issue.GetPullRequestLinks().MergedAt,
+			})
+		}
+		if resp.NextPage == 0 {
+			return prs, true, nil
+		}
+		opts.ListOptions.Page = resp.NextPage
+	}
+}
+
+// milestoneNumber returns the number of the milestone with the title, or 0
+// if there's no such milestone
+func milestoneNumber(ctx context.Context, client *github.Client, owner, repo, title string) (int, error) {
+	opts := &github.MilestoneListOptions{State: "all", ListOptions: github.ListOptions{PerPage: 100}}
+	for {
+		milestones, resp, err := client.Issues.ListMilestones(ctx, owner, repo, opts)
+		if err != nil {
+			return 0, err
+		}
+		for _, milestone := range milestones {
+			if milestone.GetTitle() == title {
+				return milestone.GetNumber(), nil
+			}
+		}
+		if resp.NextPage == 0 {
+			return 0, nil
+		}
+		opts.Page = resp.NextPage
+	}
+}
+
+func graphQLMilestonePullRequests(ctx context.Context, client *github.Client, owner, repo, title string) (prs []*github.PullRequest, found bool, err error) {
+	variables := map[string]any{"owner": owner, "name": repo, "milestone": title}
+
+	for {
+		var data struct {
+			Repository struct {
+				Milestones struct {
+					Nodes []struct {
+						Title        string `json:"title"`
+						PullRequests struct {
+							PageInfo struct {
+								HasNextPage bool   `json:"hasNextPage"`
+								EndCursor   string `json:"endCursor"`
+							} `json:"pageInfo"`
+							Nodes []graphQLPullRequest `json:"nodes"`
+						} `json:"pullRequests"`
+					} `json:"nodes"`
+				} `json:"milestones"`
+			} `json:"repository"`
+		}
+		if err := graphQL(ctx, client, milestonePullRequestsQuery, variables, &data); err != nil {
+			return nil, false, err
+		}
+
+		// the query matches titles which contain it, only the exact one counts
+		next := false
+		for _, milestone := range data.Repository.Milestones.Nodes {
+			if milestone.Title != title {
+				continue
+			}
+			found = true
+			for _, pr := range milestone.PullRequests.Nodes {
+				prs = append(prs, pr.toGithub())
+			}
+			if milestone.PullRequests.PageInfo.HasNextPage {
+				variables["cursor"] = milestone.PullRequests.PageInfo.EndCursor
+				next = true
+			}
+		}
+		if !next {
+			return prs, found, nil
+		}
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"net/url"
 	"os"
 	"strings"
 	"time"
@@ -70,6 +71,24 @@ func NewGithub(ctx context.Context, token string) *github.Client {
 	return github.NewClient(oauthClient)
 }
 
+// NewGithubWithURL creates a value of type github.Client pointer which
+// talks to the API at apiURL instead of api.github.com, like a GitHub
+// Enterprise instance or a fake server in tests.
+func NewGithubWithURL(ctx context.Context, token, apiURL string) (*github.Client, error) {
+	client := NewGithub(ctx, token)
+
+	if !strings.HasSuffix(apiURL, "/") {
+		apiURL += "/"
+	}
+	baseURL, err := url.Parse(apiURL)
+	if err != nil {
+		return nil, errors.New("invalid github api url " + apiURL + ": " + err.Error())
+	}
+	client.BaseURL = baseURL
+
+	return client, nil
+}
+
 type CreateReleaseOpts struct {
 	Owner        string `json:"owner"`
 	Repo         string `json:"repo"`
@@ -181,10 +200,10 @@ type Issue struct {
 // for the given release, to be used in
 // to populate the template.
 type ChangeLog struct {
-	Title  string
-	Note   string
-	Number int
-	URL    string
+	Title  string `json:"title"`
+	Note   string `json:"note"`
+	Number int    `json:"number"`
+	URL    string `json:"url"`
 }
 
 func CreateBackportIssues(ctx context.Context, client *github.Client, origIssue *github.Issue, owner, repo, branch, user string, i *Issue) (*github.Issue, error) {
@@ -357,68 +376,6 @@ func PerformBackport(ctx context.Context, client *github.Client, pbo *PerformBac
 	return issues, nil
 }
 
-// RetrieveChangeLogContents gets the relevant changes
-// for the given release, formats, and returns them.
-func RetrieveChangeLogContents(ctx context.Context, client *github.Client, owner, repo, prevMilestone, milestone string) ([]ChangeLog, error) {
-	comp, _, err := client.Repositories.CompareCommits(ctx, owner, repo, prevMilestone, milestone, &github.ListOptions{})
-	if err != nil {
-		return nil, err
-	}
-
-	var found []ChangeLog
-	addedPRs := make(map[int]bool)
-	for _, commit := range comp.Commits {
-		sha := commit.GetSHA()
-		if sha == "" {
-			continue
-		}
-
-		prs, _, err := client.PullRequests.ListPullRequestsWithCommit(ctx, owner, repo, sha, &github.ListOptions{})
-		if err != nil {
-			return nil, err
-		}
-		if len(prs) == 1 {
-			if exists := addedPRs[prs[0].GetNumber()]; exists {
-				continue
-			}
-
-			title := stripBackportTag(strings.TrimSpace(prs[0].GetTitle()))
-			body := prs[0].GetBody()
-
-			var releaseNote string
-			var inNote bool
-			if strings.Contains(body, releaseNoteSection) && !strings.Contains(body, emptyReleaseNote) && !strings.Contains(body, noneReleaseNote) {
-				lines := strings.Split(body, "\n")
-				for _, line := range lines {
-					if strings.Contains(line, releaseNoteSection) {
-						inNote = true
-						continue
-					}
-					if strings.Contains(line, "```") {
-						inNote = false
-					}
-					if inNote && line != "" {
-						line = strings.TrimPrefix(line, "* ")
-						releaseNote += line
-					}
-				}
-				releaseNote = strings.TrimSpace(releaseNote)
-				releaseNote = strings.ReplaceAll(releaseNote, "\r", "\n")
-			}
-
-			found = append(found, ChangeLog{
-				Title:  title,
-				Note:   releaseNote,
-				Number: prs[0].GetNumber(),
-				URL:    prs[0].GetHTMLURL(),
-			})
-			addedPRs[prs[0].GetNumber()] = true
-		}
-	}
-
-	return found, nil
-}
-
 const cutRKE2ReleaseIssue = `**Summary:**
 Task covering patch release work.
 Dev Complete: 1/12 (Typically ~1 week prior to upstream release date)
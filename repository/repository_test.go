@@ -1,6 +1,16 @@
 package repository
 
-import "testing"
+import (
+	"context"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/google/go-github/v81/github"
+	"github.com/rancher/ecm-distro-tools/repository/githubtest"
+)
 
 func TestStripBackportTag(t *testing.T) {
 	tests := []struct {
@@ -48,3 +58,253 @@ func TestStripBackportTag(t *testing.T) {
 		})
 	}
 }
+
+func TestPerformBackport(t *testing.T) {
+	fake := githubtest.NewServer()
+	defer fake.Close()
+
+	fake.AddIssue("k3s-io", "k3s", &github.Issue{
+		Number:   github.Ptr(100),
+		Title:    github.Ptr("Fix etcd snapshots"),
+		State:    github.Ptr("open"),
+		Assignee: &github.User{Login: github.Ptr("maintainer")},
+	})
+
+	ctx := context.Background()
+	client, err := NewGithubWithURL(ctx, "token", fake.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	issues, err := PerformBackport(ctx, client, &PerformBackportOpts{
+		Owner:    "k3s-io",
+		Repo:     "k3s",
+		IssueID:  100,
+		Branches: []string{"release-1.30", "release-1.29"},
+	})
+	if err != nil {
+		t.Fatalf("PerformBackport() error = %v", err)
+	}
+	if len(issues) != 2 {
+		t.Fatalf("PerformBackport() created %d issues, want 2", len(issues))
+	}
+
+	created := fake.Issues("k3s-io", "k3s")[1:]
+	for i, branch := range []string{"Release-1.30", "Release-1.29"} {
+		want := "[" + branch + "] - Fix etcd snapshots"
+		if created[i].GetTitle() != want {
+			t.Errorf("issue %d title = %q, want %q", i, created[i].GetTitle(), want)
+		}
+		if created[i].GetBody() != "Backport fix for Fix etcd snapshots\n\n* #100" {
+			t.Errorf("issue %d body = %q", i, created[i].GetBody())
+		}
+		if created[i].GetNumber() != 101+i {
+			t.Errorf("issue %d number = %d, want %d", i, created[i].GetNumber(), 101+i)
+		}
+		if created[i].GetAssignee().GetLogin() != "maintainer" {
+			t.Errorf("issue %d assignee = %q, want maintainer", i, created[i].GetAssignee().GetLogin())
+		}
+		if len(created[i].Labels) != 1 || created[i].Labels[0].GetName() != "kind/backport" {
+			t.Errorf("issue %d labels = %v, want kind/backport", i, created[i].Labels)
+		}
+	}
+
+	// dry runs don't create issues
+	if _, err := PerformBackport(ctx, client, &PerformBackportOpts{
+		Owner:    "k3s-io",
+		Repo:     "k3s",
+		IssueID:  100,
+		Branches: []string{"release-1.28"},
+		DryRun:   true,
+	}); err != nil {
+		t.Fatalf("PerformBackport() error = %v", err)
+	}
+	if n := len(fake.Issues("k3s-io", "k3s")); n != 3 {
+		t.Errorf("dry run created issues, got %d issues, want 3", n)
+	}
+
+	if _, err := PerformBackport(ctx, client, &PerformBackportOpts{Owner: "k3s-io", Repo: "k3s", IssueID: 404}); err == nil {
+		t.Error("PerformBackport() expected error for a missing issue")
+	}
+}
+
+func TestRetrieveChangeLogContents(t *testing.T) {
+	fake := githubtest.NewServer()
+	defer fake.Close()
+
+	fake.AddCommits("k3s-io", "k3s", "a1", "b2", "c3", "d4")
+	fake.AddTag("k3s-io", "k3s", "v1.30.1+k3s1", "a1")
+	fake.AddTag("k3s-io", "k3s", "v1.30.2+k3s1", "d4")
+	fake.AddPullRequest("k3s-io", "k3s", &github.PullRequest{
+		Number: github.Ptr(10),
+		Title:  github.Ptr("[release-1.30] Bump containerd"),
+		Body:   github.Ptr("```release-note\r\nBumped containerd to v1.7.17\r\n```"),
+		Merged: github.Ptr(true),
+	}, "b2", "c3")
+	fake.AddPullRequest("k3s-io", "k3s", &github.PullRequest{
+		Number: github.Ptr(11),
+		Title:  github.Ptr("Fix flaky test"),
+		Body:   github.Ptr("```release-note\r\nNONE\r\n```"),
+		Merged: github.Ptr(true),
+	}, "d4")
+
+	ctx := context.Background()
+	client, err := NewGithubWithURL(ctx, "", fake.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := RetrieveChangeLogContents(ctx, client, "k3s-io", "k3s", "v1.30.1+k3s1", "v1.30.2+k3s1")
+	if err != nil {
+		t.Fatalf("RetrieveChangeLogContents() error = %v", err)
+	}
+	want := []ChangeLog{
+		{Title: "Bump containerd", Note: "Bumped containerd to v1.7.17", Number: 10, URL: "https://github.com/k3s-io/k3s/pull/10"},
+		{Title: "Fix flaky test", Number: 11, URL: "https://github.com/k3s-io/k3s/pull/11"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("RetrieveChangeLogContents() = %+v, want %+v", got, want)
+	}
+}
+
+func TestReconcileChangeLog(t *testing.T) {
+	fake := githubtest.NewServer()
+	defer fake.Close()
+
+	milestone := &github.Milestone{Title: github.Ptr("v1.30.2+k3s1")}
+	merged := &github.Timestamp{}
+	fake.AddMilestone("k3s-io", "k3s", milestone)
+	fake.AddCommits("k3s-io", "k3s", "a1", "b2", "c3", "d4", "e5", "f6", "g7")
+	fake.AddTag("k3s-io", "k3s", "v1.30.1+k3s1", "a1")
+	fake.AddTag("k3s-io", "k3s", "v1.30.2-rc1+k3s1", "g7")
+
+	// b2 is a direct push, c3 is associated with the original pull request,
+	// its backport and a closed one, d4 with two pull requests but merged by
+	// one of them, g7 with two outside the milestone but one is based on the
+	// release branch
+	fake.AddPullRequest("k3s-io", "k3s", &github.PullRequest{Number: github.Ptr(10), Title: github.Ptr("Bump containerd"), MergedAt: merged}, "c3")
+	fake.AddPullRequest("k3s-io", "k3s", &github.PullRequest{Number: github.Ptr(12), Title: github.Ptr("[release-1.30] Bump containerd"), Milestone: milestone, MergedAt: merged}, "c3")
+	fake.AddPullRequest("k3s-io", "k3s", &github.PullRequest{Number: github.Ptr(18), Title: github.Ptr("[release-1.30] Bump containerd again"), Milestone: milestone, State: github.Ptr("closed")}, "c3")
+	fake.AddPullRequest("k3s-io", "k3s", &github.PullRequest{Number: github.Ptr(13), Title: github.Ptr("Bump runc"), MergeCommitSHA: github.Ptr("d4"), MergedAt: merged}, "d4")
+	fake.AddPullRequest("k3s-io", "k3s", &github.PullRequest{Number: github.Ptr(14), Title: github.Ptr("Update runc"), Milestone: milestone, MergedAt: merged}, "d4")
+	fake.AddPullRequest("k3s-io", "k3s", &github.PullRequest{Number: github.Ptr(15), Title: github.Ptr("Bump flannel"), Milestone: milestone, MergedAt: merged}, "e5", "f6")
+	// merged in the milestone, but after the tag
+	fake.AddPullRequest("k3s-io", "k3s", &github.PullRequest{Number: github.Ptr(16), Title: github.Ptr("Bump kine"), Milestone: milestone, MergedAt: merged})
+	// in the milestone, but not merged
+	fake.AddPullRequest("k3s-io", "k3s", &github.PullRequest{Number: github.Ptr(17), Title: github.Ptr("Bump etcd"), Milestone: milestone})
+	fake.AddPullRequest("k3s-io", "k3s", &github.PullRequest{Number: github.Ptr(19), Title: github.Ptr("[release-1.30] Bump coredns"), Base: &github.PullRequestBranch{Ref: github.Ptr("release-1.30")}, MergedAt: merged}, "g7")
+	fake.AddPullRequest("k3s-io", "k3s", &github.PullRequest{Number: github.Ptr(20), Title: github.Ptr("Bump coredns"), Base: &github.PullRequestBranch{Ref: github.Ptr("master")}, MergedAt: merged}, "g7")
+
+	ctx := context.Background()
+	client, err := NewGithubWithURL(ctx, "", fake.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := ReconcileChangeLog(ctx, client, "k3s-io", "k3s", "v1.30.1+k3s1", "v1.30.2-rc1+k3s1")
+	if err != nil {
+		t.Fatalf("ReconcileChangeLog() error = %v", err)
+	}
+
+	var changelog []int
+	for _, cl := range report.ChangeLog {
+		changelog = append(changelog, cl.Number)
+	}
+	if want := []int{12, 13, 15, 19}; !reflect.DeepEqual(changelog, want) {
+		t.Errorf("ChangeLog = %v, want %v", changelog, want)
+	}
+	if want := []OrphanCommit{{SHA: "b2"}}; !reflect.DeepEqual(report.OrphanCommits, want) {
+		t.Errorf("OrphanCommits = %+v, want %+v", report.OrphanCommits, want)
+	}
+	wantMulti := []MultiPRCommit{
+		{SHA: "c3", PullRequests: []int{10, 12}, Picked: 12, Reason: PickedMilestone},
+		{SHA: "d4", PullRequests: []int{13, 14}, Picked: 13, Reason: PickedMergeCommit},
+		{SHA: "g7", PullRequests: []int{19, 20}, Picked: 19, Reason: PickedBranch},
+	}
+	if !reflect.DeepEqual(report.MultiPRCommits, wantMulti) {
+		t.Errorf("MultiPRCommits = %+v, want %+v", report.MultiPRCommits, wantMulti)
+	}
+	if report.ReleaseMilestone != "v1.30.2+k3s1" {
+		t.Errorf("ReleaseMilestone = %q, want v1.30.2+k3s1", report.ReleaseMilestone)
+	}
+	if len(report.NotInRange) != 2 || report.NotInRange[0].Number != 14 || report.NotInRange[1].Number != 16 {
+		t.Errorf("NotInRange = %+v, want #14 and #16", report.NotInRange)
+	}
+	if len(report.NotInMilestone) != 2 || report.NotInMilestone[0].Number != 13 || report.NotInMilestone[1].Number != 19 {
+		t.Errorf("NotInMilestone = %+v, want #13 and #19", report.NotInMilestone)
+	}
+
+	// with a token the pull requests are queried through GraphQL instead
+	authClient, err := NewGithubWithURL(ctx, "token", fake.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	authReport, err := ReconcileChangeLog(ctx, authClient, "k3s-io", "k3s", "v1.30.1+k3s1", "v1.30.2-rc1+k3s1")
+	if err != nil {
+		t.Fatalf("ReconcileChangeLog() with a token error = %v", err)
+	}
+	if !reflect.DeepEqual(authReport, report) {
+		t.Errorf("ReconcileChangeLog() with a token = %+v, want %+v", authReport, report)
+	}
+
+	// without a milestone the cross-check is skipped
+	fake.AddTag("k3s-io", "k3s", "v1.30.3-rc1+k3s1", "f6")
+	report, err = ReconcileChangeLog(ctx, client, "k3s-io", "k3s", "v1.30.1+k3s1", "v1.30.3-rc1+k3s1")
+	if err != nil {
+		t.Fatalf("ReconcileChangeLog() error = %v", err)
+	}
+	if report.ReleaseMilestone != "" || len(report.NotInRange) != 0 || len(report.NotInMilestone) != 0 {
+		t.Errorf("ReconcileChangeLog() cross-checked a missing milestone: %+v", report)
+	}
+	if !strings.Contains(report.String(), "No milestone v1.30.3+k3s1, skipped the milestone cross-check") {
+		t.Errorf("String() = %q, missing the skipped cross-check", report.String())
+	}
+}
+
+func TestCommitsPullRequestsBatches(t *testing.T) {
+	fake := githubtest.NewServer()
+	defer fake.Close()
+
+	// more commits than a single query looks up
+	shas := make([]string, graphQLBatchSize*2+1)
+	for i := range shas {
+		shas[i] = "c" + strconv.Itoa(i)
+		fake.AddPullRequest("rancher", "rke2", &github.PullRequest{Number: github.Ptr(i + 1)}, shas[i])
+	}
+	fake.AddCommits("rancher", "rke2", shas...)
+
+	ctx := context.Background()
+	client, err := NewGithubWithURL(ctx, "token", fake.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	prs, err := commitsPullRequests(ctx, client, "rancher", "rke2", shas)
+	if err != nil {
+		t.Fatalf("commitsPullRequests() error = %v", err)
+	}
+	for i, sha := range shas {
+		if len(prs[sha]) != 1 || prs[sha][0].GetNumber() != i+1 {
+			t.Errorf("commitsPullRequests()[%s] = %v, want #%d", sha, prs[sha], i+1)
+		}
+	}
+
+	if _, err := commitsPullRequests(ctx, client, "rancher", "rke2", []string{"missing"}); err == nil {
+		t.Error("commitsPullRequests() expected error for a missing commit")
+	}
+}
+
+func TestGraphQLURL(t *testing.T) {
+	for base, want := range map[string]string{
+		"https://api.github.com/":            "https://api.github.com/graphql",
+		"https://github.example.com/api/v3/": "https://github.example.com/api/graphql",
+	} {
+		u, err := url.Parse(base)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := graphQLURL(u); got != want {
+			t.Errorf("graphQLURL(%s) = %s, want %s", base, got, want)
+		}
+	}
+}